@@ -7,21 +7,27 @@ import (
 
 	"favourite_assets/server/services"
     "favourite_assets/server/errors"
+	"favourite_assets/server/models"
 	"github.com/Nerzal/gocloak/v13"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
 )
 
 type contextKey string
 
 const (
-	UserInfoKey contextKey = "userInfo"
-	RolesKey    contextKey = "roles"
+	UserInfoKey    contextKey = "userInfo"
+	RolesKey       contextKey = "roles"
+	LocalUserIDKey contextKey = "localUserID"
 )
 
 func KeycloakAuth(kc *services.KeycloakService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
+			// RFC 6750: a 401 names the scheme, and why a token was refused
 			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+				w.Header().Set("WWW-Authenticate", "Bearer")
 				errors.WriteError(w, errors.ErrUnauthorized)
 				return
 			}
@@ -30,6 +36,7 @@ func KeycloakAuth(kc *services.KeycloakService) func(http.Handler) http.Handler
 
 			userInfo, roles, err := kc.VerifyToken(r.Context(), token)
 			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
 				errors.WriteError(w, errors.ErrInvalidToken)
 				return
 			}
@@ -42,6 +49,42 @@ func KeycloakAuth(kc *services.KeycloakService) func(http.Handler) http.Handler
 	}
 }
 
+// ProvisionUser links the caller to a local user, creating it on the first
+// request. Must run after KeycloakAuth.
+func ProvisionUser(users *services.UserService, issuer string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userInfo := GetUserInfo(r.Context())
+			if userInfo == nil || userInfo.Sub == nil || *userInfo.Sub == "" {
+				errors.WriteError(w, errors.ErrUnauthorized)
+				return
+			}
+
+			user, err := users.ProvisionUser(
+				models.ExternalIdentity{Issuer: issuer, Subject: *userInfo.Sub},
+				services.Claims{
+					Name:          gocloak.PString(userInfo.Name),
+					Email:         gocloak.PString(userInfo.Email),
+					EmailVerified: gocloak.PBool(userInfo.EmailVerified),
+					Username:      gocloak.PString(userInfo.PreferredUsername),
+				},
+				GetActor(r.Context()),
+			)
+			if err == errors.ErrAccountDeleted {
+				errors.WriteError(w, err)
+				return
+			}
+			if err != nil {
+				errors.WriteError(w, errors.ErrInternal)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), LocalUserIDKey, user.ID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 // GetUserInfo from context
 func GetUserInfo(ctx context.Context) *gocloak.UserInfo {
 	if v := ctx.Value(UserInfoKey); v != nil {
@@ -76,7 +119,15 @@ func RequireRole(ctx context.Context, role string) error {
 	return errors.ErrForbidden
 }
 
-// GetUserID helper (from Keycloak's "sub" claim) for future db authentication
+// GetLocalUserID returns the ID of the local user linked to the caller
+func GetLocalUserID(ctx context.Context) (uuid.UUID, error) {
+	if v, ok := ctx.Value(LocalUserIDKey).(uuid.UUID); ok {
+		return v, nil
+	}
+	return uuid.Nil, errors.ErrUnauthorized
+}
+
+// GetUserID helper (from Keycloak's "sub" claim)
 func GetUserID(ctx context.Context) (string, error) {
 	userInfo := GetUserInfo(ctx)
 	if userInfo == nil || userInfo.Sub == nil {
@@ -84,3 +135,17 @@ func GetUserID(ctx context.Context) (string, error) {
 	}
 	return *userInfo.Sub, nil
 }
+
+// GetActor describes the caller for the audit log: its token subject,
+// username and roles, and the ID of the request
+func GetActor(ctx context.Context) models.Actor {
+	actor := models.Actor{
+		Roles:     GetRoles(ctx),
+		RequestID: middleware.GetReqID(ctx),
+	}
+	if userInfo := GetUserInfo(ctx); userInfo != nil {
+		actor.Subject = gocloak.PString(userInfo.Sub)
+		actor.Username = gocloak.PString(userInfo.PreferredUsername)
+	}
+	return actor
+}
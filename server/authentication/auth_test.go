@@ -0,0 +1,51 @@
+package authentication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"favourite_assets/server/config"
+	"favourite_assets/server/services"
+)
+
+func TestKeycloakAuthRejects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, []byte(`{"keys":[]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kc := services.NewKeycloakService(config.KeycloakConfig{Issuer: "https://keycloak.example.com/realms/test", JWKSFile: path, CacheTTL: time.Hour})
+	handler := KeycloakAuth(kc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler reached without a valid token")
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		challenge     string
+	}{
+		{"no token", "", "Bearer"},
+		{"other scheme", "Basic YWRhOnNlY3JldA==", "Bearer"},
+		{"invalid token", "Bearer not.a.token", `Bearer error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("got status %d, want 401", w.Code)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("got WWW-Authenticate %q, want %q", got, tt.challenge)
+			}
+		})
+	}
+}
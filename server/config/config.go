@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type KeycloakConfig struct {
+	// Issuer must match the "iss" claim of incoming tokens
+	Issuer string
+	// JWKSURL is where the realm signing keys are fetched from
+	JWKSURL string
+	// JWKSFile, when set, is used instead of JWKSURL (offline / tests)
+	JWKSFile string
+	// Audience must appear in "aud" or be the "azp" of the token
+	Audience string
+	// CacheTTL is how long fetched keys are trusted before a refresh
+	CacheTTL time.Duration
+	// MinRefreshInterval throttles refreshes triggered by unknown key IDs
+	MinRefreshInterval time.Duration
+	// Leeway is the clock skew tolerated on exp / nbf
+	Leeway time.Duration
+}
+
+type StorageConfig struct {
+	// Backend is one of "memory", "postgres" or "sqlite"
+	Backend string
+	// DSN is the database connection string for the SQL backends
+	DSN string
+	// WALDir makes the memory backend durable by journaling to this directory
+	WALDir string
+	// WALSync fsyncs the write-ahead log after every record
+	WALSync bool
+	// SnapshotInterval is how often the write-ahead log is compacted
+	SnapshotInterval time.Duration
+	// SearchReindexInterval is how often the SQL backends rebuild the search
+	// index, to find assets written by other instances
+	SearchReindexInterval time.Duration
+}
+
+type IntegrityConfig struct {
+	// UserDeletePolicy is "cascade" or "restrict"
+	UserDeletePolicy string
+	// AssetDeletePolicy is "cascade", "restrict" or "mark"
+	AssetDeletePolicy string
+}
+
+type ChartConfig struct {
+	// MaxSeries is the number of series a chart may have
+	MaxSeries int
+	// MaxPoints is the number of data points a chart may have across all series
+	MaxPoints int
+}
+
+type ConcurrencyConfig struct {
+	// RequireIfMatch makes PUT, PATCH and DELETE of users and assets fail
+	// with 428 unless they send If-Match; when false it is only honored
+	RequireIfMatch bool
+}
+
+type TrashConfig struct {
+	// Retention is how long deleted users and assets stay in the trash; zero
+	// keeps them until they are purged
+	Retention time.Duration
+	// PurgeInterval is how often expired items are looked for
+	PurgeInterval time.Duration
+}
+
+type Config struct {
+	Addr        string
+	Keycloak    KeycloakConfig
+	Storage     StorageConfig
+	Integrity   IntegrityConfig
+	Charts      ChartConfig
+	Concurrency ConcurrencyConfig
+	Trash       TrashConfig
+}
+
+// Load reads the configuration from environment variables, falling back to
+// defaults that match docker-compose.yml. A variable that is set but cannot
+// be parsed is an error, rather than silently replaced by its default.
+func Load() (Config, error) {
+	env := &envReader{}
+	issuer := strings.TrimSuffix(getEnv("KEYCLOAK_ISSUER", "http://localhost:8081/realms/favourite-assets"), "/")
+
+	cfg := Config{
+		Addr: getEnv("SERVER_ADDR", ":8080"),
+		Keycloak: KeycloakConfig{
+			Issuer:             issuer,
+			JWKSURL:            getEnv("KEYCLOAK_JWKS_URL", issuer+"/protocol/openid-connect/certs"),
+			JWKSFile:           getEnv("KEYCLOAK_JWKS_FILE", ""),
+			Audience:           getEnv("KEYCLOAK_AUDIENCE", "favourite-assets"),
+			CacheTTL:           env.duration("KEYCLOAK_JWKS_CACHE_TTL", 10*time.Minute),
+			MinRefreshInterval: env.duration("KEYCLOAK_JWKS_MIN_REFRESH", 30*time.Second),
+			Leeway:             env.duration("KEYCLOAK_LEEWAY", 30*time.Second),
+		},
+		Storage: StorageConfig{
+			Backend:               strings.ToLower(getEnv("STORAGE_BACKEND", "memory")),
+			DSN:                   getEnv("DATABASE_URL", ""),
+			WALDir:                getEnv("WAL_DIR", ""),
+			WALSync:               env.boolean("WAL_SYNC", true),
+			SnapshotInterval:      env.duration("SNAPSHOT_INTERVAL", 5*time.Minute),
+			SearchReindexInterval: env.duration("SEARCH_REINDEX_INTERVAL", time.Minute),
+		},
+		Integrity: IntegrityConfig{
+			UserDeletePolicy:  getEnv("USER_DELETE_POLICY", "cascade"),
+			AssetDeletePolicy: getEnv("ASSET_DELETE_POLICY", "mark"),
+		},
+		Charts: ChartConfig{
+			MaxSeries: env.integer("CHART_MAX_SERIES", 20),
+			MaxPoints: env.integer("CHART_MAX_POINTS", 10000),
+		},
+		Concurrency: ConcurrencyConfig{
+			RequireIfMatch: env.boolean("REQUIRE_IF_MATCH", false),
+		},
+		Trash: TrashConfig{
+			Retention:     env.duration("TRASH_RETENTION", 30*24*time.Hour),
+			PurgeInterval: env.duration("TRASH_PURGE_INTERVAL", time.Hour),
+		},
+	}
+	return cfg, errors.Join(env.errs...)
+}
+
+func getEnv(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// envReader parses typed variables and collects the parse errors
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) duration(key string, def time.Duration) time.Duration {
+	v := getEnv(key, "")
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not a duration, e.g. 90s, 30m or 720h", key, v))
+		return def
+	}
+	return d
+}
+
+func (e *envReader) boolean(key string, def bool) bool {
+	v := getEnv(key, "")
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not true or false", key, v))
+		return def
+	}
+	return b
+}
+
+func (e *envReader) integer(key string, def int) int {
+	v := getEnv(key, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not an integer", key, v))
+		return def
+	}
+	return n
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Trash.Retention != 30*24*time.Hour || !cfg.Storage.WALSync || cfg.Charts.MaxPoints != 10000 {
+		t.Errorf("got %+v, want the defaults", cfg)
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	t.Setenv("TRASH_RETENTION", "7days")
+	t.Setenv("WAL_SYNC", "sometimes")
+	t.Setenv("CHART_MAX_POINTS", "abc")
+	t.Setenv("SNAPSHOT_INTERVAL", "10m")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("got no error, want the invalid values reported")
+	}
+	for _, key := range []string{"TRASH_RETENTION", "WAL_SYNC", "CHART_MAX_POINTS"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("got %q, want %s reported", err, key)
+		}
+	}
+	if strings.Contains(err.Error(), "SNAPSHOT_INTERVAL") {
+		t.Errorf("got %q, want the valid SNAPSHOT_INTERVAL accepted", err)
+	}
+}
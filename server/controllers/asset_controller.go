@@ -2,19 +2,31 @@ package controllers
 
 import (
 	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
 	"favourite_assets/server/errors"
 	"favourite_assets/server/authentication"
+	"favourite_assets/server/etag"
+	"favourite_assets/server/filter"
 	"favourite_assets/server/models"
+	"favourite_assets/server/paging"
+	"favourite_assets/server/render"
 	"favourite_assets/server/services"
+	"favourite_assets/server/validation"
 )
 
 type AssetController struct {
 	AssetService *services.AssetService
+	// RequireIfMatch rejects writes without an If-Match header
+	RequireIfMatch bool
 }
 
 func NewAssetController(assetService *services.AssetService) *AssetController {
@@ -34,53 +46,39 @@ func (c *AssetController) CreateAssetHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	var req map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errors.WriteError(w, errors.ErrBadRequest)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		errors.WriteJSONError(w, bodyError(err, errors.ErrBadRequest))
 		return
 	}
 
-	var asset models.Asset
-	assetTypeStr, ok := req["type"].(string)
+	// Read the type first, then decode the whole body into the typed request
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &header); err != nil {
+		errors.WriteJSONError(w, errors.ErrInvalidBody)
+		return
+	}
+	kind, ok := models.LookupAssetKind(models.AssetType(strings.ToLower(header.Type)))
 	if !ok {
-		errors.WriteError(w, errors.ErrBadRequest)
+		errors.WriteJSONError(w, errors.ErrUnknownAssetType)
 		return
 	}
-	assetType := models.AssetType(strings.ToLower(assetTypeStr))
-
-	switch assetType {
-	case models.AssetChart:
-		asset = &models.Chart{
-			BaseAsset: models.BaseAsset{Description: req["description"].(string)},
-			Title:     req["title"].(string),
-			XAxis:     req["xAxis"].(string),
-			YAxis:     req["yAxis"].(string),
-		}
-	case models.AssetInsight:
-		asset = &models.Insight{
-			BaseAsset: models.BaseAsset{Description: req["description"].(string)},
-			Text:      req["text"].(string),
-		}
-	case models.AssetAudience:
-		asset = &models.Audience{
-			BaseAsset:          models.BaseAsset{Description: req["description"].(string)},
-			Gender:             req["gender"].(string),
-			BirthCountry:       req["birthCountry"].(string),
-			AgeGroup:           req["ageGroup"].(string),
-			HoursOnSocial:      int(req["hoursSocialDaily"].(float64)),
-			PurchasesLastMonth: int(req["purchasesLastMonth"].(float64)),
-		}
-	default:
-		errors.WriteError(w, errors.ErrBadRequest)
+	asset, err := kind.Decode(body)
+	if err != nil {
+		errors.WriteJSONError(w, err)
 		return
 	}
 
-	created, err := c.AssetService.CreateAsset(asset)
+	actor := authentication.GetActor(r.Context())
+	created, err := c.AssetService.CreateAsset(asset, actor)
 	if err != nil {
-		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		errors.WriteJSONError(w, err)
 		return
 	}
 
+	etag.Set(w, created.Base().Version)
 	errors.WriteJSON(w, http.StatusCreated, created)
 }
 
@@ -98,12 +96,37 @@ func (c *AssetController) GetAssetHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Chart data can be filtered, aggregated and downsampled on the way out
+	query := r.URL.Query()
+	chartQuery := models.ChartQuery{
+		From:       query.Get("from"),
+		To:         query.Get("to"),
+		Points:     query.Get("points"),
+		Downsample: strings.ToLower(query.Get("downsample")),
+		Aggregate:  strings.ToLower(query.Get("aggregate")),
+		Bucket:     query.Get("bucket"),
+	}
+	if !chartQuery.IsZero() {
+		chart, err := c.AssetService.QueryChart(assetID, chartQuery)
+		if err != nil {
+			errors.WriteJSONError(w, err)
+			return
+		}
+		// No ETag: the tag names the whole asset, not this view of it
+		errors.WriteJSON(w, http.StatusOK, chart)
+		return
+	}
+
 	asset, err := c.AssetService.GetAsset(assetID)
 	if err != nil {
 		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
 
+	if etag.NotModified(w, r, asset.Base().Version) {
+		return
+	}
+	etag.Set(w, asset.Base().Version)
 	errors.WriteJSON(w, http.StatusOK, asset)
 }
 
@@ -126,20 +149,236 @@ func (c *AssetController) UpdateAssetHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	var req map[string]interface{}
+	ifMatch, ok := ifMatchHeader(w, r, c.RequireIfMatch)
+	if !ok {
+		return
+	}
+
+	var req json.RawMessage
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteError(w, bodyError(err, errors.ErrBadRequest))
+		return
+	}
+	actor := authentication.GetActor(r.Context())
+	updated, err := c.AssetService.ReplaceAsset(assetID, req, actor, ifMatch)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	etag.Set(w, updated.Base().Version)
+	errors.WriteJSON(w, http.StatusOK, updated)
+}
+
+// (admin-only)
+func (c *AssetController) PatchAssetHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	// RFC 7396 registers application/merge-patch+json, plain JSON is accepted too
+	switch mediaType(r) {
+	case "", "application/json", "application/merge-patch+json":
+	default:
+		errors.WriteJSONError(w, errors.ErrUnsupportedMediaType)
+		return
+	}
+
+	assetID, err := uuid.Parse(r.URL.Query().Get("assetId"))
+	if err != nil {
 		errors.WriteError(w, errors.ErrBadRequest)
 		return
 	}
-	updated, err := c.AssetService.UpdateAsset(assetID, req)
+
+	ifMatch, ok := ifMatchHeader(w, r, c.RequireIfMatch)
+	if !ok {
+		return
+	}
+
+	var patch json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		errors.WriteJSONError(w, bodyError(err, errors.ErrInvalidBody))
+		return
+	}
+
+	actor := authentication.GetActor(r.Context())
+	updated, err := c.AssetService.PatchAsset(assetID, patch, actor, ifMatch)
 	if err != nil {
-		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		errors.WriteJSONError(w, err)
 		return
 	}
 
+	etag.Set(w, updated.Base().Version)
 	errors.WriteJSON(w, http.StatusOK, updated)
 }
 
+// (all-roles)
+func (c *AssetController) SearchAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	v := &validation.Validator{}
+	text := query.Get("q")
+	v.Required("q", text)
+
+	// type may be repeated or comma-separated
+	var types []models.AssetType
+	for _, param := range query["type"] {
+		for _, t := range strings.Split(param, ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if _, ok := models.LookupAssetKind(models.AssetType(t)); !ok {
+				v.Add("type", "must be one of "+strings.Join(assetTypeNames(), ", "))
+				continue
+			}
+			types = append(types, models.AssetType(t))
+		}
+	}
+
+	limit := services.DefaultSearchLimit
+	if param := query.Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil {
+			v.Add("limit", "must be a whole number")
+		} else if v.Range("limit", n, 1, services.MaxSearchLimit) {
+			limit = n
+		}
+	}
+	if err := v.Err(); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	results, err := c.AssetService.SearchAssets(text, types, limit)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+	errors.WriteJSON(w, http.StatusOK, results)
+}
+
+func assetTypeNames() []string {
+	var names []string
+	for _, t := range models.AssetTypes() {
+		names = append(names, string(t))
+	}
+	return names
+}
+
+// Render sizes in pixels
+const (
+	defaultRenderWidth  = 800
+	defaultRenderHeight = 400
+	minRenderSize       = 200
+	maxRenderSize       = 4000
+	// maxRenderPixels caps width x height of PNGs, which are drawn in memory
+	maxRenderPixels = 4_000_000
+)
+
+// (all-roles)
+func (c *AssetController) RenderAssetHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	assetID, err := uuid.Parse(query.Get("assetId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+
+	opts := models.RenderOptions{
+		Format: strings.ToLower(query.Get("format")),
+		Style:  strings.ToLower(query.Get("style")),
+	}
+	if opts.Format == "" {
+		opts.Format = render.FormatSVG
+	}
+
+	v := &validation.Validator{}
+	opts.Width = renderSize(v, "width", query.Get("width"), defaultRenderWidth)
+	opts.Height = renderSize(v, "height", query.Get("height"), defaultRenderHeight)
+	if opts.Format == render.FormatPNG && opts.Width*opts.Height > maxRenderPixels {
+		v.Add("height", fmt.Sprintf("times width must be at most %d pixels for png", maxRenderPixels))
+	}
+	if opts.Style != "" {
+		v.OneOf("style", opts.Style, []string{render.StyleLine, render.StyleBar})
+	}
+	if err := v.Err(); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	rendering, err := c.AssetService.RenderAsset(assetID, opts)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	lastModified := rendering.UpdatedAt.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	// Dates are whole seconds, so compare at that precision
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", rendering.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(rendering.Data)
+}
+
+// renderSize parses a width or height query parameter
+func renderSize(v *validation.Validator, field, value string, def int) int {
+	if value == "" {
+		return def
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil {
+		v.Add(field, "must be a whole number")
+		return 0
+	}
+	v.Range(field, size, minRenderSize, maxRenderSize)
+	return size
+}
+
+// ifMatchHeader returns the If-Match condition of r. When the header is
+// required but missing it writes 428 and returns false.
+func ifMatchHeader(w http.ResponseWriter, r *http.Request, required bool) (etag.Condition, bool) {
+	ifMatch := etag.IfMatch(r)
+	if required && !ifMatch.Present() {
+		errors.WriteJSONError(w, errors.ErrPreconditionRequired)
+		return etag.Condition{}, false
+	}
+	return ifMatch, true
+}
+
+// bodyError returns ErrBodyTooLarge when reading a body failed at its size
+// limit, and fallback for any other failure
+func bodyError(err error, fallback *errors.HTTPError) *errors.HTTPError {
+	var tooLarge *http.MaxBytesError
+	if stderrors.As(err, &tooLarge) {
+		return errors.ErrBodyTooLarge
+	}
+	return fallback
+}
+
+// mediaType returns the Content-Type of r without its parameters
+func mediaType(r *http.Request) string {
+	contentType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
 // (admin- only)
 func (c *AssetController) DeleteAssetHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -160,8 +399,14 @@ func (c *AssetController) DeleteAssetHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if err := c.AssetService.DeleteAsset(assetID); err != nil {
-		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	ifMatch, ok := ifMatchHeader(w, r, c.RequireIfMatch)
+	if !ok {
+		return
+	}
+
+	actor := authentication.GetActor(r.Context())
+	if err := c.AssetService.DeleteAsset(assetID, ifMatch, actor); err != nil {
+		errors.WriteJSONError(w, err)
 		return
 	}
 
@@ -177,12 +422,37 @@ func (c *AssetController) ListAssetsHandler(w http.ResponseWriter, r *http.Reque
 
 	queryType := r.URL.Query().Get("type")
 
-	var assets []models.Asset
-	if queryType != "" {
-		assets = c.AssetService.ListAssetsByType(models.AssetType(queryType))
-	} else {
-		assets = c.AssetService.ListAssets()
+	page, err := paging.Parse(r.URL.Query(), services.AssetSorts)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	// filter may be repeated; all expressions must hold
+	v := &validation.Validator{}
+	var audienceFilter filter.Filter
+	for _, expr := range r.URL.Query()["filter"] {
+		f, err := filter.Parse(expr, models.AudienceFilterFields)
+		if err != nil {
+			v.Add("filter", err.Error())
+			continue
+		}
+		audienceFilter = append(audienceFilter, f...)
+	}
+	if len(r.URL.Query()["filter"]) > 0 && queryType != "" && models.AssetType(queryType) != models.AssetAudience {
+		v.Add("type", "filters only apply to audience assets")
+	}
+	if err := v.Err(); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	assets, next, err := c.AssetService.ListAssets(models.AssetType(queryType), audienceFilter, page)
+	if err != nil {
+		errors.WriteError(w, errors.ErrInternal)
+		return
 	}
 
+	paging.SetLink(w, r, next)
 	errors.WriteJSON(w, http.StatusOK, assets)
 }
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+
+	"favourite_assets/server/authentication"
+	"favourite_assets/server/models"
+	"favourite_assets/server/repositories"
+	"favourite_assets/server/services"
+)
+
+func TestRenderAssetHandler(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	audit := services.NewAuditLog(store.Audit)
+	assets := services.NewAssetService(store.Assets, store.AssetVersions, store.Favourites, store.Collections, services.DeleteCascade, audit)
+	controller := NewAssetController(assets)
+
+	actor := models.Actor{Subject: "admin-sub", Username: "admin", Roles: []string{"admin"}}
+	chart, err := assets.CreateAsset(&models.Chart{Title: "Revenue", XAxis: "month", YAxis: "amount", XAxisType: models.AxisNumber, Data: [][2]any{{1.0, 10.0}, {2.0, 12.5}}}, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insight, err := assets.CreateAsset(&models.Insight{Text: "40% of millennials spend more than 3 hours on social media daily"}, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(query url.Values, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/assets/render?"+query.Encode(), nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		r = r.WithContext(context.WithValue(r.Context(), authentication.UserInfoKey, &gocloak.UserInfo{}))
+		w := httptest.NewRecorder()
+		controller.RenderAssetHandler(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name        string
+		query       url.Values
+		status      int
+		contentType string
+	}{
+		{"svg by default", url.Values{"assetId": {chart.GetID().String()}}, http.StatusOK, "image/svg+xml"},
+		{"png", url.Values{"assetId": {chart.GetID().String()}, "format": {"PNG"}}, http.StatusOK, "image/png"},
+		{"unknown format", url.Values{"assetId": {chart.GetID().String()}, "format": {"gif"}}, http.StatusUnsupportedMediaType, "application/json"},
+		{"not a chart", url.Values{"assetId": {insight.GetID().String()}}, http.StatusConflict, "application/json"},
+		{"too small", url.Values{"assetId": {chart.GetID().String()}, "width": {"199"}}, http.StatusUnprocessableEntity, "application/json"},
+		{"unknown style", url.Values{"assetId": {chart.GetID().String()}, "style": {"pie"}}, http.StatusUnprocessableEntity, "application/json"},
+
+		// Large PNGs are capped by their area, SVGs only by their sides
+		{"png at the pixel cap", url.Values{"assetId": {chart.GetID().String()}, "format": {"png"}, "width": {"2000"}, "height": {"2000"}}, http.StatusOK, "image/png"},
+		{"png over the pixel cap", url.Values{"assetId": {chart.GetID().String()}, "format": {"png"}, "width": {"2000"}, "height": {"2001"}}, http.StatusUnprocessableEntity, "application/json"},
+		{"svg over the pixel cap", url.Values{"assetId": {chart.GetID().String()}, "width": {"4000"}, "height": {"4000"}}, http.StatusOK, "image/svg+xml"},
+	}
+	for _, tt := range tests {
+		w := get(tt.query, nil)
+		if w.Code != tt.status {
+			t.Errorf("%s: got %d (%s), want %d", tt.name, w.Code, w.Body, tt.status)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: got content type %q, want %q", tt.name, got, tt.contentType)
+		}
+	}
+
+	// The image is only sent again once the chart changed
+	query := url.Values{"assetId": {chart.GetID().String()}}
+	lastModified := get(query, nil).Header().Get("Last-Modified")
+	if w := get(query, http.Header{"If-Modified-Since": {lastModified}}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("got %d with %d bytes, want 304 without a body", w.Code, w.Body.Len())
+	}
+	earlier := chart.Base().UpdatedAt.Add(-time.Second).UTC().Format(http.TimeFormat)
+	if w := get(query, http.Header{"If-Modified-Since": {earlier}}); w.Code != http.StatusOK {
+		t.Errorf("got %d for an older date, want 200", w.Code)
+	}
+}
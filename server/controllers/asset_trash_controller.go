@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/authentication"
+	"favourite_assets/server/errors"
+	"favourite_assets/server/etag"
+	"favourite_assets/server/paging"
+	"favourite_assets/server/services"
+)
+
+// (admin-only)
+func (c *AssetController) ListTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	page, err := paging.Parse(r.URL.Query(), services.TrashSorts)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	assets, next, err := c.AssetService.ListTrash(page)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+	paging.SetLink(w, r, next)
+	errors.WriteJSON(w, http.StatusOK, assets)
+}
+
+// (admin-only)
+func (c *AssetController) RestoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	assetID, err := uuid.Parse(r.URL.Query().Get("assetId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+
+	asset, err := c.AssetService.RestoreAsset(assetID, authentication.GetActor(r.Context()))
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	etag.Set(w, asset.Base().Version)
+	errors.WriteJSON(w, http.StatusOK, asset)
+}
+
+// (admin-only)
+func (c *AssetController) PurgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	assetID, err := uuid.Parse(r.URL.Query().Get("assetId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+
+	// Purges right away, without waiting for the retention to pass
+	if err := c.AssetService.PurgeAsset(assetID, authentication.GetActor(r.Context())); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/authentication"
+	"favourite_assets/server/errors"
+	"favourite_assets/server/validation"
+)
+
+// (admin-only)
+func (c *AssetController) ListVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	assetID, err := uuid.Parse(r.URL.Query().Get("assetId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+
+	versions, err := c.AssetService.ListVersions(assetID)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusOK, versions)
+}
+
+// (admin-only)
+func (c *AssetController) GetVersionHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	assetID, err := uuid.Parse(query.Get("assetId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+	v := &validation.Validator{}
+	number := versionNumber(v, "version", query.Get("version"))
+	if err := v.Err(); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	version, err := c.AssetService.GetVersion(assetID, number)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusOK, version)
+}
+
+// (admin-only)
+func (c *AssetController) DiffVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	assetID, err := uuid.Parse(query.Get("assetId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+	v := &validation.Validator{}
+	from := versionNumber(v, "from", query.Get("from"))
+	to := versionNumber(v, "to", query.Get("to"))
+	if err := v.Err(); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	diff, err := c.AssetService.DiffVersions(assetID, from, to)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusOK, diff)
+}
+
+// (admin-only)
+func (c *AssetController) RestoreVersionHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	assetID, err := uuid.Parse(query.Get("assetId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+	v := &validation.Validator{}
+	number := versionNumber(v, "version", query.Get("version"))
+	if err := v.Err(); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	actor := authentication.GetActor(r.Context())
+	version, err := c.AssetService.RestoreVersion(assetID, number, actor)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusCreated, version)
+}
+
+// versionNumber parses a required version number query parameter
+func versionNumber(v *validation.Validator, field, value string) int {
+	if !v.Required(field, value) {
+		return 0
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		v.Add(field, "must be a version number from 1")
+		return 0
+	}
+	return number
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/authentication"
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+	"favourite_assets/server/paging"
+	"favourite_assets/server/services"
+	"favourite_assets/server/validation"
+)
+
+type AuditController struct {
+	AuditLog *services.AuditLog
+}
+
+func NewAuditController(auditLog *services.AuditLog) *AuditController {
+	return &AuditController{
+		AuditLog: auditLog,
+	}
+}
+
+var auditTargetTypes = []string{models.TargetUser, models.TargetAsset, models.TargetFavourite, models.TargetCollection}
+
+// auditFilter reads the actor, targetType, targetId, from and to query
+// parameters; from and to are RFC 3339 times
+func auditFilter(query url.Values) (models.AuditFilter, error) {
+	v := &validation.Validator{}
+	filter := models.AuditFilter{Actor: query.Get("actor")}
+
+	if targetType := query.Get("targetType"); targetType != "" && v.OneOf("targetType", targetType, auditTargetTypes) {
+		filter.TargetType = targetType
+	}
+	if targetID := query.Get("targetId"); targetID != "" {
+		id, err := uuid.Parse(targetID)
+		if err != nil {
+			v.Add("targetId", "must be a UUID")
+		}
+		filter.TargetID = id
+	}
+	filter.From = auditTime(v, "from", query.Get("from"))
+	filter.To = auditTime(v, "to", query.Get("to"))
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		v.Add("to", "must be after from")
+	}
+
+	return filter, v.Err()
+}
+
+func auditTime(v *validation.Validator, field, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		v.Add(field, "must be an RFC 3339 time")
+	}
+	return t
+}
+
+// (admin-only)
+func (c *AuditController) ListAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+	page, err := paging.Parse(r.URL.Query(), services.AuditSorts)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	entries, next, err := c.AuditLog.Query(filter, page)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+	paging.SetLink(w, r, next)
+	errors.WriteJSON(w, http.StatusOK, entries)
+}
+
+// (admin-only)
+func (c *AuditController) ExportAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	entries, err := c.AuditLog.Export(filter)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	// One entry per line, oldest first
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"favourite_assets/server/authentication"
+	"favourite_assets/server/errors"
+	"favourite_assets/server/services"
+	"favourite_assets/server/validation"
+
+	"github.com/google/uuid"
+)
+
+type CollectionController struct {
+	CollectionService *services.CollectionService
+}
+
+func NewCollectionController(collectionService *services.CollectionService) *CollectionController {
+	return &CollectionController{
+		CollectionService: collectionService,
+	}
+}
+
+type collectionRequest struct {
+	Name string `json:"name"`
+}
+
+// collectionParams reads the caller and the "collectionId" query parameter
+func collectionParams(r *http.Request) (userID, collectionID uuid.UUID, err error) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		return uuid.Nil, uuid.Nil, errors.ErrUnauthorized
+	}
+
+	userID, err = currentUser(r)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	collectionID, err = uuid.Parse(r.URL.Query().Get("collectionId"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, errors.ErrBadRequest
+	}
+	return userID, collectionID, nil
+}
+
+// (all-roles)
+func (c *CollectionController) CreateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	userID, err := currentUser(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
+	var req collectionRequest
+	if err := validation.DecodeStrict(r.Body, &req); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	collection, err := c.CollectionService.CreateCollection(userID, req.Name, authentication.GetActor(r.Context()))
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusCreated, collection)
+}
+
+// (all-roles)
+func (c *CollectionController) ListCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	userID, err := currentUser(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
+	collections, err := c.CollectionService.ListCollections(userID)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusOK, collections)
+}
+
+// (all-roles)
+func (c *CollectionController) GetCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, collectionID, err := collectionParams(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
+	collection, err := c.CollectionService.GetCollection(collectionID, userID, expandAsset(r))
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusOK, collection)
+}
+
+// (all-roles)
+func (c *CollectionController) RenameCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, collectionID, err := collectionParams(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
+	var req collectionRequest
+	if err := validation.DecodeStrict(r.Body, &req); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	collection, err := c.CollectionService.RenameCollection(collectionID, userID, req.Name, authentication.GetActor(r.Context()))
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusOK, collection)
+}
+
+// (all-roles)
+func (c *CollectionController) DeleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, collectionID, err := collectionParams(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
+	if err := c.CollectionService.DeleteCollection(collectionID, userID, authentication.GetActor(r.Context())); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// (all-roles)
+func (c *CollectionController) AddItemHandler(w http.ResponseWriter, r *http.Request) {
+	userID, collectionID, err := collectionParams(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
+	favID, err := uuid.Parse(r.URL.Query().Get("favouriteId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+
+	// Appended at the end unless a position is given
+	position := -1
+	if p := r.URL.Query().Get("position"); p != "" {
+		position, err = strconv.Atoi(p)
+		if err != nil || position < 0 {
+			errors.WriteError(w, errors.ErrBadRequest)
+			return
+		}
+	}
+
+	collection, err := c.CollectionService.AddFavourite(collectionID, userID, favID, position, authentication.GetActor(r.Context()))
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusOK, collection)
+}
+
+// (all-roles)
+func (c *CollectionController) RemoveItemHandler(w http.ResponseWriter, r *http.Request) {
+	userID, collectionID, err := collectionParams(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
+	favID, err := uuid.Parse(r.URL.Query().Get("favouriteId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+
+	collection, err := c.CollectionService.RemoveFavourite(collectionID, userID, favID, authentication.GetActor(r.Context()))
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusOK, collection)
+}
+
+// (all-roles)
+func (c *CollectionController) ReorderItemsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, collectionID, err := collectionParams(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
+	var req struct {
+		FavouriteIDs []uuid.UUID `json:"favouriteIds"`
+	}
+	if err := validation.DecodeStrict(r.Body, &req); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	collection, err := c.CollectionService.ReorderFavourites(collectionID, userID, req.FavouriteIDs, authentication.GetActor(r.Context()))
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusOK, collection)
+}
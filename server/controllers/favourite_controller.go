@@ -2,10 +2,13 @@ package controllers
 
 import (
 	"net/http"
+	"strings"
 
 	"favourite_assets/server/errors"
 	"favourite_assets/server/authentication"
+	"favourite_assets/server/paging"
 	"favourite_assets/server/services"
+	"favourite_assets/server/validation"
 
 	"github.com/google/uuid"
 )
@@ -20,22 +23,30 @@ func NewFavouriteController(favService *services.FavouriteService) *FavouriteCon
 	}
 }
 
-// (all-roles)
+// (all-roles, admin to act on other users)
 func (c *FavouriteController) AddFavouriteHandler(w http.ResponseWriter, r *http.Request) {
+	c.addFavourite(w, r, requestedUser)
+}
+
+// (all-roles)
+func (c *FavouriteController) AddMyFavouriteHandler(w http.ResponseWriter, r *http.Request) {
+	c.addFavourite(w, r, currentUser)
+}
+
+func (c *FavouriteController) addFavourite(w http.ResponseWriter, r *http.Request, resolve userResolver) {
 	if authentication.GetUserInfo(r.Context()) == nil {
 		errors.WriteError(w, errors.ErrUnauthorized)
 		return
 	}
 
-	userIDStr := r.URL.Query().Get("userId")
-	assetIDStr := r.URL.Query().Get("assetId")
-	if userIDStr == "" || assetIDStr == "" {
-		errors.WriteError(w, errors.ErrBadRequest)
+	userID, err := resolve(r)
+	if err != nil {
+		errors.WriteError(w, err)
 		return
 	}
 
-	userID, err := uuid.Parse(userIDStr)
-	if err != nil {
+	assetIDStr := r.URL.Query().Get("assetId")
+	if assetIDStr == "" {
 		errors.WriteError(w, errors.ErrBadRequest)
 		return
 	}
@@ -46,67 +57,113 @@ func (c *FavouriteController) AddFavouriteHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	fav, err := c.FavouriteService.AddFavourite(userID, assetID)
+	fav, err := c.FavouriteService.AddFavourite(userID, assetID, authentication.GetActor(r.Context()))
 	if err != nil {
-		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		errors.WriteJSONError(w, err)
 		return
 	}
 
 	errors.WriteJSON(w, http.StatusCreated, fav)
 }
 
-// (all-roles)
+// (all-roles, admin for other users' favourites)
 func (c *FavouriteController) RemoveFavouriteHandler(w http.ResponseWriter, r *http.Request) {
+	c.removeFavourite(w, r, isAdmin(r))
+}
+
+// (all-roles)
+func (c *FavouriteController) RemoveMyFavouriteHandler(w http.ResponseWriter, r *http.Request) {
+	c.removeFavourite(w, r, false)
+}
+
+func (c *FavouriteController) removeFavourite(w http.ResponseWriter, r *http.Request, override bool) {
 
 	if authentication.GetUserInfo(r.Context()) == nil {
 		errors.WriteError(w, errors.ErrUnauthorized)
 		return
 	}
 
+	callerID, err := currentUser(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
 	favID, err := uuid.Parse(r.URL.Query().Get("favouriteId"))
 	if err != nil {
 		errors.WriteError(w, errors.ErrBadRequest)
 		return
 	}
 
-	if err := c.FavouriteService.RemoveFavourite(favID); err != nil {
-		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	if err := c.FavouriteService.RemoveFavourite(favID, callerID, override, authentication.GetActor(r.Context())); err != nil {
+		errors.WriteJSONError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// (all-roles)
+// (all-roles, admin to list other users' favourites)
 func (c *FavouriteController) ListFavouritesHandler(w http.ResponseWriter, r *http.Request) {
+	c.listFavourites(w, r, requestedUser)
+}
+
+// (all-roles)
+func (c *FavouriteController) ListMyFavouritesHandler(w http.ResponseWriter, r *http.Request) {
+	c.listFavourites(w, r, currentUser)
+}
+
+func (c *FavouriteController) listFavourites(w http.ResponseWriter, r *http.Request, resolve userResolver) {
 
 	if authentication.GetUserInfo(r.Context()) == nil {
 		errors.WriteError(w, errors.ErrUnauthorized)
 		return
 	}
 
-	userID, err := uuid.Parse(r.URL.Query().Get("userId"))
+	userID, err := resolve(r)
 	if err != nil {
-		errors.WriteError(w, errors.ErrBadRequest)
+		errors.WriteError(w, err)
 		return
 	}
 
-	favourites, err := c.FavouriteService.ListFavouritesByUser(userID)
+	page, err := paging.Parse(r.URL.Query(), services.FavouriteSorts)
 	if err != nil {
-		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		errors.WriteJSONError(w, err)
 		return
 	}
 
+	favourites, next, err := c.FavouriteService.ListFavourites(userID, expandAsset(r), page)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	paging.SetLink(w, r, next)
 	errors.WriteJSON(w, http.StatusOK, favourites)
 }
 
-// (all-roles)
+// (all-roles, admin for other users' favourites)
 func (c *FavouriteController) GetFavouriteHandler(w http.ResponseWriter, r *http.Request) {
+	c.getFavourite(w, r, isAdmin(r))
+}
+
+// (all-roles)
+func (c *FavouriteController) GetMyFavouriteHandler(w http.ResponseWriter, r *http.Request) {
+	c.getFavourite(w, r, false)
+}
+
+func (c *FavouriteController) getFavourite(w http.ResponseWriter, r *http.Request, override bool) {
 	if authentication.GetUserInfo(r.Context()) == nil {
 		errors.WriteError(w, errors.ErrUnauthorized)
 		return
 	}
 
+	callerID, err := currentUser(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
 	favIDStr := r.URL.Query().Get("favouriteId")
 	if favIDStr == "" {
 		errors.WriteError(w, errors.ErrBadRequest)
@@ -119,11 +176,65 @@ func (c *FavouriteController) GetFavouriteHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	fav, err := c.FavouriteService.GetFavourite(favID)
+	fav, err := c.FavouriteService.GetFavourite(favID, callerID, override, expandAsset(r))
 	if err != nil {
-		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		errors.WriteJSONError(w, err)
 		return
 	}
 
 	errors.WriteJSON(w, http.StatusOK, fav)
 }
+
+// (all-roles, admin for other users' favourites)
+func (c *FavouriteController) UpdateFavouriteHandler(w http.ResponseWriter, r *http.Request) {
+	c.updateFavourite(w, r, isAdmin(r))
+}
+
+// (all-roles)
+func (c *FavouriteController) UpdateMyFavouriteHandler(w http.ResponseWriter, r *http.Request) {
+	c.updateFavourite(w, r, false)
+}
+
+func (c *FavouriteController) updateFavourite(w http.ResponseWriter, r *http.Request, override bool) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	callerID, err := currentUser(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
+	favID, err := uuid.Parse(r.URL.Query().Get("favouriteId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+
+	var req services.FavouriteNotes
+	if err := validation.DecodeStrict(r.Body, &req); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	fav, err := c.FavouriteService.UpdateFavouriteNotes(favID, callerID, override, req, authentication.GetActor(r.Context()))
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	errors.WriteJSON(w, http.StatusOK, fav)
+}
+
+// expandAsset reports whether the request asked for embedded assets
+// (?expand=asset, possibly among other comma separated values)
+func expandAsset(r *http.Request) bool {
+	for _, v := range strings.Split(r.URL.Query().Get("expand"), ",") {
+		if strings.TrimSpace(v) == "asset" {
+			return true
+		}
+	}
+	return false
+}
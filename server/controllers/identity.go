@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+
+	"favourite_assets/server/authentication"
+	"favourite_assets/server/errors"
+
+	"github.com/google/uuid"
+)
+
+// userResolver picks the user a request acts on
+type userResolver func(r *http.Request) (uuid.UUID, error)
+
+// currentUser is the local user linked to the token's "sub"
+func currentUser(r *http.Request) (uuid.UUID, error) {
+	return authentication.GetLocalUserID(r.Context())
+}
+
+// requestedUser is the "userId" query parameter, defaulting to the caller.
+// Acting on behalf of another user is admin-only.
+func requestedUser(r *http.Request) (uuid.UUID, error) {
+	callerID, err := currentUser(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userIDStr := r.URL.Query().Get("userId")
+	if userIDStr == "" {
+		return callerID, nil
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, errors.ErrBadRequest
+	}
+	if userID != callerID && !isAdmin(r) {
+		return uuid.Nil, errors.ErrForbidden
+	}
+	return userID, nil
+}
+
+func isAdmin(r *http.Request) bool {
+	return authentication.RequireRole(r.Context(), "admin") == nil
+}
@@ -7,6 +7,8 @@ import (
 
 	"favourite_assets/server/errors"
 	"favourite_assets/server/authentication"
+	"favourite_assets/server/etag"
+	"favourite_assets/server/paging"
 	"favourite_assets/server/services"
 
 	"github.com/google/uuid"
@@ -14,6 +16,8 @@ import (
 
 type UserController struct {
 	UserService *services.UserService
+	// RequireIfMatch rejects writes without an If-Match header
+	RequireIfMatch bool
 }
 
 func NewUserController(userService *services.UserService) *UserController {
@@ -40,7 +44,7 @@ func (c *UserController) CreateUserHandler(w http.ResponseWriter, r *http.Reques
 		Email string `json:"email"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errors.WriteError(w, errors.ErrBadRequest)
+		errors.WriteError(w, bodyError(err, errors.ErrBadRequest))
 		return
 	}
 
@@ -49,7 +53,7 @@ func (c *UserController) CreateUserHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	user, err := c.UserService.CreateUser(req.Name, req.Email)
+	user, err := c.UserService.CreateUser(req.Name, req.Email, authentication.GetActor(r.Context()))
 	if err != nil {
 		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
@@ -78,6 +82,36 @@ func (c *UserController) GetUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if etag.NotModified(w, r, user.Version) {
+		return
+	}
+	etag.Set(w, user.Version)
+	errors.WriteJSON(w, http.StatusOK, user)
+}
+
+// (all-roles)
+func (c *UserController) GetMeHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	userID, err := currentUser(r)
+	if err != nil {
+		errors.WriteError(w, err)
+		return
+	}
+
+	user, err := c.UserService.GetUser(userID)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	if etag.NotModified(w, r, user.Version) {
+		return
+	}
+	etag.Set(w, user.Version)
 	errors.WriteJSON(w, http.StatusOK, user)
 }
 
@@ -96,21 +130,27 @@ func (c *UserController) UpdateUserHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	ifMatch, ok := ifMatchHeader(w, r, c.RequireIfMatch)
+	if !ok {
+		return
+	}
+
 	var req struct {
 		Name  string `json:"name"`
 		Email string `json:"email"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		errors.WriteError(w, errors.ErrBadRequest)
+		errors.WriteError(w, bodyError(err, errors.ErrBadRequest))
 		return
 	}
 
-	user, err := c.UserService.UpdateUser(userID, req.Name, req.Email)
+	user, err := c.UserService.UpdateUser(userID, req.Name, req.Email, ifMatch, authentication.GetActor(r.Context()))
 	if err != nil {
-		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		errors.WriteJSONError(w, err)
 		return
 	}
 
+	etag.Set(w, user.Version)
 	errors.WriteJSON(w, http.StatusOK, user)
 }
 
@@ -133,8 +173,14 @@ func (c *UserController) DeleteUserHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := c.UserService.DeleteUser(userID); err != nil {
-		errors.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	ifMatch, ok := ifMatchHeader(w, r, c.RequireIfMatch)
+	if !ok {
+		return
+	}
+
+	actor := authentication.GetActor(r.Context())
+	if err := c.UserService.DeleteUser(userID, ifMatch, actor); err != nil {
+		errors.WriteJSONError(w, err)
 		return
 	}
 
@@ -153,6 +199,99 @@ func (c *UserController) ListUsersHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	users := c.UserService.ListUsers()
+	page, err := paging.Parse(r.URL.Query(), services.UserSorts)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	users, next, err := c.UserService.ListUsers(page)
+	if err != nil {
+		errors.WriteError(w, errors.ErrInternal)
+		return
+	}
+	paging.SetLink(w, r, next)
 	errors.WriteJSON(w, http.StatusOK, users)
 }
+
+// (admin-only)
+func (c *UserController) ListTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	page, err := paging.Parse(r.URL.Query(), services.TrashSorts)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	users, next, err := c.UserService.ListTrash(page)
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+	paging.SetLink(w, r, next)
+	errors.WriteJSON(w, http.StatusOK, users)
+}
+
+// (admin-only)
+func (c *UserController) RestoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	userID, err := uuid.Parse(r.URL.Query().Get("userId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+
+	user, err := c.UserService.RestoreUser(userID, authentication.GetActor(r.Context()))
+	if err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	etag.Set(w, user.Version)
+	errors.WriteJSON(w, http.StatusOK, user)
+}
+
+// (admin-only)
+func (c *UserController) PurgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if authentication.GetUserInfo(r.Context()) == nil {
+		errors.WriteError(w, errors.ErrUnauthorized)
+		return
+	}
+
+	if err := authentication.RequireRole(r.Context(), "admin"); err != nil {
+		errors.WriteError(w, errors.ErrForbidden)
+		return
+	}
+
+	userID, err := uuid.Parse(r.URL.Query().Get("userId"))
+	if err != nil {
+		errors.WriteError(w, errors.ErrBadRequest)
+		return
+	}
+
+	// Purges right away, without waiting for the retention to pass
+	if err := c.UserService.PurgeUser(userID, authentication.GetActor(r.Context())); err != nil {
+		errors.WriteJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
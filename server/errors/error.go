@@ -15,24 +15,67 @@ func (e *HTTPError) Error() string {
 }
 
 var (
-	ErrUnauthorized      = &HTTPError{Status: http.StatusUnauthorized, Message: "Unauthorized"}
-	ErrForbidden         = &HTTPError{Status: http.StatusForbidden, Message: "Forbidden"}
-	ErrBadRequest        = &HTTPError{Status: http.StatusBadRequest, Message: "Bad request"}
-	ErrNotFound          = &HTTPError{Status: http.StatusNotFound, Message: "Not found"}
-	ErrInternal          = &HTTPError{Status: http.StatusInternalServerError, Message: "Internal server error"}
-	ErrAssetExists       = &HTTPError{Status: http.StatusBadRequest, Message: "Asset already exists"}
-	ErrUnknownAssetType  = &HTTPError{Status: http.StatusBadRequest, Message: "Unknown asset type"}
-	ErrFavouriteExists   = &HTTPError{Status: http.StatusBadRequest, Message: "Favourite already exists"}
-	ErrFavouriteNotFound = &HTTPError{Status: http.StatusNotFound, Message: "Favourite not found"}
-	ErrUserNotFound      = &HTTPError{Status: http.StatusNotFound, Message: "User not found"}
-	ErrInvalidID         = &HTTPError{Status: http.StatusBadRequest, Message: "Invalid ID"}
-	ErrInvalidBody       = &HTTPError{Status: http.StatusBadRequest, Message: "Invalid request body"}
-	ErrAssetNotFound     = &HTTPError{Status: http.StatusNotFound, Message: "Asset not found"}
-	ErrUserExists        = &HTTPError{Status: http.StatusBadRequest, Message: "User already exists"}
-	ErrConflict          = &HTTPError{Status: http.StatusConflict, Message: "Already exists"}
-	ErrInvalidToken       = &HTTPError{Status: http.StatusBadRequest, Message: "Invalid or expired token"}
+	ErrUnauthorized         = &HTTPError{Status: http.StatusUnauthorized, Message: "Unauthorized"}
+	ErrForbidden            = &HTTPError{Status: http.StatusForbidden, Message: "Forbidden"}
+	ErrBadRequest           = &HTTPError{Status: http.StatusBadRequest, Message: "Bad request"}
+	ErrNotFound             = &HTTPError{Status: http.StatusNotFound, Message: "Not found"}
+	ErrInternal             = &HTTPError{Status: http.StatusInternalServerError, Message: "Internal server error"}
+	ErrAssetExists          = &HTTPError{Status: http.StatusBadRequest, Message: "Asset already exists"}
+	ErrUnknownAssetType     = &HTTPError{Status: http.StatusBadRequest, Message: "Unknown asset type"}
+	ErrFavouriteExists      = &HTTPError{Status: http.StatusBadRequest, Message: "Favourite already exists"}
+	ErrFavouriteNotFound    = &HTTPError{Status: http.StatusNotFound, Message: "Favourite not found"}
+	ErrUserNotFound         = &HTTPError{Status: http.StatusNotFound, Message: "User not found"}
+	ErrInvalidID            = &HTTPError{Status: http.StatusBadRequest, Message: "Invalid ID"}
+	ErrInvalidBody          = &HTTPError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	ErrAssetNotFound        = &HTTPError{Status: http.StatusNotFound, Message: "Asset not found"}
+	ErrUserExists           = &HTTPError{Status: http.StatusBadRequest, Message: "User already exists"}
+	ErrConflict             = &HTTPError{Status: http.StatusConflict, Message: "Already exists"}
+	ErrInvalidToken         = &HTTPError{Status: http.StatusUnauthorized, Message: "Invalid or expired token"}
+	ErrCollectionNotFound   = &HTTPError{Status: http.StatusNotFound, Message: "Collection not found"}
+	ErrCollectionItemExists = &HTTPError{Status: http.StatusConflict, Message: "Favourite already in collection"}
+	ErrInvalidOrder         = &HTTPError{Status: http.StatusBadRequest, Message: "Order must list every favourite of the collection exactly once"}
+	ErrFavouriteDuplicate   = &HTTPError{Status: http.StatusConflict, Message: "Asset is already a favourite of this user"}
+	ErrUserHasFavourites    = &HTTPError{Status: http.StatusConflict, Message: "User still has favourites"}
+	ErrAssetHasFavourites   = &HTTPError{Status: http.StatusConflict, Message: "Asset is still a favourite of some users"}
+	ErrUnsupportedMediaType = &HTTPError{Status: http.StatusUnsupportedMediaType, Message: "Unsupported content type"}
+	ErrBodyTooLarge         = &HTTPError{Status: http.StatusRequestEntityTooLarge, Message: "Request body too large"}
+	ErrAssetNotRenderable   = &HTTPError{Status: http.StatusConflict, Message: "Asset type cannot be rendered"}
+	ErrUnsupportedFormat    = &HTTPError{Status: http.StatusUnsupportedMediaType, Message: "Unsupported render format, use svg or png"}
+	ErrNotAChart            = &HTTPError{Status: http.StatusConflict, Message: "Data queries only apply to charts"}
+	ErrVersionNotFound      = &HTTPError{Status: http.StatusNotFound, Message: "Asset version not found"}
+	ErrPreconditionFailed   = &HTTPError{Status: http.StatusPreconditionFailed, Message: "Modified since it was read, fetch it again and retry"}
+	ErrPreconditionRequired = &HTTPError{Status: http.StatusPreconditionRequired, Message: "If-Match header is required"}
+	ErrAccountDeleted       = &HTTPError{Status: http.StatusForbidden, Message: "Account has been deleted"}
 )
 
+// FieldError describes one invalid field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request body
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return "Validation failed"
+}
+
+// Add records an invalid field
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// Err returns e if any field was recorded, and nil otherwise
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
 func WriteError(w http.ResponseWriter, err error) {
 	if httpErr, ok := err.(*HTTPError); ok {
 		http.Error(w, httpErr.Message, httpErr.Status)
@@ -41,6 +84,24 @@ func WriteError(w http.ResponseWriter, err error) {
 	http.Error(w, "Internal server error", http.StatusInternalServerError)
 }
 
+// WriteJSONError writes err as {"error": message}, using the status of an
+// HTTPError and 500 for anything else. A ValidationError is written with 422
+// and its invalid fields.
+func WriteJSONError(w http.ResponseWriter, err error) {
+	if validationErr, ok := err.(*ValidationError); ok {
+		WriteJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":  validationErr.Error(),
+			"fields": validationErr.Fields,
+		})
+		return
+	}
+	if httpErr, ok := err.(*HTTPError); ok {
+		WriteJSON(w, httpErr.Status, map[string]string{"error": httpErr.Message})
+		return
+	}
+	WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": ErrInternal.Message})
+}
+
 func WriteJSON(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -0,0 +1,98 @@
+// Package etag turns the version counters of stored entities into entity
+// tags, and evaluates If-Match and If-None-Match headers (RFC 9110,
+// section 13.1) against them.
+package etag
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Format returns the strong entity tag of a version
+func Format(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// Set sets the ETag header of a response
+func Set(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", Format(version))
+}
+
+// Condition is a parsed If-Match or If-None-Match header. The zero value is
+// an absent header.
+type Condition struct {
+	present bool
+	// any is set by "*", which matches every existing entity
+	any      bool
+	versions []int
+}
+
+// IfMatch parses the If-Match header of r. It uses the strong comparison,
+// so weak tags never match.
+func IfMatch(r *http.Request) Condition {
+	return parse(r.Header.Values("If-Match"), false)
+}
+
+// IfNoneMatch parses the If-None-Match header of r. It uses the weak
+// comparison, which ignores the W/ prefix.
+func IfNoneMatch(r *http.Request) Condition {
+	return parse(r.Header.Values("If-None-Match"), true)
+}
+
+func parse(headers []string, weak bool) Condition {
+	c := Condition{present: len(headers) > 0}
+	for _, header := range headers {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" {
+				c.any = true
+				continue
+			}
+			if rest, ok := strings.CutPrefix(tag, "W/"); ok {
+				if !weak {
+					continue
+				}
+				tag = rest
+			}
+			// Tags this server did not issue are kept out, they match nothing
+			if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+				continue
+			}
+			// Tags are compared as strings, so "01" is not "1"
+			if version, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil && Format(version) == tag {
+				c.versions = append(c.versions, version)
+			}
+		}
+	}
+	return c
+}
+
+// Present reports whether the header was sent
+func (c Condition) Present() bool {
+	return c.present
+}
+
+// Matches reports whether the header lists the version, or is "*"
+func (c Condition) Matches(version int) bool {
+	return c.any || slices.Contains(c.versions, version)
+}
+
+// Allows reports whether a write to an entity at version may go ahead: the
+// If-Match header is absent or matches it
+func (c Condition) Allows(version int) bool {
+	return !c.present || c.Matches(version)
+}
+
+// NotModified writes a 304 response and returns true when the If-None-Match
+// header of r matches version, which the caller then need not send again
+func NotModified(w http.ResponseWriter, r *http.Request, version int) bool {
+	c := IfNoneMatch(r)
+	if !c.Present() || !c.Matches(version) {
+		return false
+	}
+	Set(w, version)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,96 @@
+package etag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func request(name string, values ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, v := range values {
+		r.Header.Add(name, v)
+	}
+	return r
+}
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		allows  map[int]bool
+	}{
+		{"absent", nil, map[int]bool{1: true, 7: true}},
+		{"one tag", []string{`"3"`}, map[int]bool{3: true, 4: false}},
+		{"star", []string{`*`}, map[int]bool{1: true, 9: true}},
+		{"list", []string{`"1", "4" ,"6"`}, map[int]bool{1: true, 4: true, 6: true, 5: false}},
+		{"repeated headers", []string{`"1"`, `"2"`}, map[int]bool{1: true, 2: true, 3: false}},
+		{"star in a list", []string{`"1", *`}, map[int]bool{8: true}},
+
+		// If-Match compares strongly, weak tags never match
+		{"weak", []string{`W/"3"`}, map[int]bool{3: false}},
+		{"weak and strong", []string{`W/"3", "4"`}, map[int]bool{3: false, 4: true}},
+
+		// Malformed or foreign tags match nothing, the header is still there
+		{"unquoted", []string{`3`}, map[int]bool{3: false}},
+		{"half quoted", []string{`"3`}, map[int]bool{3: false}},
+		{"empty tag", []string{`""`}, map[int]bool{0: false}},
+		{"empty header", []string{``}, map[int]bool{1: false}},
+		{"not a version", []string{`"abc"`}, map[int]bool{1: false}},
+		{"leading zero", []string{`"03"`}, map[int]bool{3: false}},
+		{"sign", []string{`"+3"`}, map[int]bool{3: false}},
+	}
+	for _, tt := range tests {
+		c := IfMatch(request("If-Match", tt.headers...))
+		if c.Present() != (tt.headers != nil) {
+			t.Errorf("%s: got present %v", tt.name, c.Present())
+		}
+		for version, want := range tt.allows {
+			if got := c.Allows(version); got != want {
+				t.Errorf("%s: got %v for version %d, want %v", tt.name, got, version, want)
+			}
+		}
+	}
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		matches map[int]bool
+	}{
+		{"absent", nil, map[int]bool{1: false}},
+		{"one tag", []string{`"3"`}, map[int]bool{3: true, 4: false}},
+		{"star", []string{`*`}, map[int]bool{1: true}},
+		// If-None-Match compares weakly, W/ is ignored
+		{"weak", []string{`W/"3"`}, map[int]bool{3: true}},
+		{"list", []string{`W/"1", "2"`}, map[int]bool{1: true, 2: true, 3: false}},
+		{"malformed", []string{`W/3, "x"`}, map[int]bool{3: false}},
+	}
+	for _, tt := range tests {
+		c := IfNoneMatch(request("If-None-Match", tt.headers...))
+		for version, want := range tt.matches {
+			if got := c.Matches(version); got != want {
+				t.Errorf("%s: got %v for version %d, want %v", tt.name, got, version, want)
+			}
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	w := httptest.NewRecorder()
+	if NotModified(w, request("If-None-Match", `"2"`), 3) {
+		t.Fatal("got not modified for another version")
+	}
+	if NotModified(w, request("If-None-Match"), 3) {
+		t.Fatal("got not modified without the header")
+	}
+
+	w = httptest.NewRecorder()
+	if !NotModified(w, request("If-None-Match", `"2", W/"3"`), 3) {
+		t.Fatal("got modified, want the matching version not sent again")
+	}
+	if w.Code != http.StatusNotModified || w.Header().Get("ETag") != `"3"` || w.Body.Len() != 0 {
+		t.Errorf("got %d with ETag %q and %d bytes, want 304 with the ETag only", w.Code, w.Header().Get("ETag"), w.Body.Len())
+	}
+}
@@ -0,0 +1,153 @@
+// Package filter parses attribute filter expressions such as
+//
+//	gender = female and hoursOnSocial >= 3 and birthCountry in (GR, CY)
+//
+// against a set of typed fields, and matches records against them.
+package filter
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of a filterable field
+type Kind int
+
+const (
+	// String fields support =, != and in
+	String Kind = iota
+	// Int fields support every comparison and in
+	Int
+	// Enum fields take one of Values, which are ordered, so they support
+	// every comparison and in
+	Enum
+)
+
+// Field describes a filterable field
+type Field struct {
+	Name string
+	Kind Kind
+	// Values are the allowed values of an Enum, in order
+	Values []string
+	// Normalize checks a String value and returns its canonical form; values
+	// of records are normalized the same way before comparing
+	Normalize func(value string) (string, error)
+}
+
+// Op is a comparison operator
+type Op string
+
+const (
+	OpEq Op = "="
+	OpNe Op = "!="
+	OpLt Op = "<"
+	OpLe Op = "<="
+	OpGt Op = ">"
+	OpGe Op = ">="
+	OpIn Op = "in"
+)
+
+// Condition compares one field with one or more values
+type Condition struct {
+	Field *Field
+	Op    Op
+	// Values hold the normalized values: strings, or ints for Int fields
+	Values []any
+}
+
+// Filter is a conjunction of conditions; the zero value matches everything
+type Filter []Condition
+
+// Record gives the value of a field: a string, or an int for Int fields
+type Record func(field string) any
+
+// Match reports whether the record satisfies every condition
+func (f Filter) Match(record Record) bool {
+	for _, c := range f {
+		if !c.match(record(c.Field.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) match(value any) bool {
+	if c.Field.Kind == String && c.Field.Normalize != nil {
+		normalized, err := c.Field.Normalize(value.(string))
+		if err != nil {
+			return false
+		}
+		value = normalized
+	}
+
+	if c.Op == OpIn {
+		return slices.Contains(c.Values, value)
+	}
+	order, ok := c.Field.compare(value, c.Values[0])
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case OpEq:
+		return order == 0
+	case OpNe:
+		return order != 0
+	case OpLt:
+		return order < 0
+	case OpLe:
+		return order <= 0
+	case OpGt:
+		return order > 0
+	case OpGe:
+		return order >= 0
+	}
+	return false
+}
+
+// compare orders two values of the field; ok is false when a value is not
+// one of an Enum's
+func (f *Field) compare(a, b any) (int, bool) {
+	switch f.Kind {
+	case Int:
+		return cmp.Compare(a.(int), b.(int)), true
+	case Enum:
+		x, y := slices.Index(f.Values, a.(string)), slices.Index(f.Values, b.(string))
+		return cmp.Compare(x, y), x >= 0 && y >= 0
+	}
+	return strings.Compare(a.(string), b.(string)), true
+}
+
+// ops lists the operators each kind of field supports
+var ops = map[Kind][]Op{
+	String: {OpEq, OpNe, OpIn},
+	Int:    {OpEq, OpNe, OpLt, OpLe, OpGt, OpGe, OpIn},
+	Enum:   {OpEq, OpNe, OpLt, OpLe, OpGt, OpGe, OpIn},
+}
+
+// value checks a literal against the field's type and normalizes it
+func (f *Field) value(literal string) (any, error) {
+	switch f.Kind {
+	case Int:
+		n, err := strconv.Atoi(literal)
+		if err != nil {
+			return nil, fmt.Errorf("%s needs a whole number, got %q", f.Name, literal)
+		}
+		return n, nil
+	case Enum:
+		if !slices.Contains(f.Values, literal) {
+			return nil, fmt.Errorf("%s must be one of %s, got %q", f.Name, strings.Join(f.Values, ", "), literal)
+		}
+		return literal, nil
+	}
+	if f.Normalize != nil {
+		normalized, err := f.Normalize(literal)
+		if err != nil {
+			return nil, fmt.Errorf("%s %v, got %q", f.Name, err, literal)
+		}
+		return normalized, nil
+	}
+	return literal, nil
+}
@@ -0,0 +1,187 @@
+package filter
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var testFields = []Field{
+	{Name: "gender", Kind: String, Normalize: func(value string) (string, error) {
+		return strings.ToLower(strings.TrimSpace(value)), nil
+	}},
+	{Name: "country", Kind: String, Normalize: func(value string) (string, error) {
+		if len(value) != 2 {
+			return "", errors.New("must be a two letter code")
+		}
+		return strings.ToUpper(value), nil
+	}},
+	{Name: "size", Kind: Enum, Values: []string{"small", "medium", "large"}},
+	{Name: "hours", Kind: Int},
+	{Name: "note", Kind: String},
+}
+
+// cond is a condition written as field, op and values, for comparing
+type cond struct {
+	field  string
+	op     Op
+	values []any
+}
+
+func conds(f Filter) []cond {
+	result := make([]cond, len(f))
+	for i, c := range f {
+		result[i] = cond{c.Field.Name, c.Op, c.Values}
+	}
+	return result
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []cond
+	}{
+		{"gender = female", []cond{{"gender", OpEq, []any{"female"}}}},
+		{"gender == Female", []cond{{"gender", OpEq, []any{"female"}}}},
+		{"GENDER != male", []cond{{"gender", OpNe, []any{"male"}}}},
+		{"hours>=3", []cond{{"hours", OpGe, []any{3}}}},
+		{"hours < -2", []cond{{"hours", OpLt, []any{-2}}}},
+		{"size <= medium", []cond{{"size", OpLe, []any{"medium"}}}},
+		{"country in (gr, cy)", []cond{{"country", OpIn, []any{"GR", "CY"}}}},
+		{"country IN ('gr')", []cond{{"country", OpIn, []any{"GR"}}}},
+
+		// Quoting keeps spaces and separators in a value
+		{`note = 'a, b and c'`, []cond{{"note", OpEq, []any{"a, b and c"}}}},
+		{`note = "it's (fine)"`, []cond{{"note", OpEq, []any{"it's (fine)"}}}},
+		{`note = ''`, []cond{{"note", OpEq, []any{""}}}},
+
+		// Every separator joins conditions, commas inside in lists separate values
+		{
+			"gender = female and hours > 1 && size = small; note = x, hours in (1, 2)",
+			[]cond{
+				{"gender", OpEq, []any{"female"}},
+				{"hours", OpGt, []any{1}},
+				{"size", OpEq, []any{"small"}},
+				{"note", OpEq, []any{"x"}},
+				{"hours", OpIn, []any{1, 2}},
+			},
+		},
+		{
+			"country in (gr, cy), hours = 2",
+			[]cond{{"country", OpIn, []any{"GR", "CY"}}, {"hours", OpEq, []any{2}}},
+		},
+		{
+			"hours = " + strconv.Itoa(math.MinInt),
+			[]cond{{"hours", OpEq, []any{math.MinInt}}},
+		},
+	}
+	for _, tt := range tests {
+		f, err := Parse(tt.expr, testFields)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := conds(f); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{"", 1, "expected a field name at the end"},
+		{"colour = red", 1, `unknown field "colour"`},
+		{"gender", 7, "expected an operator at the end"},
+		{"gender ~ female", 8, `expected an operator, got "~"`},
+		{"gender & female", 8, `unexpected '&'`},
+		{"gender like female", 8, `expected an operator, got "like"`},
+		{"gender > female", 8, "gender does not support >, use =, !=, in"},
+		{"gender =", 9, "expected a value at the end"},
+		{"gender = female male", 17, `expected "and" before "male"`},
+		{"gender = female and", 20, "expected a field name at the end"},
+		{"note = 'open", 8, "unterminated quoted value"},
+		{"hours = three", 9, `hours needs a whole number, got "three"`},
+		{"hours = 1.5", 9, `hours needs a whole number, got "1.5"`},
+		{"hours = 99999999999999999999", 9, "hours needs a whole number"},
+		{"size = huge", 8, "size must be one of small, medium, large"},
+		{"country = greece", 11, `country must be a two letter code, got "greece"`},
+		{"country in gr", 12, `expected "(", got "gr"`},
+		{"country in (gr cy)", 16, `expected "," or ")", got "cy"`},
+		{"country in (gr,", 16, "expected a value at the end"},
+		{"country in ()", 13, `expected a value, got ")"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.expr, testFields)
+		var filterErr *Error
+		if !errors.As(err, &filterErr) {
+			t.Errorf("%q: got %v, want a filter error", tt.expr, err)
+			continue
+		}
+		if filterErr.Pos != tt.pos || !strings.Contains(filterErr.Msg, tt.msg) {
+			t.Errorf("%q: got %q at %d, want %q at %d", tt.expr, filterErr.Msg, filterErr.Pos, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	record := func(values map[string]any) Record {
+		return func(field string) any { return values[field] }
+	}
+	ada := record(map[string]any{"gender": " Female", "country": "gr", "size": "medium", "hours": 3, "note": "x"})
+	odd := record(map[string]any{"gender": "male", "country": "greece", "size": "unknown", "hours": math.MinInt, "note": ""})
+
+	tests := []struct {
+		expr     string
+		ada, odd bool
+	}{
+		{"", true, true},
+		{"gender = female", true, false},
+		{"gender != female", false, true},
+		{"country = GR", true, false},
+		{"country in (cy, gr)", true, false},
+		{"hours = 3", true, false},
+		{"hours in (1, 3)", true, false},
+		{"hours > 2", true, false},
+		{"hours >= 3", true, false},
+		{"hours < 3", false, true},
+		{"hours <= 3", true, true},
+
+		// Extreme values compare without overflowing
+		{"hours > " + strconv.Itoa(math.MinInt), true, false},
+		{"hours >= " + strconv.Itoa(math.MinInt), true, true},
+		{"hours < " + strconv.Itoa(math.MaxInt), true, true},
+		{"hours > -9223372036854775807", true, false},
+
+		// Enums follow the order of their values; unknown ones match nothing
+		{"size > small", true, false},
+		{"size < large", true, false},
+		{"size != large", true, false},
+		{"size in (medium)", true, false},
+
+		{"gender = female and hours > 5", false, false},
+		{"gender = female and hours > 2", true, false},
+	}
+	for _, tt := range tests {
+		var f Filter
+		if tt.expr != "" {
+			var err error
+			if f, err = Parse(tt.expr, testFields); err != nil {
+				t.Errorf("%s: %v", tt.expr, err)
+				continue
+			}
+		}
+		if got := f.Match(ada); got != tt.ada {
+			t.Errorf("%s: got %v for ada, want %v", tt.expr, got, tt.ada)
+		}
+		if got := f.Match(odd); got != tt.odd {
+			t.Errorf("%s: got %v for odd, want %v", tt.expr, got, tt.odd)
+		}
+	}
+}
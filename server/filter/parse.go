@@ -0,0 +1,249 @@
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Error is a filter expression that cannot be parsed or does not fit the
+// fields. Pos is the 1-based position of the offending token.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (at position %d)", e.Msg, e.Pos)
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokAnd
+	tokEOF
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// special are the characters that end a bare word
+const special = "()=!<>,;&'\""
+
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		two := ""
+		if i+1 < len(runes) {
+			two = string(runes[i : i+2])
+		}
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", pos})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokComma, ",", pos})
+			i++
+		case r == ';':
+			tokens = append(tokens, token{tokAnd, ";", pos})
+			i++
+		case two == "&&":
+			tokens = append(tokens, token{tokAnd, "&&", pos})
+			i += 2
+		case two == "==":
+			tokens = append(tokens, token{tokOp, string(OpEq), pos})
+			i += 2
+		case two == "!=", two == ">=", two == "<=":
+			tokens = append(tokens, token{tokOp, two, pos})
+			i += 2
+		case r == '=', r == '<', r == '>':
+			tokens = append(tokens, token{tokOp, string(r), pos})
+			i++
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &Error{pos, "unterminated quoted value"}
+			}
+			tokens = append(tokens, token{tokString, string(runes[i+1 : end]), pos})
+			i = end + 1
+		case strings.ContainsRune(special, r):
+			return nil, &Error{pos, fmt.Sprintf("unexpected %q", r)}
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(special, runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			if strings.EqualFold(word, "and") {
+				tokens = append(tokens, token{tokAnd, word, pos})
+			} else {
+				tokens = append(tokens, token{tokWord, word, pos})
+			}
+			i = end
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(runes) + 1}), nil
+}
+
+type parser struct {
+	tokens []token
+	fields []Field
+	i      int
+}
+
+// Parse parses a conjunction of conditions joined by "and", "&&", ";" or ",".
+// A condition is a field name, an operator (=, ==, !=, <, <=, >, >= or in)
+// and a value, or a parenthesized list of values for in. Values may be
+// quoted with ' or ".
+func Parse(expr string, fields []Field) (Filter, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, fields: fields}
+
+	var f Filter
+	for {
+		c, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		f = append(f, c)
+
+		t := p.next()
+		if t.kind == tokEOF {
+			return f, nil
+		}
+		if t.kind != tokAnd && t.kind != tokComma {
+			return nil, &Error{t.pos, fmt.Sprintf("expected \"and\" before %q", t.text)}
+		}
+	}
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) condition() (Condition, error) {
+	t := p.next()
+	if t.kind != tokWord {
+		return Condition{}, p.unexpected(t, "a field name")
+	}
+	field := p.field(t.text)
+	if field == nil {
+		return Condition{}, &Error{t.pos, fmt.Sprintf("unknown field %q, filterable fields are %s", t.text, p.names())}
+	}
+
+	t = p.next()
+	var op Op
+	switch {
+	case t.kind == tokOp:
+		op = Op(t.text)
+	case t.kind == tokWord && strings.EqualFold(t.text, string(OpIn)):
+		op = OpIn
+	default:
+		return Condition{}, p.unexpected(t, "an operator")
+	}
+	if !slices.Contains(ops[field.Kind], op) {
+		return Condition{}, &Error{t.pos, fmt.Sprintf("%s does not support %s, use %s", field.Name, op, opNames(ops[field.Kind]))}
+	}
+
+	c := Condition{Field: field, Op: op}
+	if op != OpIn {
+		value, err := p.value(field)
+		if err != nil {
+			return Condition{}, err
+		}
+		c.Values = []any{value}
+		return c, nil
+	}
+
+	if t := p.next(); t.kind != tokLParen {
+		return Condition{}, p.unexpected(t, "\"(\"")
+	}
+	for {
+		value, err := p.value(field)
+		if err != nil {
+			return Condition{}, err
+		}
+		c.Values = append(c.Values, value)
+
+		t := p.next()
+		if t.kind == tokRParen {
+			return c, nil
+		}
+		if t.kind != tokComma {
+			return Condition{}, p.unexpected(t, "\",\" or \")\"")
+		}
+	}
+}
+
+func (p *parser) value(field *Field) (any, error) {
+	t := p.next()
+	if t.kind != tokWord && t.kind != tokString {
+		return nil, p.unexpected(t, "a value")
+	}
+	value, err := field.value(t.text)
+	if err != nil {
+		return nil, &Error{t.pos, err.Error()}
+	}
+	return value, nil
+}
+
+func (p *parser) field(name string) *Field {
+	for i := range p.fields {
+		if strings.EqualFold(p.fields[i].Name, name) {
+			return &p.fields[i]
+		}
+	}
+	return nil
+}
+
+func (p *parser) names() string {
+	names := make([]string, len(p.fields))
+	for i, f := range p.fields {
+		names[i] = f.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func (p *parser) unexpected(t token, want string) error {
+	if t.kind == tokEOF {
+		return &Error{t.pos, "expected " + want + " at the end"}
+	}
+	return &Error{t.pos, fmt.Sprintf("expected %s, got %q", want, t.text)}
+}
+
+func opNames(list []Op) string {
+	names := make([]string, len(list))
+	for i, op := range list {
+		names[i] = string(op)
+	}
+	return strings.Join(names, ", ")
+}
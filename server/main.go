@@ -1,49 +1,133 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
 	"favourite_assets/server/authentication"
+	"favourite_assets/server/config"
 	"favourite_assets/server/controllers"
+	"favourite_assets/server/models"
 	"favourite_assets/server/repositories"
 	"favourite_assets/server/routes"
 	"favourite_assets/server/services"
 )
 
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	userDeletePolicy, err := services.ParseUserDeletePolicy(cfg.Integrity.UserDeletePolicy)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	assetDeletePolicy, err := services.ParseAssetDeletePolicy(cfg.Integrity.AssetDeletePolicy)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	chartLimits := models.ChartLimits{
+		MaxSeries: cfg.Charts.MaxSeries,
+		MaxPoints: cfg.Charts.MaxPoints,
+	}
+	models.SetChartLimits(chartLimits)
+
 	// --- Initialize repositories ---
-	userRepo := repositories.NewUserRepository()
-	assetRepo := repositories.NewAssetRepository()
-	favRepo := repositories.NewFavoriteRepository()
+	store, err := openStore(cfg.Storage)
+	if err != nil {
+		log.Fatalf("storage: %v", err)
+	}
+	defer store.Close()
 
 	// --- Initialize services ---
-	userService := services.NewUserService(userRepo)
-	assetService := services.NewAssetService(assetRepo)
-	favService := services.NewFavouriteService(favRepo, userService, assetService)
+	auditLog := services.NewAuditLog(store.Audit)
+	userService := services.NewUserService(store.Users, store.Favourites, store.Collections, userDeletePolicy, auditLog)
+	assetService := services.NewAssetService(store.Assets, store.AssetVersions, store.Favourites, store.Collections, assetDeletePolicy, auditLog)
+	favService := services.NewFavouriteService(store.Favourites, store.Collections, userService, assetService, auditLog)
+	collectionService := services.NewCollectionService(store.Collections, favService, auditLog)
+
+	purger := services.NewTrashPurger(userService, assetService, cfg.Trash.Retention)
+	purger.Start(cfg.Trash.PurgeInterval)
+	defer purger.Stop()
 
 	// --- Initialize Keycloak service ---
-	keycloakService := services.NewKeycloakService()
+	keycloakService := services.NewKeycloakService(cfg.Keycloak)
 
 	// --- Initialize controllers ---
 	userController := controllers.NewUserController(userService)
+	userController.RequireIfMatch = cfg.Concurrency.RequireIfMatch
 	assetController := controllers.NewAssetController(assetService)
+	assetController.RequireIfMatch = cfg.Concurrency.RequireIfMatch
 	favController := controllers.NewFavouriteController(favService)
+	collectionController := controllers.NewCollectionController(collectionService)
+	auditController := controllers.NewAuditController(auditLog)
 
 	// --- Setup router ---
 	r := chi.NewRouter()
+	// Request IDs tie audit entries to the log lines of their request
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	// The largest chart allowed bounds every body, so none is read whole
+	// into memory before its size is checked
+	r.Use(middleware.RequestSize(chartLimits.MaxRequestBytes()))
 
 	// --- Register routes ---
-	routes.RegisterRoutes(r, userController, assetController, favController, authentication.KeycloakAuth(keycloakService))
+	routes.RegisterRoutes(r, userController, assetController, favController, collectionController, auditController,
+		authentication.KeycloakAuth(keycloakService),
+		authentication.ProvisionUser(userService, cfg.Keycloak.Issuer),
+	)
 
 	// --- Start server ---
-	log.Println("Server running on http://localhost:8080")
-	if err := http.ListenAndServe(":8080", r); err != nil {
-		log.Fatal(err)
+	srv := &http.Server{Addr: cfg.Addr, Handler: r}
+	go func() {
+		log.Printf("Server running on %s", cfg.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// --- Shut down gracefully so the store can flush ---
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+}
+
+// openStore selects the persistence backend from the configuration
+func openStore(cfg config.StorageConfig) (*repositories.Store, error) {
+	switch cfg.Backend {
+	case "memory":
+		if cfg.WALDir != "" {
+			return repositories.OpenJournaledStore(cfg.WALDir, repositories.JournalOptions{
+				SyncWrites:       cfg.WALSync,
+				SnapshotInterval: cfg.SnapshotInterval,
+			})
+		}
+		return repositories.NewMemoryStore(), nil
+	case repositories.DialectPostgres, repositories.DialectSQLite:
+		if cfg.DSN == "" {
+			return nil, fmt.Errorf("DATABASE_URL is required for the %s backend", cfg.Backend)
+		}
+		return repositories.OpenSQLStore(cfg.Backend, cfg.DSN, repositories.SQLOptions{
+			ReindexInterval: cfg.SearchReindexInterval,
+		})
 	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
 }
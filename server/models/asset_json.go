@@ -0,0 +1,123 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"favourite_assets/server/errors"
+)
+
+// Assets are encoded with a "type" member so they can be decoded back into
+// the right struct: every asset type implements MarshalJSON with
+// marshalAsset, and DecodeAsset dispatches on the member through the registry.
+
+// marshalAsset encodes v, the asset without its methods, and prepends the type
+func marshalAsset(t AssetType, v any) ([]byte, error) {
+	fields, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	typeValue, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"type":`)
+	buf.Write(typeValue)
+	if rest := bytes.TrimPrefix(fields, []byte("{")); !bytes.Equal(rest, []byte("}")) {
+		buf.WriteByte(',')
+		buf.Write(rest)
+	} else {
+		buf.WriteByte('}')
+	}
+	return buf.Bytes(), nil
+}
+
+func (c Chart) MarshalJSON() ([]byte, error) {
+	type plain Chart
+	return marshalAsset(AssetChart, plain(c))
+}
+
+func (i Insight) MarshalJSON() ([]byte, error) {
+	type plain Insight
+	return marshalAsset(AssetInsight, plain(i))
+}
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	type plain Audience
+	return marshalAsset(AssetAudience, plain(a))
+}
+
+func (r Report) MarshalJSON() ([]byte, error) {
+	type plain Report
+	return marshalAsset(AssetReport, plain(r))
+}
+
+// DecodeAsset decodes an asset encoded with its "type" member
+func DecodeAsset(data []byte) (Asset, error) {
+	var header struct {
+		Type AssetType `json:"type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	asset, ok := NewAsset(header.Type)
+	if !ok {
+		return nil, errors.ErrUnknownAssetType
+	}
+	if err := json.Unmarshal(data, asset); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// AssetList is a list of assets of any type that can be decoded from JSON
+type AssetList []Asset
+
+func (l *AssetList) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	if items == nil {
+		*l = nil
+		return nil
+	}
+
+	list := make(AssetList, len(items))
+	for i, item := range items {
+		asset, err := DecodeAsset(item)
+		if err != nil {
+			return err
+		}
+		list[i] = asset
+	}
+	*l = list
+	return nil
+}
+
+// UnmarshalJSON decodes the embedded asset, if any, into its concrete type
+func (f *Favourite) UnmarshalJSON(data []byte) error {
+	type plain Favourite
+	aux := struct {
+		*plain
+		// Shadows plain.Asset, which as an interface cannot be decoded
+		Asset json.RawMessage `json:"asset"`
+	}{plain: (*plain)(f)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	f.Asset = nil
+	if len(aux.Asset) > 0 && !bytes.Equal(aux.Asset, []byte("null")) {
+		asset, err := DecodeAsset(aux.Asset)
+		if err != nil {
+			return err
+		}
+		f.Asset = asset
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"favourite_assets/server/validation"
+)
+
+// AgeGroups are the audience age buckets
+var AgeGroups = []string{"16-24", "25-34", "35-44", "45-54", "55-64", "65+"}
+
+const maxHoursOnSocial = 24
+
+func init() {
+	RegisterAssetKind(AssetKind{
+		Type:   AssetChart,
+		New:    func() Asset { return &Chart{} },
+		Decode: func(body []byte) (Asset, error) { return decodeAssetRequest(body, &createChartRequest{}) },
+		Validate: func(asset Asset, v *validation.Validator) {
+			validateChart(asset.(*Chart), v)
+		},
+	})
+
+	RegisterAssetKind(AssetKind{
+		Type:   AssetInsight,
+		New:    func() Asset { return &Insight{} },
+		Decode: func(body []byte) (Asset, error) { return decodeAssetRequest(body, &createInsightRequest{}) },
+		Validate: func(asset Asset, v *validation.Validator) {
+			v.Required("text", asset.(*Insight).Text)
+		},
+	})
+
+	RegisterAssetKind(AssetKind{
+		Type:   AssetAudience,
+		New:    func() Asset { return &Audience{} },
+		Decode: func(body []byte) (Asset, error) { return decodeAssetRequest(body, &createAudienceRequest{}) },
+		Validate: func(asset Asset, v *validation.Validator) {
+			audience := asset.(*Audience)
+			v.Required("gender", audience.Gender)
+			if v.Required("birthCountry", audience.BirthCountry) {
+				v.CountryCode("birthCountry", audience.BirthCountry)
+			}
+			if v.Required("ageGroup", audience.AgeGroup) {
+				v.OneOf("ageGroup", audience.AgeGroup, AgeGroups)
+			}
+			v.Range("hoursOnSocial", audience.HoursOnSocial, 0, maxHoursOnSocial)
+			v.NonNegative("purchasesLastMonth", audience.PurchasesLastMonth)
+		},
+	})
+}
+
+type createChartRequest struct {
+	serverFields
+	Type        string        `json:"type"`
+	Description string        `json:"description"`
+	Title       string        `json:"title"`
+	XAxis       string        `json:"xAxis"`
+	YAxis       string        `json:"yAxis"`
+	XAxisType   ChartAxisType `json:"xAxisType"`
+	Data        [][2]any      `json:"data"`
+	Series      []ChartSeries `json:"series"`
+}
+
+func (r *createChartRequest) asset() Asset {
+	return &Chart{
+		BaseAsset: BaseAsset{Description: r.Description},
+		Title:     r.Title,
+		XAxis:     r.XAxis,
+		YAxis:     r.YAxis,
+		XAxisType: r.XAxisType,
+		Data:      r.Data,
+		Series:    r.Series,
+	}
+}
+
+type createInsightRequest struct {
+	serverFields
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Text        string `json:"text"`
+}
+
+func (r *createInsightRequest) asset() Asset {
+	return &Insight{
+		BaseAsset: BaseAsset{Description: r.Description},
+		Text:      r.Text,
+	}
+}
+
+type createAudienceRequest struct {
+	serverFields
+	Type               string `json:"type"`
+	Description        string `json:"description"`
+	Gender             string `json:"gender"`
+	BirthCountry       string `json:"birthCountry"`
+	AgeGroup           string `json:"ageGroup"`
+	HoursOnSocial      *int   `json:"hoursOnSocial"`
+	PurchasesLastMonth int    `json:"purchasesLastMonth"`
+
+	// HoursSocialDaily is the name older clients send for HoursOnSocial
+	HoursSocialDaily *int `json:"hoursSocialDaily"`
+}
+
+// check requires hoursOnSocial, which would otherwise default to 0
+func (r *createAudienceRequest) check(v *validation.Validator) {
+	if r.HoursOnSocial == nil && r.HoursSocialDaily == nil {
+		v.Add("hoursOnSocial", "is required")
+	}
+}
+
+func (r *createAudienceRequest) asset() Asset {
+	hours := r.HoursOnSocial
+	if hours == nil {
+		hours = r.HoursSocialDaily
+	}
+
+	audience := &Audience{
+		BaseAsset:          BaseAsset{Description: r.Description},
+		Gender:             r.Gender,
+		BirthCountry:       r.BirthCountry,
+		AgeGroup:           r.AgeGroup,
+		PurchasesLastMonth: r.PurchasesLastMonth,
+	}
+	if hours != nil {
+		audience.HoursOnSocial = *hours
+	}
+	return audience
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"favourite_assets/server/errors"
+)
+
+func TestDecodeAudienceHoursOnSocial(t *testing.T) {
+	kind, _ := LookupAssetKind(AssetAudience)
+
+	for name, body := range map[string]string{
+		"current name": `{"type": "audience", "gender": "female", "birthCountry": "GR", "ageGroup": "25-34", "hoursOnSocial": 0}`,
+		"older name":   `{"type": "audience", "gender": "female", "birthCountry": "GR", "ageGroup": "25-34", "hoursSocialDaily": 0}`,
+	} {
+		if _, err := kind.Decode([]byte(body)); err != nil {
+			t.Errorf("%s: got %v, want 0 hours accepted", name, err)
+		}
+	}
+
+	// Left out, it is reported along with the other invalid fields
+	_, err := kind.Decode([]byte(`{"type": "audience", "gender": "female", "birthCountry": "GR"}`))
+	validationErr, ok := err.(*errors.ValidationError)
+	if !ok {
+		t.Fatalf("got %v, want a ValidationError", err)
+	}
+	fields := map[string]string{}
+	for _, f := range validationErr.Fields {
+		fields[f.Field] = f.Message
+	}
+	if fields["hoursOnSocial"] != "is required" || fields["ageGroup"] != "is required" || len(fields) != 2 {
+		t.Errorf("got %+v, want hoursOnSocial and ageGroup required", validationErr.Fields)
+	}
+}
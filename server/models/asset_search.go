@@ -0,0 +1,49 @@
+package models
+
+import "favourite_assets/server/search"
+
+// Weights of asset text in search results
+const (
+	searchWeightTitle   = 3
+	searchWeightHeading = 2
+	searchWeightText    = 1
+)
+
+// AssetSearchFields returns the text of an asset that search indexes: its
+// description, and the fields of types with a SearchFields method
+func AssetSearchFields(asset Asset) []search.Field {
+	fields := []search.Field{{Name: "description", Text: asset.GetDescription(), Weight: searchWeightText}}
+	if searchable, ok := asset.(interface{ SearchFields() []search.Field }); ok {
+		fields = append(fields, searchable.SearchFields()...)
+	}
+	return fields
+}
+
+func (c *Chart) SearchFields() []search.Field {
+	fields := []search.Field{
+		{Name: "title", Text: c.Title, Weight: searchWeightTitle},
+		{Name: "xAxis", Text: c.XAxis, Weight: searchWeightText},
+		{Name: "yAxis", Text: c.YAxis, Weight: searchWeightText},
+	}
+	for _, s := range c.Series {
+		fields = append(fields, search.Field{Name: "series", Text: s.Name, Weight: searchWeightText})
+	}
+	return fields
+}
+
+func (i *Insight) SearchFields() []search.Field {
+	return []search.Field{{Name: "text", Text: i.Text, Weight: searchWeightText}}
+}
+
+func (r *Report) SearchFields() []search.Field {
+	fields := []search.Field{
+		{Name: "title", Text: r.Title, Weight: searchWeightTitle},
+		{Name: "summary", Text: r.Summary, Weight: searchWeightHeading},
+	}
+	for _, s := range r.Sections {
+		fields = append(fields,
+			search.Field{Name: "heading", Text: s.Heading, Weight: searchWeightHeading},
+			search.Field{Name: "body", Text: s.Body, Weight: searchWeightText})
+	}
+	return fields
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AssetVersion is an immutable snapshot of an asset, recorded at creation and
+// at every later write. Versions of an asset are numbered from 1.
+type AssetVersion struct {
+	ID      uuid.UUID `json:"id"`
+	AssetID uuid.UUID `json:"assetId"`
+	Version int       `json:"version"`
+	// Author is the token subject of the caller who made the change, empty
+	// for states recorded without one
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+	// RestoredFrom is the version this one brought back, if any
+	RestoredFrom int   `json:"restoredFrom,omitempty"`
+	Asset        Asset `json:"asset"`
+}
+
+// UnmarshalJSON decodes the snapshot into its concrete type
+func (v *AssetVersion) UnmarshalJSON(data []byte) error {
+	type plain AssetVersion
+	aux := struct {
+		*plain
+		// Shadows plain.Asset, which as an interface cannot be decoded
+		Asset json.RawMessage `json:"asset"`
+	}{plain: (*plain)(v)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	asset, err := DecodeAsset(aux.Asset)
+	if err != nil {
+		return err
+	}
+	v.Asset = asset
+	return nil
+}
+
+// FieldChange is a field that differs between two versions of an asset.
+// Nested fields are joined with dots; lists are compared as a whole.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// DiffAssets lists the fields that differ between two assets, by name. A
+// field missing on one side is reported with a null value.
+func DiffAssets(from, to Asset) ([]FieldChange, error) {
+	before, err := flattenAsset(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := flattenAsset(to)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+
+	changes := []FieldChange{}
+	for name := range names {
+		a, b := before[name], after[name]
+		if bytes.Equal(a, b) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: name, From: rawValue(a), To: rawValue(b)})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// flattenAsset encodes an asset and maps each leaf field path to its JSON
+func flattenAsset(asset Asset) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(asset)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	return fields, flatten("", data, fields)
+}
+
+func flatten(prefix string, data json.RawMessage, fields map[string]json.RawMessage) error {
+	var object map[string]json.RawMessage
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		if err := json.Unmarshal(data, &object); err != nil {
+			return err
+		}
+	}
+	if object == nil {
+		fields[prefix] = data
+		return nil
+	}
+	for name, value := range object {
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if err := flatten(name, value, fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rawValue(data json.RawMessage) any {
+	if data == nil {
+		return nil
+	}
+	return data
+}
+
+// CloneAsset returns a deep copy of an asset
+func CloneAsset(asset Asset) (Asset, error) {
+	data, err := json.Marshal(asset)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeAsset(data)
+}
+
+// AssetVersionDiff lists the fields that changed between two versions
+type AssetVersionDiff struct {
+	AssetID uuid.UUID     `json:"assetId"`
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
@@ -19,6 +19,7 @@ type Asset interface {
 	GetDescription() string
 	SetDescription(desc string)
 	GetType() AssetType
+	Base() *BaseAsset
 }
 
 type BaseAsset struct {
@@ -26,21 +27,41 @@ type BaseAsset struct {
 	Description string    `json:"description"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
+	// Version counts the writes to the asset, from 1; it is the number of
+	// its latest AssetVersion and its entity tag
+	Version int `json:"version"`
+	// DeletedAt and DeletedBy (a token subject) are set while the asset is
+	// in the trash
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	DeletedBy string     `json:"deletedBy,omitempty"`
 }
 
 func (b *BaseAsset) GetID() uuid.UUID           { return b.ID }
 func (b *BaseAsset) GetDescription() string     { return b.Description }
 func (b *BaseAsset) SetDescription(desc string) { b.Description = desc }
+func (b *BaseAsset) Base() *BaseAsset           { return b }
 
 type Chart struct {
 	BaseAsset
-	Title string   `json:"title"`
-	XAxis string   `json:"xAxis"`
-	YAxis string   `json:"yAxis"`
-	Data  [][2]any `json:"data"` 
+	Title     string        `json:"title"`
+	XAxis     string        `json:"xAxis"`
+	YAxis     string        `json:"yAxis"`
+	XAxisType ChartAxisType `json:"xAxisType,omitempty"`
+	// Data is a single unnamed series of [x, y] points
+	Data   [][2]any      `json:"data"`
+	Series []ChartSeries `json:"series,omitempty"`
 }
 
 func (c *Chart) GetType() AssetType { return AssetChart }
+func (c *Chart) GetTitle() string    { return c.Title }
+
+// AssetTitle returns the title of asset types that have one, "" otherwise
+func AssetTitle(asset Asset) string {
+	if titled, ok := asset.(interface{ GetTitle() string }); ok {
+		return titled.GetTitle()
+	}
+	return ""
+}
 
 type Insight struct {
 	BaseAsset
@@ -66,5 +87,13 @@ type Favourite struct {
 	AssetID   uuid.UUID  `json:"assetId"`
 	AssetType AssetType  `json:"assetType"` 
 	Asset     Asset      `json:"asset,omitempty"`
-	CreatedAt time.Time  `json:"createdAt"`
+	// AssetDescription is the asset's own description, next to the user's
+	AssetDescription string `json:"assetDescription,omitempty"`
+	// AssetUnavailable is set when the favourite's asset no longer exists
+	AssetUnavailable bool `json:"assetUnavailable,omitempty"`
+	// CustomDescription and Notes are the user's own annotations
+	CustomDescription string    `json:"customDescription,omitempty"`
+	Notes             string    `json:"notes,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
 }
@@ -0,0 +1,48 @@
+package models
+
+import (
+	stderrors "errors"
+	"strings"
+
+	"favourite_assets/server/filter"
+	"favourite_assets/server/validation"
+)
+
+// AudienceFilterFields are the audience attributes assets can be filtered by
+var AudienceFilterFields = []filter.Field{
+	{Name: "gender", Kind: filter.String, Normalize: normalizeGender},
+	{Name: "birthCountry", Kind: filter.String, Normalize: normalizeCountry},
+	{Name: "ageGroup", Kind: filter.Enum, Values: AgeGroups},
+	{Name: "hoursOnSocial", Kind: filter.Int},
+	{Name: "purchasesLastMonth", Kind: filter.Int},
+}
+
+// FilterValue returns the value of one of AudienceFilterFields
+func (a *Audience) FilterValue(field string) any {
+	switch field {
+	case "gender":
+		return a.Gender
+	case "birthCountry":
+		return a.BirthCountry
+	case "ageGroup":
+		return a.AgeGroup
+	case "hoursOnSocial":
+		return a.HoursOnSocial
+	case "purchasesLastMonth":
+		return a.PurchasesLastMonth
+	}
+	return nil
+}
+
+func normalizeGender(value string) (string, error) {
+	return strings.ToLower(strings.TrimSpace(value)), nil
+}
+
+// normalizeCountry lets alpha-2 and alpha-3 codes of a country match
+func normalizeCountry(value string) (string, error) {
+	code, ok := validation.CountryAlpha2(strings.TrimSpace(value))
+	if !ok {
+		return "", stderrors.New("must be an ISO 3166-1 alpha-2 or alpha-3 country code")
+	}
+	return code, nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actor is the caller behind a change, as taken from its token
+type Actor struct {
+	Subject  string   `json:"sub"`
+	Username string   `json:"username,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	// RequestID is the ID of the request the change was made in, empty for
+	// changes made by the server itself
+	RequestID string `json:"-"`
+}
+
+// SystemActor makes the changes the server does on its own, like purging
+// the trash
+var SystemActor = Actor{Subject: "system"}
+
+// AuditAction is what a change did to its target
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	AuditPurge   AuditAction = "purge"
+)
+
+// The types of the audited targets
+const (
+	TargetUser       = "user"
+	TargetAsset      = "asset"
+	TargetFavourite  = "favourite"
+	TargetCollection = "collection"
+)
+
+// AuditEntry records one change. Entries are never changed or deleted once
+// written. Before and After are the target as it was returned by the API,
+// left out for a target that did not exist.
+type AuditEntry struct {
+	ID         uuid.UUID       `json:"id"`
+	Time       time.Time       `json:"time"`
+	Actor      Actor           `json:"actor"`
+	Action     AuditAction     `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetID   uuid.UUID       `json:"targetId"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	RequestID  string          `json:"requestId,omitempty"`
+}
+
+// AuditFilter selects audit entries; zero fields match everything. From is
+// inclusive and To exclusive.
+type AuditFilter struct {
+	Actor      string
+	TargetType string
+	TargetID   uuid.UUID
+	From       time.Time
+	To         time.Time
+}
+
+// Match reports whether entry is selected by f
+func (f AuditFilter) Match(entry *AuditEntry) bool {
+	switch {
+	case f.Actor != "" && entry.Actor.Subject != f.Actor:
+		return false
+	case f.TargetType != "" && entry.TargetType != f.TargetType:
+		return false
+	case f.TargetID != uuid.Nil && entry.TargetID != f.TargetID:
+		return false
+	case !f.From.IsZero() && entry.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !entry.Time.Before(f.To):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"favourite_assets/server/validation"
+)
+
+// ChartAxisType is the kind of values on the X axis of a chart
+type ChartAxisType string
+
+const (
+	AxisNumber   ChartAxisType = "number"
+	AxisTime     ChartAxisType = "time"
+	AxisCategory ChartAxisType = "category"
+)
+
+var chartAxisTypes = []string{string(AxisNumber), string(AxisTime), string(AxisCategory)}
+
+// ChartSeries is a named list of [x, y] points
+type ChartSeries struct {
+	Name   string   `json:"name"`
+	Points [][2]any `json:"points"`
+}
+
+// ChartLimits bound the size of chart data
+type ChartLimits struct {
+	MaxSeries int
+	// MaxPoints is the number of points allowed across all series
+	MaxPoints int
+}
+
+// chartLimits is set once at startup, before any chart is validated
+var chartLimits = ChartLimits{MaxSeries: 20, MaxPoints: 10000}
+
+// SetChartLimits replaces the default chart limits; call it before serving
+func SetChartLimits(limits ChartLimits) {
+	chartLimits = limits
+}
+
+const (
+	// maxPointBytes is ample room for one encoded point, such as
+	// ["2024-01-01T00:00:00.000Z", -1234567.891],
+	maxPointBytes = 64
+	// maxSeriesBytes is room for a series' name and punctuation
+	maxSeriesBytes = 1 << 10
+	// maxOtherBytes covers the members besides the chart data, such as a
+	// description or the sections of a report
+	maxOtherBytes = 1 << 20
+)
+
+// MaxRequestBytes is the largest request body a chart within the limits can
+// need. Bodies are cut off there, before they are read into memory.
+func (l ChartLimits) MaxRequestBytes() int64 {
+	return int64(l.MaxPoints)*maxPointBytes + int64(l.MaxSeries)*maxSeriesBytes + maxOtherBytes
+}
+
+// maxPointErrors caps how many invalid points are reported per chart
+const maxPointErrors = 20
+
+// AllSeries returns the series of the chart, with Data as an unnamed first
+// series when it is set
+func (c *Chart) AllSeries() []ChartSeries {
+	if len(c.Data) == 0 {
+		return c.Series
+	}
+	return append([]ChartSeries{{Points: c.Data}}, c.Series...)
+}
+
+// ParseX converts an X value of this axis type to a number: the value itself
+// for number axes and Unix seconds for time axes. Category values are not
+// numeric and always return false.
+func (t ChartAxisType) ParseX(x any) (float64, bool) {
+	switch t {
+	case AxisNumber:
+		return toFloat(x)
+	case AxisTime:
+		if at, ok := parseChartTime(x); ok {
+			return float64(at.UnixNano()) / float64(time.Second), true
+		}
+	}
+	return 0, false
+}
+
+// parseChartTime accepts RFC 3339 timestamps and plain dates
+func parseChartTime(x any) (time.Time, bool) {
+	s, ok := x.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if at, err := time.Parse(layout, s); err == nil {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// toFloat converts the numbers produced by encoding/json, or set from Go code
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// ChartY returns the Y value of a point as a number
+func ChartY(point [2]any) (float64, bool) {
+	return toFloat(point[1])
+}
+
+func validateChart(chart *Chart, v *validation.Validator) {
+	v.Required("title", chart.Title)
+	v.Required("xAxis", chart.XAxis)
+	v.Required("yAxis", chart.YAxis)
+
+	if len(chart.Data) == 0 && len(chart.Series) == 0 {
+		return
+	}
+	if !v.Required("xAxisType", string(chart.XAxisType)) || !v.OneOf("xAxisType", string(chart.XAxisType), chartAxisTypes) {
+		return
+	}
+
+	series := len(chart.Series)
+	if len(chart.Data) > 0 {
+		series++
+	}
+	if series > chartLimits.MaxSeries {
+		v.Add("series", fmt.Sprintf("must have at most %d series", chartLimits.MaxSeries))
+	}
+
+	invalid := 0
+	check := func(field string, points [][2]any) int {
+		for i, point := range points {
+			if invalid >= maxPointErrors {
+				break
+			}
+			if !validX(chart.XAxisType, point[0]) {
+				v.Add(fmt.Sprintf("%s[%d][0]", field, i), xAxisMessage[chart.XAxisType])
+				invalid++
+			}
+			if _, ok := ChartY(point); !ok {
+				v.Add(fmt.Sprintf("%s[%d][1]", field, i), "must be a number")
+				invalid++
+			}
+		}
+		return len(points)
+	}
+
+	total := check("data", chart.Data)
+	names := make(map[string]bool, len(chart.Series))
+	for i, s := range chart.Series {
+		field := fmt.Sprintf("series[%d]", i)
+		if v.Required(field+".name", s.Name) {
+			if names[s.Name] {
+				v.Add(field+".name", "must be unique")
+			}
+			names[s.Name] = true
+		}
+		total += check(field+".points", s.Points)
+	}
+
+	if total > chartLimits.MaxPoints {
+		v.Add("series", fmt.Sprintf("must have at most %d points in total", chartLimits.MaxPoints))
+	}
+}
+
+var xAxisMessage = map[ChartAxisType]string{
+	AxisNumber:   "must be a number",
+	AxisTime:     "must be an RFC 3339 timestamp or a YYYY-MM-DD date",
+	AxisCategory: "must be a non-empty string",
+}
+
+func validX(axis ChartAxisType, x any) bool {
+	if axis == AxisCategory {
+		s, ok := x.(string)
+		return ok && s != ""
+	}
+	_, ok := axis.ParseX(x)
+	return ok
+}
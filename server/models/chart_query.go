@@ -0,0 +1,329 @@
+package models
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"favourite_assets/server/validation"
+)
+
+const (
+	DownsampleLTTB   = "lttb"
+	DownsampleMinMax = "minmax"
+
+	AggregateSum = "sum"
+	AggregateAvg = "avg"
+	AggregateMin = "min"
+	AggregateMax = "max"
+)
+
+var (
+	downsampleMethods = []string{DownsampleLTTB, DownsampleMinMax}
+	aggregateFuncs    = []string{AggregateSum, AggregateAvg, AggregateMin, AggregateMax}
+)
+
+// ChartQuery reshapes chart data before it is sent. Fields hold the raw query
+// parameters; they are checked against the chart's axis type by Query.
+type ChartQuery struct {
+	// From and To keep points with an X value in [From, To]
+	From string
+	To   string
+	// Points is the number of points each series is reduced to
+	Points string
+	// Downsample is "lttb" (default) or "minmax"
+	Downsample string
+	// Aggregate is "sum", "avg", "min" or "max" over buckets of X values
+	Aggregate string
+	// Bucket is the bucket width: a number, or a duration like "1h" on time
+	// axes. Without it, Points buckets of equal width are used.
+	Bucket string
+}
+
+// IsZero reports whether the query leaves the data unchanged
+func (q ChartQuery) IsZero() bool {
+	return q == ChartQuery{}
+}
+
+// chartQuery is a ChartQuery parsed for one axis type
+type chartQuery struct {
+	from, to   float64
+	points     int
+	downsample string
+	aggregate  string
+	bucket     float64
+}
+
+// Query returns a copy of the chart with every series filtered, aggregated and
+// downsampled, in that order. Invalid parameters are reported as a
+// ValidationError.
+func (c *Chart) Query(q ChartQuery) (*Chart, error) {
+	parsed, err := q.parse(c.XAxisType)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *c
+	out.Data = parsed.apply(c.XAxisType, c.Data)
+	out.Series = make([]ChartSeries, len(c.Series))
+	for i, s := range c.Series {
+		out.Series[i] = ChartSeries{Name: s.Name, Points: parsed.apply(c.XAxisType, s.Points)}
+	}
+	if len(c.Series) == 0 {
+		out.Series = nil
+	}
+	return &out, nil
+}
+
+func (q ChartQuery) parse(axis ChartAxisType) (chartQuery, error) {
+	v := &validation.Validator{}
+	parsed := chartQuery{from: math.Inf(-1), to: math.Inf(1), downsample: q.Downsample, aggregate: q.Aggregate}
+
+	if axis != AxisNumber && axis != AxisTime {
+		v.Add("xAxisType", "data queries need a number or time axis")
+		return parsed, v.Err()
+	}
+
+	parseX := func(field, value string) float64 {
+		x, ok := axis.ParseX(value)
+		if axis == AxisNumber {
+			var err error
+			x, err = strconv.ParseFloat(value, 64)
+			ok = err == nil
+		}
+		if !ok {
+			v.Add(field, xAxisMessage[axis])
+		}
+		return x
+	}
+	if q.From != "" {
+		parsed.from = parseX("from", q.From)
+	}
+	if q.To != "" {
+		parsed.to = parseX("to", q.To)
+	}
+	if parsed.from > parsed.to {
+		v.Add("to", "must not be before from")
+	}
+
+	if q.Points != "" {
+		points, err := strconv.Atoi(q.Points)
+		if err != nil {
+			v.Add("points", "must be a whole number")
+		} else if v.Range("points", points, 2, chartLimits.MaxPoints) {
+			parsed.points = points
+		}
+	}
+
+	if q.Downsample != "" {
+		if v.OneOf("downsample", q.Downsample, downsampleMethods) && q.Points == "" {
+			v.Add("points", "is required to downsample")
+		}
+	} else {
+		parsed.downsample = DownsampleLTTB
+	}
+	if parsed.downsample == DownsampleLTTB && parsed.points == 2 && q.Aggregate == "" {
+		v.Add("points", "must be at least 3 for lttb")
+	}
+
+	if q.Bucket != "" {
+		parsed.bucket = parseBucket(v, axis, q.Bucket)
+	}
+	if q.Aggregate != "" {
+		if v.OneOf("aggregate", q.Aggregate, aggregateFuncs) && q.Bucket == "" && q.Points == "" {
+			v.Add("bucket", "is required to aggregate, or give points")
+		}
+	} else if q.Bucket != "" {
+		v.Add("aggregate", "is required with bucket")
+	}
+
+	return parsed, v.Err()
+}
+
+// parseBucket reads a bucket width in the units of the axis: seconds for time
+func parseBucket(v *validation.Validator, axis ChartAxisType, value string) float64 {
+	if axis == AxisTime {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			v.Add("bucket", "must be a positive duration, e.g. 15m, 1h or 24h")
+			return 0
+		}
+		return d.Seconds()
+	}
+	width, err := strconv.ParseFloat(value, 64)
+	if err != nil || width <= 0 || math.IsInf(width, 0) {
+		v.Add("bucket", "must be a positive number")
+		return 0
+	}
+	return width
+}
+
+// samplePoint is a chart point with its numeric X and Y
+type samplePoint struct {
+	x, y float64
+	raw  [2]any
+}
+
+func (q chartQuery) apply(axis ChartAxisType, points [][2]any) [][2]any {
+	if points == nil {
+		return nil
+	}
+
+	samples := make([]samplePoint, 0, len(points))
+	for _, p := range points {
+		x, okX := axis.ParseX(p[0])
+		y, okY := ChartY(p)
+		if okX && okY && x >= q.from && x <= q.to {
+			samples = append(samples, samplePoint{x, y, p})
+		}
+	}
+	slices.SortStableFunc(samples, func(a, b samplePoint) int {
+		return cmp.Compare(a.x, b.x)
+	})
+
+	switch {
+	case q.aggregate != "":
+		samples = aggregate(axis, samples, q.aggregate, q.bucket, q.points)
+	case q.points > 0 && len(samples) > q.points:
+		if q.downsample == DownsampleMinMax {
+			samples = minMax(samples, q.points)
+		} else {
+			samples = lttb(samples, q.points)
+		}
+	}
+
+	result := make([][2]any, len(samples))
+	for i, s := range samples {
+		result[i] = s.raw
+	}
+	return result
+}
+
+// aggregate combines the Y values of each bucket of X values. Buckets of a
+// given width are aligned to multiples of it; otherwise the range is split in
+// points buckets. The X of a bucket is its start.
+func aggregate(axis ChartAxisType, samples []samplePoint, fn string, width float64, points int) []samplePoint {
+	if len(samples) == 0 {
+		return samples
+	}
+	origin, equal := 0.0, width == 0
+	if equal {
+		origin = samples[0].x
+		width = (samples[len(samples)-1].x - origin) / float64(points)
+		if width == 0 {
+			width = 1
+		}
+	}
+
+	var result []samplePoint
+	count := 0
+	for _, s := range samples {
+		bucket := math.Floor((s.x - origin) / width)
+		if equal {
+			// The last point closes the range instead of opening a bucket
+			bucket = min(bucket, float64(points-1))
+		}
+		start := origin + bucket*width
+
+		if len(result) > 0 && result[len(result)-1].x == start {
+			last := &result[len(result)-1]
+			count++
+			switch fn {
+			case AggregateSum:
+				last.y += s.y
+			case AggregateAvg:
+				last.y += (s.y - last.y) / float64(count)
+			case AggregateMin:
+				last.y = min(last.y, s.y)
+			case AggregateMax:
+				last.y = max(last.y, s.y)
+			}
+			continue
+		}
+		count = 1
+		result = append(result, samplePoint{x: start, y: s.y})
+	}
+
+	for i := range result {
+		result[i].raw = [2]any{formatX(axis, result[i].x), result[i].y}
+	}
+	return result
+}
+
+// formatX converts a numeric X back to the JSON form of the axis
+func formatX(axis ChartAxisType, x float64) any {
+	if axis == AxisTime {
+		return time.Unix(0, int64(x*float64(time.Second))).UTC().Format(time.RFC3339Nano)
+	}
+	return x
+}
+
+// lttb keeps n points with Largest-Triangle-Three-Buckets, which preserves
+// the visual shape of a line. The first and last points are always kept.
+func lttb(samples []samplePoint, n int) []samplePoint {
+	result := make([]samplePoint, 0, n)
+	result = append(result, samples[0])
+
+	size := float64(len(samples)-2) / float64(n-2)
+	selected := 0
+	for i := 0; i < n-2; i++ {
+		start := int(float64(i)*size) + 1
+		end := int(float64(i+1)*size) + 1
+
+		// Average of the next bucket, or the last point
+		nextEnd := min(int(float64(i+2)*size)+1, len(samples))
+		avgX, avgY := 0.0, 0.0
+		for _, s := range samples[end:nextEnd] {
+			avgX += s.x
+			avgY += s.y
+		}
+		if count := float64(nextEnd - end); count > 0 {
+			avgX, avgY = avgX/count, avgY/count
+		} else {
+			avgX, avgY = samples[len(samples)-1].x, samples[len(samples)-1].y
+		}
+
+		a := samples[selected]
+		best, bestArea := start, -1.0
+		for j := start; j < end; j++ {
+			area := math.Abs((a.x-avgX)*(samples[j].y-a.y) - (a.x-samples[j].x)*(avgY-a.y))
+			if area > bestArea {
+				best, bestArea = j, area
+			}
+		}
+		result = append(result, samples[best])
+		selected = best
+	}
+	return append(result, samples[len(samples)-1])
+}
+
+// minMax splits the points in n/2 buckets and keeps the lowest and highest
+// point of each, in X order, so peaks survive
+func minMax(samples []samplePoint, n int) []samplePoint {
+	buckets := n / 2
+	result := make([]samplePoint, 0, n)
+	for i := 0; i < buckets; i++ {
+		start := i * len(samples) / buckets
+		end := (i + 1) * len(samples) / buckets
+		lo, hi := start, start
+		for j := start; j < end; j++ {
+			if samples[j].y < samples[lo].y {
+				lo = j
+			}
+			if samples[j].y > samples[hi].y {
+				hi = j
+			}
+		}
+		switch {
+		case lo == hi:
+			result = append(result, samples[lo])
+		case lo < hi:
+			result = append(result, samples[lo], samples[hi])
+		default:
+			result = append(result, samples[hi], samples[lo])
+		}
+	}
+	return result
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"favourite_assets/server/errors"
+)
+
+// numberChart has one series of points at x = 0..n-1, with y from fn
+func numberChart(n int, fn func(x int) float64) *Chart {
+	chart := &Chart{Title: "t", XAxis: "x", YAxis: "y", XAxisType: AxisNumber}
+	for x := range n {
+		chart.Data = append(chart.Data, [2]any{float64(x), fn(x)})
+	}
+	return chart
+}
+
+func queryFields(t *testing.T, chart *Chart, q ChartQuery) map[string]string {
+	t.Helper()
+	_, err := chart.Query(q)
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*errors.ValidationError)
+	if !ok {
+		t.Fatalf("%+v: got %v, want a ValidationError", q, err)
+	}
+	fields := map[string]string{}
+	for _, f := range validationErr.Fields {
+		fields[f.Field] = f.Message
+	}
+	return fields
+}
+
+func TestChartQueryValidation(t *testing.T) {
+	chart := numberChart(10, func(x int) float64 { return float64(x) })
+	timed := &Chart{Title: "t", XAxis: "x", YAxis: "y", XAxisType: AxisTime}
+	category := &Chart{Title: "t", XAxis: "x", YAxis: "y", XAxisType: AxisCategory}
+
+	tests := []struct {
+		name  string
+		chart *Chart
+		query ChartQuery
+		field string
+	}{
+		{"valid range", chart, ChartQuery{From: "2", To: "5"}, ""},
+		{"minmax to 2 points", chart, ChartQuery{Points: "2", Downsample: DownsampleMinMax}, ""},
+		{"aggregate to 2 points", chart, ChartQuery{Points: "2", Aggregate: AggregateSum}, ""},
+		{"time bucket", timed, ChartQuery{Aggregate: AggregateAvg, Bucket: "1h"}, ""},
+
+		{"category axis", category, ChartQuery{Points: "10"}, "xAxisType"},
+		{"bad from", chart, ChartQuery{From: "two"}, "from"},
+		{"to before from", chart, ChartQuery{From: "5", To: "2"}, "to"},
+		{"date on a number axis", chart, ChartQuery{To: "2024-01-01"}, "to"},
+		{"number on a time axis", timed, ChartQuery{From: "12"}, "from"},
+		{"lttb to 2 points", chart, ChartQuery{Points: "2"}, "points"},
+		{"1 point", chart, ChartQuery{Points: "1", Downsample: DownsampleMinMax}, "points"},
+		{"fractional points", chart, ChartQuery{Points: "2.5"}, "points"},
+		{"downsample without points", chart, ChartQuery{Downsample: DownsampleMinMax}, "points"},
+		{"unknown downsample", chart, ChartQuery{Points: "5", Downsample: "average"}, "downsample"},
+		{"unknown aggregate", chart, ChartQuery{Aggregate: "median", Bucket: "2"}, "aggregate"},
+		{"aggregate without bucket", chart, ChartQuery{Aggregate: AggregateSum}, "bucket"},
+		{"bucket without aggregate", chart, ChartQuery{Bucket: "2"}, "aggregate"},
+		{"negative bucket", chart, ChartQuery{Aggregate: AggregateSum, Bucket: "-2"}, "bucket"},
+		{"number bucket on a time axis", timed, ChartQuery{Aggregate: AggregateSum, Bucket: "60"}, "bucket"},
+	}
+	for _, tt := range tests {
+		fields := queryFields(t, tt.chart, tt.query)
+		if tt.field == "" && fields != nil {
+			t.Errorf("%s: got %v, want the query accepted", tt.name, fields)
+		}
+		if _, ok := fields[tt.field]; tt.field != "" && (!ok || len(fields) != 1) {
+			t.Errorf("%s: got %v, want an error for %s only", tt.name, fields, tt.field)
+		}
+	}
+}
+
+func TestChartQueryDownsample(t *testing.T) {
+	// A wave with a single spike, which every method has to keep
+	chart := numberChart(1000, func(x int) float64 {
+		if x == 437 {
+			return 100
+		}
+		return math.Sin(float64(x) / 50)
+	})
+
+	for _, method := range []string{DownsampleLTTB, DownsampleMinMax} {
+		for _, points := range []int{3, 4, 10, 101} {
+			got, err := chart.Query(ChartQuery{Points: strconv.Itoa(points), Downsample: method})
+			if err != nil {
+				t.Fatalf("%s to %d: %v", method, points, err)
+			}
+			if len(got.Data) > points || len(got.Data) < points-1 {
+				t.Errorf("%s to %d: got %d points", method, points, len(got.Data))
+			}
+			spike := false
+			for i, p := range got.Data {
+				if i > 0 && p[0].(float64) <= got.Data[i-1][0].(float64) {
+					t.Errorf("%s to %d: got x %v after %v, want increasing x", method, points, p[0], got.Data[i-1][0])
+				}
+				// Points are kept as they are, never interpolated
+				if x := int(p[0].(float64)); !reflect.DeepEqual(p, chart.Data[x]) {
+					t.Errorf("%s to %d: got %v, want %v", method, points, p, chart.Data[x])
+				}
+				spike = spike || p[0] == 437.0
+			}
+			if !spike {
+				t.Errorf("%s to %d: got %v, want the spike kept", method, points, got.Data)
+			}
+			if method == DownsampleLTTB && (got.Data[0][0] != 0.0 || got.Data[len(got.Data)-1][0] != 999.0) {
+				t.Errorf("lttb to %d: got %v, want the first and last points kept", points, got.Data)
+			}
+		}
+
+		// Asking for as many points as there are, or more, changes nothing
+		for _, points := range []string{"1000", "5000"} {
+			got, err := chart.Query(ChartQuery{Points: points, Downsample: method})
+			if err != nil || !reflect.DeepEqual(got.Data, chart.Data) {
+				t.Errorf("%s to %s: got %d points (%v), want the data unchanged", method, points, len(got.Data), err)
+			}
+		}
+	}
+}
+
+func TestChartQueryAggregate(t *testing.T) {
+	chart := numberChart(30, func(x int) float64 { return float64(x) })
+
+	tests := []struct {
+		query ChartQuery
+		want  [][2]any
+	}{
+		// Buckets of a width are aligned to multiples of it
+		{ChartQuery{Aggregate: AggregateSum, Bucket: "10"}, [][2]any{{0.0, 45.0}, {10.0, 145.0}, {20.0, 245.0}}},
+		{ChartQuery{Aggregate: AggregateAvg, Bucket: "10"}, [][2]any{{0.0, 4.5}, {10.0, 14.5}, {20.0, 24.5}}},
+		{ChartQuery{Aggregate: AggregateMin, Bucket: "20"}, [][2]any{{0.0, 0.0}, {20.0, 20.0}}},
+		{ChartQuery{Aggregate: AggregateMax, Bucket: "20", From: "5"}, [][2]any{{0.0, 19.0}, {20.0, 29.0}}},
+
+		// Without a width the range is split in equal buckets, the last point
+		// closing the last one
+		{ChartQuery{Aggregate: AggregateMax, Points: "3"}, [][2]any{{0.0, 9.0}, {29.0 / 3, 19.0}, {58.0 / 3, 29.0}}},
+		{ChartQuery{Aggregate: AggregateSum, Points: "1"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := chart.Query(tt.query)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%+v: got %v, want an error", tt.query, got.Data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Data, tt.want) {
+			t.Errorf("%+v: got %v, want %v", tt.query, got.Data, tt.want)
+		}
+	}
+
+	// Time buckets keep the X in the axis format
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timed := &Chart{Title: "t", XAxis: "x", YAxis: "y", XAxisType: AxisTime}
+	for m := 0; m < 180; m += 20 {
+		timed.Data = append(timed.Data, [2]any{start.Add(time.Duration(m) * time.Minute).Format(time.RFC3339), 1.0})
+	}
+	got, err := timed.Query(ChartQuery{Aggregate: AggregateSum, Bucket: "1h"})
+	want := [][2]any{{"2024-01-01T00:00:00Z", 3.0}, {"2024-01-01T01:00:00Z", 3.0}, {"2024-01-01T02:00:00Z", 3.0}}
+	if err != nil || !reflect.DeepEqual(got.Data, want) {
+		t.Errorf("got %v (%v), want %v", got.Data, err, want)
+	}
+}
+
+func TestChartQuerySeries(t *testing.T) {
+	chart := &Chart{Title: "t", XAxis: "x", YAxis: "y", XAxisType: AxisNumber, Series: []ChartSeries{
+		{Name: "a", Points: [][2]any{{3.0, 1.0}, {1.0, 2.0}, {2.0, 3.0}}},
+		{Name: "b", Points: [][2]any{{5.0, 1.0}}},
+	}}
+	got, err := chart.Query(ChartQuery{From: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ChartSeries{
+		{Name: "a", Points: [][2]any{{2.0, 3.0}, {3.0, 1.0}}},
+		{Name: "b", Points: [][2]any{{5.0, 1.0}}},
+	}
+	if !reflect.DeepEqual(got.Series, want) || got.Data != nil {
+		t.Errorf("got %v and %v, want %v and no data", got.Series, got.Data, want)
+	}
+	// The chart itself is left as it was
+	if chart.Series[0].Points[0][0] != 3.0 {
+		t.Errorf("got %v, want the chart unchanged", chart.Series[0].Points)
+	}
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestChartLimitsMaxRequestBytes(t *testing.T) {
+	limits := ChartLimits{MaxSeries: 20, MaxPoints: 10000}
+
+	// The largest chart allowed, with long names and values, still fits
+	chart := createChartRequest{Type: "chart", Title: "Revenue", XAxis: "time", YAxis: "amount", XAxisType: AxisTime}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	perSeries := limits.MaxPoints / limits.MaxSeries
+	for s := range limits.MaxSeries {
+		series := ChartSeries{Name: fmt.Sprintf("%0200d", s)}
+		for p := range perSeries {
+			series.Points = append(series.Points, [2]any{at.Add(time.Duration(p) * time.Millisecond).Format(time.RFC3339Nano), -1234567.891})
+		}
+		chart.Series = append(chart.Series, series)
+	}
+	body, err := json.MarshalIndent(chart, "", " ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(body)) > limits.MaxRequestBytes() {
+		t.Errorf("got a %d byte chart within the limits, over the %d byte body limit", len(body), limits.MaxRequestBytes())
+	}
+}
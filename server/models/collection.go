@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Collection is a named, ordered group of a user's favourites. A favourite
+// can be in any number of collections.
+type Collection struct {
+	ID           uuid.UUID   `json:"id"`
+	UserID       uuid.UUID   `json:"userId"`
+	Name         string      `json:"name"`
+	FavouriteIDs []uuid.UUID `json:"favouriteIds"`
+	// Favourites is filled in, in order, when a single collection is fetched
+	Favourites []*Favourite `json:"favourites,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	UpdatedAt  time.Time    `json:"updatedAt"`
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"favourite_assets/server/validation"
+)
+
+// AssetKind describes one asset type. Controllers, services and repositories
+// dispatch through the registered kinds instead of switching on the type, so
+// a new type only has to register itself.
+type AssetKind struct {
+	Type AssetType
+	// New returns an empty asset, used to decode stored and patched documents
+	New func() Asset
+	// Decode builds an asset from a create request body, rejecting unknown
+	// fields. Problems with single fields are returned as a ValidationError.
+	Decode func(body []byte) (Asset, error)
+	// Validate records the invalid fields of an asset of this kind
+	Validate func(asset Asset, v *validation.Validator)
+	// Render draws the asset; nil if it cannot be drawn. Renderers live
+	// outside this package and are attached with SetAssetRenderer.
+	Render Renderer
+}
+
+// Renderer draws an asset as an image
+type Renderer func(asset Asset, opts RenderOptions, w io.Writer) error
+
+// RenderOptions describe the image a Renderer produces
+type RenderOptions struct {
+	// Format is "svg" or "png"
+	Format string
+	Width  int
+	Height int
+	// Style is a type-specific variant, e.g. "line" or "bar" for charts
+	Style string
+}
+
+var (
+	assetKindsMu sync.RWMutex
+	assetKinds   = map[AssetType]*AssetKind{}
+)
+
+// RegisterAssetKind adds an asset type to the registry. It is meant to be
+// called from init and panics on an incomplete or duplicate kind.
+func RegisterAssetKind(kind AssetKind) {
+	if kind.Type == "" || kind.New == nil || kind.Decode == nil || kind.Validate == nil {
+		panic(fmt.Sprintf("models: incomplete asset kind %q", kind.Type))
+	}
+
+	// DecodeAsset relies on the "type" member, see marshalAsset
+	if data, err := json.Marshal(kind.New()); err != nil || !bytes.HasPrefix(data, []byte(`{"type":`)) {
+		panic(fmt.Sprintf("models: asset kind %q does not encode its type", kind.Type))
+	}
+
+	assetKindsMu.Lock()
+	defer assetKindsMu.Unlock()
+	if _, exists := assetKinds[kind.Type]; exists {
+		panic(fmt.Sprintf("models: asset kind %q registered twice", kind.Type))
+	}
+	assetKinds[kind.Type] = &kind
+}
+
+// SetAssetRenderer attaches a renderer to a registered asset type. It is
+// meant to be called from the init of the package implementing the renderer.
+func SetAssetRenderer(t AssetType, render Renderer) {
+	assetKindsMu.Lock()
+	defer assetKindsMu.Unlock()
+	kind, ok := assetKinds[t]
+	if !ok {
+		panic(fmt.Sprintf("models: renderer for unknown asset kind %q", t))
+	}
+	kind.Render = render
+}
+
+// LookupAssetKind returns the registered kind of an asset type
+func LookupAssetKind(t AssetType) (*AssetKind, bool) {
+	assetKindsMu.RLock()
+	defer assetKindsMu.RUnlock()
+	kind, ok := assetKinds[t]
+	return kind, ok
+}
+
+// AssetTypes lists the registered asset types in alphabetical order
+func AssetTypes() []AssetType {
+	assetKindsMu.RLock()
+	defer assetKindsMu.RUnlock()
+	types := make([]AssetType, 0, len(assetKinds))
+	for t := range assetKinds {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// NewAsset returns an empty asset of type t, or false for an unknown type
+func NewAsset(t AssetType) (Asset, bool) {
+	kind, ok := LookupAssetKind(t)
+	if !ok {
+		return nil, false
+	}
+	return kind.New(), true
+}
+
+// assetRequest is the typed body of a create request
+type assetRequest interface {
+	asset() Asset
+}
+
+// serverFields are the members the server adds to its asset output. Create
+// requests accept and ignore them, so an exported asset can be posted back.
+type serverFields struct {
+	ID        json.RawMessage `json:"id"`
+	CreatedAt json.RawMessage `json:"createdAt"`
+	UpdatedAt json.RawMessage `json:"updatedAt"`
+	Version   json.RawMessage `json:"version"`
+	DeletedAt json.RawMessage `json:"deletedAt"`
+	DeletedBy json.RawMessage `json:"deletedBy"`
+}
+
+// checkedRequest is a create request with rules the asset cannot express,
+// such as a number that must be sent even though zero is a valid value
+type checkedRequest interface {
+	check(v *validation.Validator)
+}
+
+// decodeAssetRequest decodes body into req and builds the asset from it
+func decodeAssetRequest(body []byte, req assetRequest) (Asset, error) {
+	if err := validation.DecodeStrictBytes(body, req); err != nil {
+		return nil, err
+	}
+	asset := req.asset()
+	if checked, ok := req.(checkedRequest); ok {
+		v := &validation.Validator{}
+		checked.check(v)
+		if v.Err() != nil {
+			// Report the other invalid fields too, not only the request's
+			if kind, ok := LookupAssetKind(asset.GetType()); ok {
+				kind.Validate(asset, v)
+			}
+			return nil, v.Err()
+		}
+	}
+	return asset, nil
+}
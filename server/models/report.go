@@ -0,0 +1,66 @@
+package models
+
+import (
+	"fmt"
+
+	"favourite_assets/server/validation"
+)
+
+const AssetReport AssetType = "report"
+
+// Report is a longer write-up made of titled sections
+type Report struct {
+	BaseAsset
+	Title    string          `json:"title"`
+	Summary  string          `json:"summary"`
+	Sections []ReportSection `json:"sections"`
+}
+
+type ReportSection struct {
+	Heading string `json:"heading"`
+	Body    string `json:"body"`
+}
+
+func (r *Report) GetType() AssetType { return AssetReport }
+func (r *Report) GetTitle() string    { return r.Title }
+
+const maxReportSections = 50
+
+func init() {
+	RegisterAssetKind(AssetKind{
+		Type:   AssetReport,
+		New:    func() Asset { return &Report{} },
+		Decode: func(body []byte) (Asset, error) { return decodeAssetRequest(body, &createReportRequest{}) },
+		Validate: func(asset Asset, v *validation.Validator) {
+			report := asset.(*Report)
+			v.Required("title", report.Title)
+			if len(report.Sections) == 0 {
+				v.Add("sections", "must have at least one section")
+			}
+			if len(report.Sections) > maxReportSections {
+				v.Add("sections", fmt.Sprintf("must have at most %d sections", maxReportSections))
+			}
+			for i, section := range report.Sections {
+				v.Required(fmt.Sprintf("sections[%d].heading", i), section.Heading)
+			}
+		},
+	})
+}
+
+type createReportRequest struct {
+	serverFields
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	Title       string          `json:"title"`
+	Summary     string          `json:"summary"`
+	Sections    []ReportSection `json:"sections"`
+}
+
+func (r *createReportRequest) asset() Asset {
+	return &Report{
+		BaseAsset: BaseAsset{Description: r.Description},
+		Title:     r.Title,
+		Summary:   r.Summary,
+		Sections:  r.Sections,
+	}
+}
@@ -6,10 +6,24 @@ import (
 	"github.com/google/uuid"
 )
 
+// ExternalIdentity links a local user to an account of an identity provider
+type ExternalIdentity struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+}
+
 type User struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID        uuid.UUID         `json:"id"`
+	Name      string            `json:"name"`
+	Email     string            `json:"email"`
+	Username  string            `json:"username,omitempty"`
+	Identity  *ExternalIdentity `json:"identity,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	// Version counts the writes to the user, from 1, and is its entity tag
+	Version int `json:"version"`
+	// DeletedAt and DeletedBy (a token subject) are set while the user is
+	// in the trash
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	DeletedBy string     `json:"deletedBy,omitempty"`
 }
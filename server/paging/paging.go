@@ -0,0 +1,178 @@
+// Package paging sorts list responses and splits them into pages. Pages are
+// addressed by keyset cursors: a cursor holds the sort key of the last item
+// returned, so items inserted or deleted concurrently never shift a page.
+package paging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/validation"
+)
+
+// MaxLimit is the largest page size a client may ask for
+const MaxLimit = 1000
+
+const (
+	SortCreatedAt   = "createdAt"
+	SortUpdatedAt   = "updatedAt"
+	SortTitle       = "title"
+	SortDescription = "description"
+	SortName        = "name"
+	SortEmail       = "email"
+	SortDeletedAt   = "deletedAt"
+	SortTime        = "time"
+)
+
+// Page is a parsed list request. The zero value lists everything by the
+// default sort.
+type Page struct {
+	Sort string
+	Desc bool
+	// Limit is the page size, 0 for no limit
+	Limit int
+	after *cursor
+}
+
+// Key orders one item; ties on Value are broken by ID
+type Key struct {
+	Value string
+	ID    uuid.UUID
+}
+
+// TimeKey formats t so that keys sort in time order
+func TimeKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// TextKey makes text sort case-insensitively
+func TextKey(s string) string {
+	return strings.ToLower(s)
+}
+
+type cursor struct {
+	Sort  string    `json:"s"`
+	Desc  bool      `json:"d,omitempty"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"i"`
+}
+
+// Parse reads the sort, order, limit and cursor query parameters. sorts
+// lists the fields the list can be sorted by, the first being the default.
+// Invalid parameters are reported as a ValidationError.
+func Parse(query url.Values, sorts []string) (Page, error) {
+	v := &validation.Validator{}
+	page := Page{Sort: sorts[0]}
+
+	if sort := query.Get("sort"); sort != "" && v.OneOf("sort", sort, sorts) {
+		page.Sort = sort
+	}
+	switch order := strings.ToLower(query.Get("order")); order {
+	case "", "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		v.Add("order", "must be one of asc, desc")
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			v.Add("limit", "must be a whole number")
+		} else if v.Range("limit", n, 1, MaxLimit) {
+			page.Limit = n
+		}
+	}
+
+	if token := query.Get("cursor"); token != "" {
+		after, err := decodeCursor(token)
+		switch {
+		case err != nil || !slices.Contains(sorts, after.Sort):
+			v.Add("cursor", "is invalid")
+		case (query.Get("sort") != "" && after.Sort != page.Sort) || (query.Get("order") != "" && after.Desc != page.Desc):
+			v.Add("cursor", "was issued for another sort order")
+		default:
+			// The cursor carries the order of the list it came from
+			page.Sort, page.Desc, page.after = after.Sort, after.Desc, after
+		}
+	}
+
+	return page, v.Err()
+}
+
+// Apply sorts items, skips those up to the page's cursor and cuts the page.
+// It returns the page and the cursor of the next one, or "" on the last page.
+func Apply[T any](p Page, items []T, key func(item T, sort string) Key) ([]T, string) {
+	keys := make([]Key, len(items))
+	order := make([]int, len(items))
+	for i, item := range items {
+		keys[i] = key(item, p.Sort)
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		return p.compare(keys[a], keys[b])
+	})
+
+	result := make([]T, 0, len(items))
+	var last Key
+	for _, i := range order {
+		if p.after != nil && p.compare(keys[i], Key{p.after.Value, p.after.ID}) <= 0 {
+			continue
+		}
+		if p.Limit > 0 && len(result) == p.Limit {
+			return result, encodeCursor(cursor{Sort: p.Sort, Desc: p.Desc, Value: last.Value, ID: last.ID})
+		}
+		result = append(result, items[i])
+		last = keys[i]
+	}
+	return result, ""
+}
+
+func (p Page) compare(a, b Key) int {
+	c := strings.Compare(a.Value, b.Value)
+	if c == 0 {
+		c = bytes.Compare(a.ID[:], b.ID[:])
+	}
+	if p.Desc {
+		return -c
+	}
+	return c
+}
+
+// SetLink adds a Link header pointing at the next page when there is one
+func SetLink(w http.ResponseWriter, r *http.Request, next string) {
+	if next == "" {
+		return
+	}
+	u := *r.URL
+	query := u.Query()
+	query.Set("cursor", next)
+	u.RawQuery = query.Encode()
+	w.Header().Add("Link", "<"+u.RequestURI()+`>; rel="next"`)
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,179 @@
+package paging
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+)
+
+type item struct {
+	id   uuid.UUID
+	name string
+}
+
+func itemKey(it item, sort string) Key {
+	return Key{ID: it.id, Value: TextKey(it.name)}
+}
+
+var testSorts = []string{SortName, SortCreatedAt}
+
+// items makes items with the given names, their IDs in increasing order
+func items(names ...string) []item {
+	result := make([]item, len(names))
+	for i, name := range names {
+		result[i] = item{id: uuid.UUID{15: byte(i + 1)}, name: name}
+	}
+	return result
+}
+
+func names(list []item) []string {
+	result := make([]string, len(list))
+	for i, it := range list {
+		result[i] = it.name
+	}
+	return result
+}
+
+// collect walks every page of query over the items returned by list, which
+// is called again for every page
+func collect(t *testing.T, query url.Values, list func(page int) []item) [][]string {
+	t.Helper()
+	var pages [][]string
+	for i := 0; ; i++ {
+		page, err := Parse(query, testSorts)
+		if err != nil {
+			t.Fatalf("page %d: %v", i, err)
+		}
+		result, next := Apply(page, list(i), itemKey)
+		pages = append(pages, names(result))
+		if next == "" {
+			return pages
+		}
+		if i > 10 {
+			t.Fatalf("got more than 10 pages: %v", pages)
+		}
+		query = url.Values{"cursor": {next}, "limit": query["limit"]}
+	}
+}
+
+func TestApplyPages(t *testing.T) {
+	all := items("delta", "Alpha", "charlie", "bravo", "echo")
+	tests := []struct {
+		query url.Values
+		want  [][]string
+	}{
+		{url.Values{}, [][]string{{"Alpha", "bravo", "charlie", "delta", "echo"}}},
+		{url.Values{"limit": {"2"}}, [][]string{{"Alpha", "bravo"}, {"charlie", "delta"}, {"echo"}}},
+		{url.Values{"limit": {"2"}, "order": {"DESC"}}, [][]string{{"echo", "delta"}, {"charlie", "bravo"}, {"Alpha"}}},
+		// A full last page is not followed by an empty one
+		{url.Values{"limit": {"5"}}, [][]string{{"Alpha", "bravo", "charlie", "delta", "echo"}}},
+	}
+	for _, tt := range tests {
+		got := collect(t, tt.query, func(int) []item { return all })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Ties are broken by ID, so equal names still page without repeats
+	twins := items("same", "same", "same")
+	got := collect(t, url.Values{"limit": {"1"}}, func(int) []item { return twins })
+	if len(got) != 3 {
+		t.Errorf("got %v, want three pages of one", got)
+	}
+}
+
+func TestApplyStableUnderInserts(t *testing.T) {
+	all := items("b", "d", "f", "h")
+	inserted := append(items("b", "d", "f", "h"), item{id: uuid.New(), name: "a"}, item{id: uuid.New(), name: "e"}, item{id: uuid.New(), name: "i"})
+	removed := items("b", "h")
+
+	// Inserts before the cursor are not seen and do not shift the next page,
+	// inserts after it show up in order
+	got := collect(t, url.Values{"limit": {"2"}}, func(page int) []item {
+		if page == 0 {
+			return all
+		}
+		return inserted
+	})
+	want := [][]string{{"b", "d"}, {"e", "f"}, {"h", "i"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Deleting the last item of a page does not lose the next one
+	got = collect(t, url.Values{"limit": {"2"}}, func(page int) []item {
+		if page == 0 {
+			return all
+		}
+		return removed
+	})
+	want = [][]string{{"b", "d"}, {"h"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	page, err := Parse(url.Values{}, testSorts)
+	if err != nil || page.Sort != SortName || page.Desc || page.Limit != 0 {
+		t.Errorf("got %+v (%v), want the default sort without a limit", page, err)
+	}
+
+	// The cursor carries the sort and order it was issued for
+	_, next := Apply(Page{Sort: SortCreatedAt, Desc: true, Limit: 1}, items("a", "b"), itemKey)
+	page, err = Parse(url.Values{"cursor": {next}}, testSorts)
+	if err != nil || page.Sort != SortCreatedAt || !page.Desc || page.after == nil {
+		t.Errorf("got %+v (%v), want the cursor's sort and order", page, err)
+	}
+	if _, err := Parse(url.Values{"cursor": {next}, "sort": {SortCreatedAt}, "order": {"desc"}}, testSorts); err != nil {
+		t.Errorf("got %v, want the cursor accepted with its own sort and order", err)
+	}
+
+	cursorFor := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+	tests := []struct {
+		query url.Values
+		field string
+	}{
+		{url.Values{"sort": {"size"}}, "sort"},
+		{url.Values{"order": {"up"}}, "order"},
+		{url.Values{"limit": {"ten"}}, "limit"},
+		{url.Values{"limit": {"0"}}, "limit"},
+		{url.Values{"limit": {"1001"}}, "limit"},
+		{url.Values{"cursor": {"not a cursor!"}}, "cursor"},
+		{url.Values{"cursor": {cursorFor("[1, 2]")}}, "cursor"},
+		{url.Values{"cursor": {cursorFor(`{"s": "size", "v": "a", "i": "00000000-0000-0000-0000-000000000001"}`)}}, "cursor"},
+		{url.Values{"cursor": {cursorFor(`{"s": "name", "v": "a", "i": "not a uuid"}`)}}, "cursor"},
+		{url.Values{"cursor": {next}, "sort": {SortName}}, "cursor"},
+		{url.Values{"cursor": {next}, "order": {"asc"}}, "cursor"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.query, testSorts)
+		validationErr, ok := err.(*errors.ValidationError)
+		if !ok || len(validationErr.Fields) != 1 || validationErr.Fields[0].Field != tt.field {
+			t.Errorf("%v: got %v, want an error for %s", tt.query, err, tt.field)
+		}
+	}
+}
+
+func TestSetLink(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users?limit=2&cursor=old", nil)
+	w := httptest.NewRecorder()
+	SetLink(w, r, "")
+	if got := w.Header().Get("Link"); got != "" {
+		t.Errorf("got %q on the last page, want no Link", got)
+	}
+	SetLink(w, r, "next")
+	if got := w.Header().Get("Link"); got != `</users?cursor=next&limit=2>; rel="next"` {
+		t.Errorf("got %q, want a link to the next page", got)
+	}
+}
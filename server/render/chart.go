@@ -0,0 +1,455 @@
+package render
+
+import (
+	"fmt"
+	"image/png"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+const (
+	titleSize = 16
+	labelSize = 12
+	tickSize  = 11
+	// maxTickLabel is the length after which tick labels are shortened
+	maxTickLabel = 14
+)
+
+// renderChart draws a chart as a line or bar chart
+func renderChart(asset models.Asset, opts models.RenderOptions, w io.Writer) error {
+	chart, ok := asset.(*models.Chart)
+	if !ok {
+		return errors.ErrAssetNotRenderable
+	}
+
+	p := newChartPlot(chart, opts)
+	switch opts.Format {
+	case FormatSVG:
+		c := newSVGCanvas(opts.Width, opts.Height)
+		p.draw(c)
+		_, err := c.WriteTo(w)
+		return err
+	case FormatPNG:
+		c := newRasterCanvas(opts.Width, opts.Height)
+		p.draw(c)
+		return png.Encode(w, c.img)
+	}
+	return errors.ErrUnsupportedFormat
+}
+
+type plotSeries struct {
+	name   string
+	points []point
+}
+
+type tick struct {
+	value float64
+	label string
+}
+
+// chartPlot holds a chart converted to plot coordinates. On categorical plots
+// the X value of a point is the index of its category.
+type chartPlot struct {
+	chart         *models.Chart
+	width, height float64
+	bars          bool
+	series        []plotSeries
+	categories    []string
+	legend        bool
+
+	xMin, xMax float64
+	yMin, yMax float64
+	xTicks     []tick
+	yTicks     []tick
+
+	left, top, right, bottom float64
+}
+
+func newChartPlot(chart *models.Chart, opts models.RenderOptions) *chartPlot {
+	p := &chartPlot{
+		chart:  chart,
+		width:  float64(opts.Width),
+		height: float64(opts.Height),
+		bars:   opts.Style == StyleBar || (opts.Style == "" && chart.XAxisType == models.AxisCategory),
+	}
+
+	all := chart.AllSeries()
+	for i, s := range all {
+		name := s.Name
+		if name != "" {
+			p.legend = true
+		} else if i == 0 {
+			name = chart.YAxis
+		}
+		p.series = append(p.series, plotSeries{name: name})
+	}
+
+	if p.bars || chart.XAxisType == models.AxisCategory {
+		p.categorize(all)
+	} else {
+		p.place(all)
+	}
+	p.scaleY()
+	p.layout()
+	return p
+}
+
+// categorize places every distinct X value in its own band. Numeric values
+// are ordered, categories keep the order they first appear in.
+func (p *chartPlot) categorize(all []models.ChartSeries) {
+	index := map[string]int{}
+	var keys []float64
+	var labels []string
+	for _, s := range all {
+		for _, pt := range s.Points {
+			key := p.xKey(pt[0])
+			if _, ok := index[key]; ok {
+				continue
+			}
+			index[key] = len(p.categories)
+			p.categories = append(p.categories, key)
+			labels = append(labels, p.xLabel(pt[0]))
+			x, _ := p.chart.XAxisType.ParseX(pt[0])
+			keys = append(keys, x)
+		}
+	}
+
+	if p.chart.XAxisType != models.AxisCategory {
+		order := make([]int, len(p.categories))
+		for i := range order {
+			order[i] = i
+		}
+		slices.SortStableFunc(order, func(a, b int) int {
+			return compareFloat(keys[a], keys[b])
+		})
+		sorted := make([]string, len(order))
+		sortedLabels := make([]string, len(order))
+		for i, j := range order {
+			sorted[i], sortedLabels[i] = p.categories[j], labels[j]
+			index[p.categories[j]] = i
+		}
+		p.categories, labels = sorted, sortedLabels
+	}
+
+	for i, s := range all {
+		for _, pt := range s.Points {
+			if y, ok := models.ChartY(pt); ok {
+				x := float64(index[p.xKey(pt[0])])
+				p.series[i].points = append(p.series[i].points, point{x, y})
+			}
+		}
+	}
+
+	p.xMin, p.xMax = -0.5, float64(len(p.categories))-0.5
+	step := 1
+	if width := p.width - 120; width > 0 {
+		// Leave room for the widest label between shown ticks
+		step = max(1, int(math.Ceil(float64(len(labels))*tickWidth(labels)/width)))
+	}
+	for i := 0; i < len(labels); i += step {
+		p.xTicks = append(p.xTicks, tick{float64(i), labels[i]})
+	}
+}
+
+// place puts the points of a number or time axis at their value
+func (p *chartPlot) place(all []models.ChartSeries) {
+	p.xMin, p.xMax = math.Inf(1), math.Inf(-1)
+	for i, s := range all {
+		for _, pt := range s.Points {
+			x, okX := p.chart.XAxisType.ParseX(pt[0])
+			y, okY := models.ChartY(pt)
+			if !okX || !okY {
+				continue
+			}
+			p.series[i].points = append(p.series[i].points, point{x, y})
+			p.xMin, p.xMax = min(p.xMin, x), max(p.xMax, x)
+		}
+		slices.SortStableFunc(p.series[i].points, func(a, b point) int {
+			return compareFloat(a.x, b.x)
+		})
+	}
+	if p.xMin > p.xMax {
+		p.xMin, p.xMax = 0, 1
+	}
+
+	if p.chart.XAxisType == models.AxisTime {
+		p.xTicks = timeTicks(p.xMin, p.xMax)
+		return
+	}
+	values, step := niceTicks(p.xMin, p.xMax)
+	for _, v := range values {
+		if v >= p.xMin && v <= p.xMax {
+			p.xTicks = append(p.xTicks, tick{v, formatNumber(v, step)})
+		}
+	}
+}
+
+// scaleY rounds the Y range out to tick values. Bars always start at zero.
+func (p *chartPlot) scaleY() {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range p.series {
+		for _, pt := range s.points {
+			lo, hi = min(lo, pt.y), max(hi, pt.y)
+		}
+	}
+	switch {
+	case lo > hi:
+		lo, hi = 0, 1
+	case p.bars:
+		lo, hi = min(lo, 0), max(hi, 0)
+	}
+
+	values, step := niceTicks(lo, hi)
+	p.yMin, p.yMax = values[0], values[len(values)-1]
+	for _, v := range values {
+		p.yTicks = append(p.yTicks, tick{v, formatNumber(v, step)})
+	}
+}
+
+func (p *chartPlot) layout() {
+	p.top = 16
+	if p.chart.Title != "" {
+		p.top += 24
+	}
+	if p.legend {
+		p.top += 20
+	}
+
+	var labels []string
+	for _, t := range p.yTicks {
+		labels = append(labels, t.label)
+	}
+	p.left = 28 + tickWidth(labels)
+	p.right = p.width - 20
+	p.bottom = p.height - 44
+}
+
+// px and py convert plot values to pixels
+func (p *chartPlot) px(x float64) float64 {
+	if p.xMax == p.xMin {
+		return (p.left + p.right) / 2
+	}
+	return p.left + (x-p.xMin)/(p.xMax-p.xMin)*(p.right-p.left)
+}
+
+func (p *chartPlot) py(y float64) float64 {
+	return p.bottom - (y-p.yMin)/(p.yMax-p.yMin)*(p.bottom-p.top)
+}
+
+func (p *chartPlot) draw(c canvas) {
+	c.rect(0, 0, p.width, p.height, colorBackground)
+	if p.chart.Title != "" {
+		c.text(p.width/2, 30, p.chart.Title, titleSize, anchorMiddle, colorText, false)
+	}
+	if p.legend {
+		p.drawLegend(c)
+	}
+
+	for _, t := range p.yTicks {
+		y := p.py(t.value)
+		c.line(p.left, y, p.right, y, colorGrid, 1)
+		c.text(p.left-6, y+4, t.label, tickSize, anchorEnd, colorText, false)
+	}
+	for _, t := range p.xTicks {
+		x := p.px(t.value)
+		c.line(x, p.bottom, x, p.bottom+4, colorAxis, 1)
+		// Keep labels at the edges inside the image
+		half := textWidth(t.label, tickSize) / 2
+		x = min(max(x, half+2), p.width-half-2)
+		c.text(x, p.bottom+16, t.label, tickSize, anchorMiddle, colorText, false)
+	}
+	c.line(p.left, p.top, p.left, p.bottom, colorAxis, 1)
+	c.line(p.left, p.bottom, p.right, p.bottom, colorAxis, 1)
+	c.text((p.left+p.right)/2, p.height-8, p.chart.XAxis, labelSize, anchorMiddle, colorText, false)
+	c.text(16, (p.top+p.bottom)/2, p.chart.YAxis, labelSize, anchorMiddle, colorText, true)
+
+	empty := true
+	for _, s := range p.series {
+		empty = empty && len(s.points) == 0
+	}
+	switch {
+	case empty:
+		c.text((p.left+p.right)/2, (p.top+p.bottom)/2, "No data", labelSize, anchorMiddle, colorAxis, false)
+	case p.bars:
+		p.drawBars(c)
+	default:
+		p.drawLines(c)
+	}
+}
+
+func (p *chartPlot) drawLines(c canvas) {
+	for i, s := range p.series {
+		points := make([]point, len(s.points))
+		for j, pt := range s.points {
+			points[j] = point{p.px(pt.x), p.py(pt.y)}
+		}
+		switch len(points) {
+		case 0:
+		case 1:
+			c.rect(points[0].x-2, points[0].y-2, 4, 4, seriesColor(i))
+		default:
+			c.polyline(points, seriesColor(i), 2)
+		}
+	}
+}
+
+// drawBars draws the series side by side within each category
+func (p *chartPlot) drawBars(c canvas) {
+	band := (p.right - p.left) / float64(len(p.categories))
+	group := band * 0.8
+	width := group / float64(len(p.series))
+	base := p.py(min(max(0, p.yMin), p.yMax))
+
+	for i, s := range p.series {
+		for _, pt := range s.points {
+			x := p.px(pt.x) - group/2 + float64(i)*width
+			y := p.py(pt.y)
+			c.rect(x, min(y, base), max(width-1, 1), math.Abs(base-y), seriesColor(i))
+		}
+	}
+}
+
+func (p *chartPlot) drawLegend(c canvas) {
+	x, y := p.left, p.top-12
+	for i, s := range p.series {
+		name := s.name
+		if name == "" {
+			name = "Series " + strconv.Itoa(i+1)
+		}
+		next := x + 14 + textWidth(name, tickSize) + 16
+		if next > p.right && x > p.left {
+			break
+		}
+		c.rect(x, y-9, 10, 10, seriesColor(i))
+		c.text(x+14, y, name, tickSize, anchorStart, colorText, false)
+		x = next
+	}
+}
+
+// xKey identifies the category of an X value
+func (p *chartPlot) xKey(x any) string {
+	if v, ok := p.chart.XAxisType.ParseX(x); ok {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(x)
+}
+
+// xLabel formats an X value for a tick label
+func (p *chartPlot) xLabel(x any) string {
+	switch p.chart.XAxisType {
+	case models.AxisNumber, models.AxisTime:
+		if v, ok := p.chart.XAxisType.ParseX(x); ok {
+			if p.chart.XAxisType == models.AxisTime {
+				return formatTime(v, 0)
+			}
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	return shorten(fmt.Sprint(x))
+}
+
+// niceTicks returns about five evenly spaced round values covering lo..hi,
+// and the step between them
+func niceTicks(lo, hi float64) ([]float64, float64) {
+	if lo == hi {
+		lo, hi = lo-1, hi+1
+	}
+	step := niceStep((hi - lo) / 5)
+	start := math.Floor(lo/step) * step
+	end := math.Ceil(hi/step) * step
+
+	var values []float64
+	for i := 0; ; i++ {
+		v := start + float64(i)*step
+		values = append(values, v)
+		if v >= end-step/2 {
+			break
+		}
+	}
+	return values, step
+}
+
+// niceStep rounds a step up to 1, 2 or 5 times a power of ten
+func niceStep(raw float64) float64 {
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// formatNumber prints v with as many decimals as step needs
+func formatNumber(v, step float64) string {
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step)))
+	}
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// timeTicks spreads five ticks over a time range given in Unix seconds
+func timeTicks(lo, hi float64) []tick {
+	if lo == hi {
+		return []tick{{lo, formatTime(lo, 0)}}
+	}
+	const n = 5
+	ticks := make([]tick, n)
+	for i := range ticks {
+		v := lo + (hi-lo)*float64(i)/(n-1)
+		ticks[i] = tick{v, formatTime(v, hi-lo)}
+	}
+	return ticks
+}
+
+// formatTime prints Unix seconds as a date, with the time of day when the
+// span is shorter than a few days or the value is not at midnight
+func formatTime(v, span float64) string {
+	at := time.Unix(0, int64(v*float64(time.Second))).UTC()
+	if span >= 3*24*3600 || (span == 0 && at.Equal(at.Truncate(24*time.Hour))) {
+		return at.Format(time.DateOnly)
+	}
+	return at.Format("2006-01-02 15:04")
+}
+
+func shorten(s string) string {
+	r := []rune(s)
+	if len(r) <= maxTickLabel {
+		return s
+	}
+	return string(r[:maxTickLabel-2]) + ".."
+}
+
+// textWidth estimates the width of text in pixels
+func textWidth(s string, size float64) float64 {
+	return float64(len([]rune(s))) * size * 0.6
+}
+
+func tickWidth(labels []string) float64 {
+	widest := 0.0
+	for _, l := range labels {
+		widest = max(widest, textWidth(l, tickSize))
+	}
+	return widest + 8
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
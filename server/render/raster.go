@@ -0,0 +1,98 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"unicode"
+)
+
+// rasterCanvas draws on an RGBA image. Text uses the built-in bitmap font,
+// which only has upper case letters.
+type rasterCanvas struct {
+	img *image.RGBA
+}
+
+func newRasterCanvas(width, height int) *rasterCanvas {
+	return &rasterCanvas{img: image.NewRGBA(image.Rect(0, 0, width, height))}
+}
+
+func (c *rasterCanvas) rect(x, y, w, h float64, col color.RGBA) {
+	r := image.Rect(round(x), round(y), round(x+w), round(y+h))
+	draw.Draw(c.img, r, image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+// line steps along the longer axis and stamps a square of the line width
+func (c *rasterCanvas) line(x1, y1, x2, y2 float64, col color.RGBA, width float64) {
+	steps := max(math.Abs(x2-x1), math.Abs(y2-y1))
+	size := max(1, round(width))
+	for i := 0.0; i <= steps; i++ {
+		t := 0.0
+		if steps > 0 {
+			t = i / steps
+		}
+		x := round(x1+(x2-x1)*t) - size/2
+		y := round(y1+(y2-y1)*t) - size/2
+		c.fill(x, y, size, size, col)
+	}
+}
+
+func (c *rasterCanvas) polyline(points []point, col color.RGBA, width float64) {
+	for i := 1; i < len(points); i++ {
+		c.line(points[i-1].x, points[i-1].y, points[i].x, points[i].y, col, width)
+	}
+}
+
+func (c *rasterCanvas) text(x, y float64, s string, size float64, anchor textAnchor, col color.RGBA, vertical bool) {
+	scale := max(1, int(size/8))
+	runes := []rune(s)
+	width := len(runes)*glyphAdvance*scale - scale
+
+	// u runs along the text and v downwards from the baseline
+	u := 0
+	switch anchor {
+	case anchorMiddle:
+		u = -width / 2
+	case anchorEnd:
+		u = -width
+	}
+	ox, oy := round(x), round(y)
+	for _, r := range runes {
+		glyph := lookupGlyph(r)
+		for row, bits := range glyph {
+			for column := range glyphWidth {
+				if bits&(1<<(glyphWidth-1-column)) == 0 {
+					continue
+				}
+				gu := u + column*scale
+				gv := (row - glyphHeight) * scale
+				if vertical {
+					c.fill(ox+gv, oy-gu-scale, scale, scale, col)
+				} else {
+					c.fill(ox+gu, oy+gv, scale, scale, col)
+				}
+			}
+		}
+		u += glyphAdvance * scale
+	}
+}
+
+func (c *rasterCanvas) fill(x, y, w, h int, col color.RGBA) {
+	for py := y; py < y+h; py++ {
+		for px := x; px < x+w; px++ {
+			c.img.SetRGBA(px, py, col)
+		}
+	}
+}
+
+func lookupGlyph(r rune) [glyphHeight]uint8 {
+	if g, ok := font[unicode.ToUpper(r)]; ok {
+		return g
+	}
+	return font['?']
+}
+
+func round(v float64) int {
+	return int(math.Round(v))
+}
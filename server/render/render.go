@@ -0,0 +1,75 @@
+// Package render draws assets as images. Importing it attaches its renderers
+// to the asset kinds registered in models.
+package render
+
+import (
+	"image/color"
+
+	"favourite_assets/server/models"
+)
+
+const (
+	FormatSVG = "svg"
+	FormatPNG = "png"
+
+	StyleLine = "line"
+	StyleBar  = "bar"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{FormatSVG, FormatPNG}
+
+// ContentType returns the media type of a supported format
+func ContentType(format string) string {
+	if format == FormatPNG {
+		return "image/png"
+	}
+	return "image/svg+xml"
+}
+
+func init() {
+	models.SetAssetRenderer(models.AssetChart, renderChart)
+}
+
+// textAnchor is the horizontal alignment of text relative to its position
+type textAnchor int
+
+const (
+	anchorStart textAnchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+type point struct{ x, y float64 }
+
+// canvas is the drawing surface shared by the SVG and PNG outputs. Positions
+// are in pixels from the top left corner; text is positioned by its baseline.
+type canvas interface {
+	rect(x, y, w, h float64, c color.RGBA)
+	line(x1, y1, x2, y2 float64, c color.RGBA, width float64)
+	polyline(points []point, c color.RGBA, width float64)
+	// text draws s; vertical text reads bottom to top and is anchored on y
+	text(x, y float64, s string, size float64, anchor textAnchor, c color.RGBA, vertical bool)
+}
+
+var (
+	colorBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	colorText       = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	colorAxis       = color.RGBA{0x55, 0x55, 0x55, 0xff}
+	colorGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+
+	palette = []color.RGBA{
+		{0x1f, 0x77, 0xb4, 0xff},
+		{0xff, 0x7f, 0x0e, 0xff},
+		{0x2c, 0xa0, 0x2c, 0xff},
+		{0xd6, 0x27, 0x28, 0xff},
+		{0x94, 0x67, 0xbd, 0xff},
+		{0x8c, 0x56, 0x4b, 0xff},
+		{0xe3, 0x77, 0xc2, 0xff},
+		{0x7f, 0x7f, 0x7f, 0xff},
+	}
+)
+
+func seriesColor(i int) color.RGBA {
+	return palette[i%len(palette)]
+}
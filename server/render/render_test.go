@@ -0,0 +1,135 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+var testChart = &models.Chart{
+	Title:     "Revenue & costs",
+	XAxis:     "month",
+	YAxis:     "amount",
+	XAxisType: models.AxisCategory,
+	Series: []models.ChartSeries{
+		{Name: "revenue", Points: [][2]any{{"Jan", 10.0}, {"Feb", 12.5}, {"Mar", -3.0}}},
+		{Name: "costs", Points: [][2]any{{"Jan", 4.0}, {"Mar", 6.0}}},
+	},
+}
+
+// svgElements parses an SVG document and counts its elements by name, along
+// with the text they hold
+func svgElements(t *testing.T, data []byte) (map[string]int, []string) {
+	t.Helper()
+	counts := map[string]int{}
+	var texts []string
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return counts, texts
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			counts[tok.Name.Local]++
+		case xml.CharData:
+			if s := strings.TrimSpace(string(tok)); s != "" {
+				texts = append(texts, s)
+			}
+		}
+	}
+}
+
+func TestRenderChartSVG(t *testing.T) {
+	tests := []struct {
+		style           string
+		bars, polylines int
+	}{
+		// Category charts default to bars, one per point
+		{"", 5, 0},
+		{StyleBar, 5, 0},
+		{StyleLine, 0, 2},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		opts := models.RenderOptions{Format: FormatSVG, Width: 400, Height: 300, Style: tt.style}
+		if err := renderChart(testChart, opts, &buf); err != nil {
+			t.Fatalf("%q: %v", tt.style, err)
+		}
+		if !strings.HasPrefix(buf.String(), `<svg xmlns="http://www.w3.org/2000/svg" width="400" height="300"`) {
+			t.Errorf("%q: got %.80q, want a 400x300 SVG", tt.style, buf.String())
+		}
+
+		counts, texts := svgElements(t, buf.Bytes())
+		// The background and the two legend swatches are rects too
+		if got := counts["rect"] - 3; got != tt.bars {
+			t.Errorf("%q: got %d bars, want %d", tt.style, got, tt.bars)
+		}
+		if counts["polyline"] != tt.polylines {
+			t.Errorf("%q: got %d lines, want %d", tt.style, counts["polyline"], tt.polylines)
+		}
+		for _, want := range []string{"Revenue & costs", "month", "amount", "revenue", "costs", "Jan", "Feb", "Mar"} {
+			if !strings.Contains(strings.Join(texts, "\n"), want) {
+				t.Errorf("%q: got texts %q, want %q among them", tt.style, texts, want)
+			}
+		}
+	}
+}
+
+func TestRenderChartPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderChart(testChart, models.RenderOptions{Format: FormatPNG, Width: 320, Height: 200}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != 320 || size.Y != 200 {
+		t.Fatalf("got a %v image, want 320x200", size)
+	}
+
+	// Something other than the background is drawn in the first series colour
+	found := false
+	want := seriesColor(0)
+	for y := 0; y < 200 && !found; y++ {
+		for x := 0; x < 320 && !found; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			found = uint8(r>>8) == want.R && uint8(g>>8) == want.G && uint8(b>>8) == want.B
+		}
+	}
+	if !found {
+		t.Error("got no pixel in the first series colour")
+	}
+}
+
+func TestRenderChartEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	chart := &models.Chart{Title: "Nothing yet", XAxis: "x", YAxis: "y"}
+	if err := renderChart(chart, models.RenderOptions{Format: FormatSVG, Width: 200, Height: 200}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, texts := svgElements(t, buf.Bytes()); !strings.Contains(strings.Join(texts, "\n"), "No data") {
+		t.Errorf("got texts %q, want No data", texts)
+	}
+}
+
+func TestRenderChartErrors(t *testing.T) {
+	opts := models.RenderOptions{Format: "gif", Width: 200, Height: 200}
+	if err := renderChart(testChart, opts, io.Discard); err != errors.ErrUnsupportedFormat {
+		t.Errorf("got %v for a gif, want ErrUnsupportedFormat", err)
+	}
+	opts.Format = FormatSVG
+	if err := renderChart(&models.Insight{Text: "not a chart"}, opts, io.Discard); err != errors.ErrAssetNotRenderable {
+		t.Errorf("got %v for an insight, want ErrAssetNotRenderable", err)
+	}
+}
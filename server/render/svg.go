@@ -0,0 +1,75 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+)
+
+// svgCanvas collects SVG elements in a buffer
+type svgCanvas struct {
+	width, height int
+	buf           bytes.Buffer
+}
+
+func newSVGCanvas(width, height int) *svgCanvas {
+	return &svgCanvas{width: width, height: height}
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, col color.RGBA) {
+	fmt.Fprintf(&c.buf, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+		num(x), num(y), num(w), num(h), hex(col))
+}
+
+func (c *svgCanvas) line(x1, y1, x2, y2 float64, col color.RGBA, width float64) {
+	fmt.Fprintf(&c.buf, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="%s"/>`+"\n",
+		num(x1), num(y1), num(x2), num(y2), hex(col), num(width))
+}
+
+func (c *svgCanvas) polyline(points []point, col color.RGBA, width float64) {
+	c.buf.WriteString(`<polyline fill="none" stroke-linejoin="round" points="`)
+	for i, p := range points {
+		if i > 0 {
+			c.buf.WriteByte(' ')
+		}
+		c.buf.WriteString(num(p.x) + "," + num(p.y))
+	}
+	fmt.Fprintf(&c.buf, `" stroke="%s" stroke-width="%s"/>`+"\n", hex(col), num(width))
+}
+
+func (c *svgCanvas) text(x, y float64, s string, size float64, anchor textAnchor, col color.RGBA, vertical bool) {
+	if s == "" {
+		return
+	}
+	fmt.Fprintf(&c.buf, `<text x="%s" y="%s" font-size="%s" fill="%s" text-anchor="%s"`,
+		num(x), num(y), num(size), hex(col), [...]string{"start", "middle", "end"}[anchor])
+	if vertical {
+		fmt.Fprintf(&c.buf, ` transform="rotate(-90 %s %s)"`, num(x), num(y))
+	}
+	c.buf.WriteByte('>')
+	xml.EscapeText(&c.buf, []byte(s))
+	c.buf.WriteString("</text>\n")
+}
+
+// WriteTo writes the complete SVG document
+func (c *svgCanvas) WriteTo(w io.Writer) (int64, error) {
+	var doc bytes.Buffer
+	fmt.Fprintf(&doc, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`+"\n",
+		c.width, c.height, c.width, c.height)
+	doc.Write(c.buf.Bytes())
+	doc.WriteString("</svg>\n")
+	return doc.WriteTo(w)
+}
+
+// num prints a coordinate rounded to hundredths of a pixel
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -3,10 +3,12 @@ package repositories
 import (
 	"hash/fnv"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"favourite_assets/server/models"
 	"favourite_assets/server/errors"
+	"favourite_assets/server/search"
 )
 
 const assetShardCount = 16
@@ -16,12 +18,15 @@ type assetShard struct {
 	assets map[uuid.UUID]models.Asset
 }
 
-type AssetRepository struct {
+// MemoryAssetRepository keeps assets in sharded in-memory maps
+type MemoryAssetRepository struct {
 	shards [assetShardCount]*assetShard
+	// index is updated under the shard lock, so it sees writes in order
+	index *search.Index
 }
 
-func NewAssetRepository() *AssetRepository {
-	r := &AssetRepository{}
+func NewMemoryAssetRepository() *MemoryAssetRepository {
+	r := &MemoryAssetRepository{index: search.NewIndex()}
 	for i := 0; i < assetShardCount; i++ {
 		r.shards[i] = &assetShard{
 			assets: make(map[uuid.UUID]models.Asset),
@@ -30,13 +35,13 @@ func NewAssetRepository() *AssetRepository {
 	return r
 }
 
-func (r *AssetRepository) pickShard(assetID uuid.UUID) *assetShard {
+func (r *MemoryAssetRepository) pickShard(assetID uuid.UUID) *assetShard {
 	h := fnv.New32a()
 	h.Write(assetID[:])
 	return r.shards[uint(h.Sum32())%assetShardCount]
 }
 
-func (r *AssetRepository) Create(asset models.Asset) error {
+func (r *MemoryAssetRepository) Create(asset models.Asset) error {
 	shard := r.pickShard(asset.GetID())
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
@@ -46,35 +51,63 @@ func (r *AssetRepository) Create(asset models.Asset) error {
 	}
 
 	shard.assets[asset.GetID()] = asset
+	indexAsset(r.index, asset)
 	return nil
 }
 
-func (r *AssetRepository) GetByID(id uuid.UUID) (models.Asset, error) {
+func (r *MemoryAssetRepository) GetByID(id uuid.UUID) (models.Asset, error) {
 	shard := r.pickShard(id)
 	shard.mu.RLock()
 	defer shard.mu.RUnlock()
 
 	asset, ok := shard.assets[id]
-	if !ok {
+	if !ok || inTrash(asset) {
 		return nil, errors.ErrAssetNotFound
 	}
 	return asset, nil
 }
 
-func (r *AssetRepository) Update(asset models.Asset) error {
+func (r *MemoryAssetRepository) GetByIDs(ids []uuid.UUID) (map[uuid.UUID]models.Asset, error) {
+	// Group by shard so every shard is locked at most once
+	byShard := make(map[*assetShard][]uuid.UUID)
+	for _, id := range ids {
+		shard := r.pickShard(id)
+		byShard[shard] = append(byShard[shard], id)
+	}
+
+	result := make(map[uuid.UUID]models.Asset, len(ids))
+	for shard, shardIDs := range byShard {
+		shard.mu.RLock()
+		for _, id := range shardIDs {
+			if asset, ok := shard.assets[id]; ok && !inTrash(asset) {
+				result[id] = asset
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return result, nil
+}
+
+func (r *MemoryAssetRepository) Update(asset models.Asset) error {
 	shard := r.pickShard(asset.GetID())
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
-	if _, ok := shard.assets[asset.GetID()]; !ok {
+	stored, ok := shard.assets[asset.GetID()]
+	if !ok || inTrash(stored) {
 		return errors.ErrAssetNotFound
 	}
+	if stored.Base().Version != asset.Base().Version {
+		return errors.ErrPreconditionFailed
+	}
 
+	asset.Base().Version++
 	shard.assets[asset.GetID()] = asset
+	indexAsset(r.index, asset)
 	return nil
 }
 
-func (r *AssetRepository) Delete(id uuid.UUID) error {
+func (r *MemoryAssetRepository) Delete(id uuid.UUID) error {
 	shard := r.pickShard(id)
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
@@ -84,18 +117,124 @@ func (r *AssetRepository) Delete(id uuid.UUID) error {
 	}
 
 	delete(shard.assets, id)
+	r.index.Remove(id)
 	return nil
 }
 
-func (r *AssetRepository) ListAll() []models.Asset {
+func (r *MemoryAssetRepository) ListAll() ([]models.Asset, error) {
+	return r.list(func(asset models.Asset) bool { return !inTrash(asset) }), nil
+}
+
+func (r *MemoryAssetRepository) ListTrash() ([]models.Asset, error) {
+	return r.list(inTrash), nil
+}
+
+func (r *MemoryAssetRepository) list(keep func(models.Asset) bool) []models.Asset {
 	result := []models.Asset{}
 	for i := 0; i < assetShardCount; i++ {
 		shard := r.shards[i]
 		shard.mu.RLock()
 		for _, asset := range shard.assets {
-			result = append(result, asset)
+			if keep(asset) {
+				result = append(result, asset)
+			}
 		}
 		shard.mu.RUnlock()
 	}
 	return result
 }
+
+func (r *MemoryAssetRepository) Trash(id uuid.UUID, deletedBy string, at time.Time) error {
+	return r.setTrash(id, false, func(base *models.BaseAsset) {
+		base.DeletedAt = &at
+		base.DeletedBy = deletedBy
+	})
+}
+
+func (r *MemoryAssetRepository) Restore(id uuid.UUID) error {
+	return r.setTrash(id, true, func(base *models.BaseAsset) {
+		base.DeletedAt = nil
+		base.DeletedBy = ""
+	})
+}
+
+func (r *MemoryAssetRepository) GetTrashed(id uuid.UUID) (models.Asset, error) {
+	asset, ok := r.lookup(id)
+	if !ok || !inTrash(asset) {
+		return nil, errors.ErrAssetNotFound
+	}
+	return asset, nil
+}
+
+// setTrash moves an asset into or out of the trash. The stored value is
+// replaced with a changed copy, as readers may hold the old one.
+func (r *MemoryAssetRepository) setTrash(id uuid.UUID, trashed bool, fn func(base *models.BaseAsset)) error {
+	shard := r.pickShard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	stored, ok := shard.assets[id]
+	if !ok || inTrash(stored) != trashed {
+		return errors.ErrAssetNotFound
+	}
+	asset, err := models.CloneAsset(stored)
+	if err != nil {
+		return err
+	}
+	fn(asset.Base())
+
+	shard.assets[id] = asset
+	if inTrash(asset) {
+		r.index.Remove(id)
+	} else {
+		indexAsset(r.index, asset)
+	}
+	return nil
+}
+
+// lookup returns an asset whether or not it is in the trash, for the journal
+func (r *MemoryAssetRepository) lookup(id uuid.UUID) (models.Asset, bool) {
+	shard := r.pickShard(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	asset, ok := shard.assets[id]
+	return asset, ok
+}
+
+func (r *MemoryAssetRepository) listAll() []models.Asset {
+	return r.list(func(models.Asset) bool { return true })
+}
+
+// restore puts an asset back as-is, used when replaying the journal
+func (r *MemoryAssetRepository) restore(asset models.Asset) {
+	shard := r.pickShard(asset.GetID())
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.assets[asset.GetID()] = asset
+	if inTrash(asset) {
+		r.index.Remove(asset.GetID())
+	} else {
+		indexAsset(r.index, asset)
+	}
+}
+
+func (r *MemoryAssetRepository) remove(id uuid.UUID) {
+	shard := r.pickShard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	delete(shard.assets, id)
+	r.index.Remove(id)
+}
+
+func (r *MemoryAssetRepository) Search(q search.Query) ([]search.Hit, error) {
+	return r.index.Search(q), nil
+}
+
+func inTrash(asset models.Asset) bool {
+	return asset.Base().DeletedAt != nil
+}
+
+// indexAsset puts the searchable text of an asset in the index
+func indexAsset(index *search.Index, asset models.Asset) {
+	index.Put(asset.GetID(), string(asset.GetType()), models.AssetSearchFields(asset))
+}
@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"favourite_assets/server/models"
+	"favourite_assets/server/search"
+)
+
+func searchHits(t *testing.T, r *MemoryAssetRepository, text string) int {
+	t.Helper()
+	hits, err := r.Search(search.Query{Text: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(hits)
+}
+
+func TestAssetSearchIndex(t *testing.T) {
+	r := NewMemoryAssetRepository()
+	revenue, churn := newChart("Revenue"), newChart("Churn")
+	for _, chart := range []*models.Chart{revenue, churn} {
+		if err := r.Create(chart); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := searchHits(t, r, "revenue"); got != 1 || r.index.Len() != 2 {
+		t.Fatalf("got %d hits in %d documents, want 1 in 2", got, r.index.Len())
+	}
+
+	// An update replaces the indexed text
+	revenue.Title = "Turnover"
+	if err := r.Update(revenue); err != nil {
+		t.Fatal(err)
+	}
+	if searchHits(t, r, "revenue") != 0 || searchHits(t, r, "turnover") != 1 {
+		t.Error("search still finds the old title after the update")
+	}
+
+	if err := r.Trash(revenue.ID, "admin-sub", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if searchHits(t, r, "turnover") != 0 || r.index.Len() != 1 {
+		t.Errorf("got %d documents, want the trashed asset out of the index", r.index.Len())
+	}
+	if err := r.Restore(revenue.ID); err != nil {
+		t.Fatal(err)
+	}
+	if searchHits(t, r, "turnover") != 1 || r.index.Len() != 2 {
+		t.Errorf("got %d documents, want the restored asset back in the index", r.index.Len())
+	}
+
+	if err := r.Delete(churn.ID); err != nil {
+		t.Fatal(err)
+	}
+	if searchHits(t, r, "churn") != 0 || r.index.Len() != 1 {
+		t.Errorf("got %d documents, want the deleted asset out of the index", r.index.Len())
+	}
+
+	// Journal replay indexes live assets and drops trashed ones
+	trashed := newChart("Churn")
+	at := time.Now()
+	trashed.DeletedAt = &at
+	r.restore(trashed)
+	r.restore(newChart("Retention"))
+	if searchHits(t, r, "churn") != 0 || searchHits(t, r, "retention") != 1 {
+		t.Error("got replayed assets indexed by their content, want by their trash state")
+	}
+	r.remove(revenue.ID)
+	if searchHits(t, r, "turnover") != 0 || r.index.Len() != 1 {
+		t.Errorf("got %d documents after replaying a delete, want 1", r.index.Len())
+	}
+}
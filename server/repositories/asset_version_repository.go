@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+// MemoryAssetVersionRepository keeps asset versions in memory. Versions are
+// only written on asset changes, so a single lock is enough.
+type MemoryAssetVersionRepository struct {
+	mu sync.RWMutex
+	// byAsset holds the versions of each asset, oldest first
+	byAsset map[uuid.UUID][]*models.AssetVersion
+	byID    map[uuid.UUID]*models.AssetVersion
+}
+
+func NewMemoryAssetVersionRepository() *MemoryAssetVersionRepository {
+	return &MemoryAssetVersionRepository{
+		byAsset: make(map[uuid.UUID][]*models.AssetVersion),
+		byID:    make(map[uuid.UUID]*models.AssetVersion),
+	}
+}
+
+// cloneVersion copies the snapshot, so callers never share it with the store
+func cloneVersion(v *models.AssetVersion) (*models.AssetVersion, error) {
+	asset, err := models.CloneAsset(v.Asset)
+	if err != nil {
+		return nil, err
+	}
+	clone := *v
+	clone.Asset = asset
+	return &clone, nil
+}
+
+func (r *MemoryAssetVersionRepository) Add(version *models.AssetVersion) error {
+	stored, err := cloneVersion(version)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.byID[version.ID]; exists {
+		return errors.ErrConflict
+	}
+	for _, v := range r.byAsset[version.AssetID] {
+		if v.Version == version.Version {
+			return errors.ErrConflict
+		}
+	}
+	r.put(stored)
+	return nil
+}
+
+// put inserts a version keeping the asset's versions in order; the caller
+// holds the lock
+func (r *MemoryAssetVersionRepository) put(version *models.AssetVersion) {
+	r.delete(version.ID)
+	versions := append(r.byAsset[version.AssetID], version)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	r.byAsset[version.AssetID] = versions
+	r.byID[version.ID] = version
+}
+
+func (r *MemoryAssetVersionRepository) delete(id uuid.UUID) {
+	version, ok := r.byID[id]
+	if !ok {
+		return
+	}
+	delete(r.byID, id)
+	versions := r.byAsset[version.AssetID]
+	for i, v := range versions {
+		if v.ID == id {
+			versions = append(versions[:i:i], versions[i+1:]...)
+			break
+		}
+	}
+	if len(versions) == 0 {
+		delete(r.byAsset, version.AssetID)
+	} else {
+		r.byAsset[version.AssetID] = versions
+	}
+}
+
+func (r *MemoryAssetVersionRepository) List(assetID uuid.UUID) ([]*models.AssetVersion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*models.AssetVersion, 0, len(r.byAsset[assetID]))
+	for _, v := range r.byAsset[assetID] {
+		clone, err := cloneVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, clone)
+	}
+	return result, nil
+}
+
+func (r *MemoryAssetVersionRepository) Get(assetID uuid.UUID, version int) (*models.AssetVersion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, v := range r.byAsset[assetID] {
+		if v.Version == version {
+			return cloneVersion(v)
+		}
+	}
+	return nil, errors.ErrVersionNotFound
+}
+
+func (r *MemoryAssetVersionRepository) Delete(id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.byID[id]; !ok {
+		return errors.ErrVersionNotFound
+	}
+	r.delete(id)
+	return nil
+}
+
+func (r *MemoryAssetVersionRepository) DeleteByAsset(assetID uuid.UUID) error {
+	r.deleteByAsset(assetID)
+	return nil
+}
+
+// deleteByAsset returns the IDs of the versions it deleted
+func (r *MemoryAssetVersionRepository) deleteByAsset(assetID uuid.UUID) []uuid.UUID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted []uuid.UUID
+	for _, v := range r.byAsset[assetID] {
+		delete(r.byID, v.ID)
+		deleted = append(deleted, v.ID)
+	}
+	delete(r.byAsset, assetID)
+	return deleted
+}
+
+// getByID, restore and remove serve the journal, which keys versions by their own ID
+func (r *MemoryAssetVersionRepository) getByID(id uuid.UUID) (*models.AssetVersion, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := r.byID[id]
+	return v, ok
+}
+
+func (r *MemoryAssetVersionRepository) restore(version *models.AssetVersion) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.put(version)
+}
+
+func (r *MemoryAssetVersionRepository) remove(id uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delete(id)
+}
+
+func (r *MemoryAssetVersionRepository) listAll() []*models.AssetVersion {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]*models.AssetVersion, 0, len(r.byID))
+	for _, v := range r.byID {
+		result = append(result, v)
+	}
+	return result
+}
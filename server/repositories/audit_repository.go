@@ -0,0 +1,95 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+// MemoryAuditRepository keeps the audit log in memory, in the order it was
+// written
+type MemoryAuditRepository struct {
+	mu      sync.RWMutex
+	entries []*models.AuditEntry
+	byID    map[uuid.UUID]*models.AuditEntry
+}
+
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{byID: make(map[uuid.UUID]*models.AuditEntry)}
+}
+
+func (r *MemoryAuditRepository) Append(entry *models.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.byID[entry.ID]; exists {
+		return errors.ErrConflict
+	}
+	r.put(entry)
+	return nil
+}
+
+// put keeps entries sorted by time; the caller holds the lock
+func (r *MemoryAuditRepository) put(entry *models.AuditEntry) {
+	stored := *entry
+	i := sort.Search(len(r.entries), func(i int) bool { return r.entries[i].Time.After(stored.Time) })
+	r.entries = append(r.entries, nil)
+	copy(r.entries[i+1:], r.entries[i:])
+	r.entries[i] = &stored
+	r.byID[stored.ID] = &stored
+}
+
+func (r *MemoryAuditRepository) Query(filter models.AuditFilter) ([]*models.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []*models.AuditEntry{}
+	for _, entry := range r.entries {
+		if filter.Match(entry) {
+			clone := *entry
+			result = append(result, &clone)
+		}
+	}
+	return result, nil
+}
+
+// getByID, restore and remove serve the journal
+func (r *MemoryAuditRepository) getByID(id uuid.UUID) (*models.AuditEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.byID[id]
+	return entry, ok
+}
+
+func (r *MemoryAuditRepository) restore(entry *models.AuditEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.byID[entry.ID]; !exists {
+		r.put(entry)
+	}
+}
+
+func (r *MemoryAuditRepository) remove(id uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byID[id]; !ok {
+		return
+	}
+	delete(r.byID, id)
+	for i, entry := range r.entries {
+		if entry.ID == id {
+			r.entries = append(r.entries[:i], r.entries[i+1:]...)
+			break
+		}
+	}
+}
+
+func (r *MemoryAuditRepository) listAll() []*models.AuditEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*models.AuditEntry(nil), r.entries...)
+}
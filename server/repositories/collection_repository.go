@@ -0,0 +1,261 @@
+package repositories
+
+import (
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"favourite_assets/server/models"
+	"favourite_assets/server/errors"
+)
+
+const collectionShardCount = 16
+
+type collectionShard struct {
+	mu          sync.RWMutex
+	collections map[uuid.UUID]*models.Collection
+}
+
+// MemoryCollectionRepository keeps collections in sharded in-memory maps
+type MemoryCollectionRepository struct {
+	shards [collectionShardCount]*collectionShard
+}
+
+// NewMemoryCollectionRepository initializes the shards
+func NewMemoryCollectionRepository() *MemoryCollectionRepository {
+	r := &MemoryCollectionRepository{}
+	for i := 0; i < collectionShardCount; i++ {
+		r.shards[i] = &collectionShard{
+			collections: make(map[uuid.UUID]*models.Collection),
+		}
+	}
+	return r
+}
+
+// pickShard selects a shard based on collection ID
+func (r *MemoryCollectionRepository) pickShard(id uuid.UUID) *collectionShard {
+	h := fnv.New32a()
+	h.Write(id[:])
+	return r.shards[uint(h.Sum32())%collectionShardCount]
+}
+
+// cloneCollection copies the item slice, so callers never share it with the store
+func cloneCollection(c *models.Collection) *models.Collection {
+	clone := *c
+	clone.FavouriteIDs = slices.Clone(c.FavouriteIDs)
+	clone.Favourites = nil
+	return &clone
+}
+
+func (r *MemoryCollectionRepository) Create(collection *models.Collection) error {
+	shard := r.pickShard(collection.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, exists := shard.collections[collection.ID]; exists {
+		return errors.ErrConflict
+	}
+
+	shard.collections[collection.ID] = cloneCollection(collection)
+	return nil
+}
+
+func (r *MemoryCollectionRepository) GetByID(id uuid.UUID) (*models.Collection, error) {
+	shard := r.pickShard(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	collection, ok := shard.collections[id]
+	if !ok {
+		return nil, errors.ErrCollectionNotFound
+	}
+	return cloneCollection(collection), nil
+}
+
+func (r *MemoryCollectionRepository) ListByUser(userID uuid.UUID) ([]*models.Collection, error) {
+	result := []*models.Collection{}
+	for i := 0; i < collectionShardCount; i++ {
+		shard := r.shards[i]
+		shard.mu.RLock()
+		for _, collection := range shard.collections {
+			if collection.UserID == userID {
+				result = append(result, cloneCollection(collection))
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return result, nil
+}
+
+// modify runs fn on the stored collection under the shard lock
+func (r *MemoryCollectionRepository) modify(id uuid.UUID, fn func(c *models.Collection) error) error {
+	shard := r.pickShard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	collection, ok := shard.collections[id]
+	if !ok {
+		return errors.ErrCollectionNotFound
+	}
+	if err := fn(collection); err != nil {
+		return err
+	}
+	collection.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *MemoryCollectionRepository) Rename(id uuid.UUID, name string) error {
+	return r.modify(id, func(c *models.Collection) error {
+		c.Name = name
+		return nil
+	})
+}
+
+func (r *MemoryCollectionRepository) Delete(id uuid.UUID) error {
+	shard := r.pickShard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, ok := shard.collections[id]; !ok {
+		return errors.ErrCollectionNotFound
+	}
+
+	delete(shard.collections, id)
+	return nil
+}
+
+func (r *MemoryCollectionRepository) AddItem(id, favID uuid.UUID, position int) error {
+	return r.modify(id, func(c *models.Collection) error {
+		items, err := insertItem(c.FavouriteIDs, favID, position)
+		if err != nil {
+			return err
+		}
+		c.FavouriteIDs = items
+		return nil
+	})
+}
+
+func (r *MemoryCollectionRepository) RemoveItem(id, favID uuid.UUID) error {
+	return r.modify(id, func(c *models.Collection) error {
+		i := slices.Index(c.FavouriteIDs, favID)
+		if i < 0 {
+			return errors.ErrFavouriteNotFound
+		}
+		c.FavouriteIDs = slices.Delete(c.FavouriteIDs, i, i+1)
+		return nil
+	})
+}
+
+func (r *MemoryCollectionRepository) Reorder(id uuid.UUID, favIDs []uuid.UUID) error {
+	return r.modify(id, func(c *models.Collection) error {
+		if !samePermutation(c.FavouriteIDs, favIDs) {
+			return errors.ErrInvalidOrder
+		}
+		c.FavouriteIDs = slices.Clone(favIDs)
+		return nil
+	})
+}
+
+func (r *MemoryCollectionRepository) RemoveFavourite(favID uuid.UUID) error {
+	r.removeFavourite(favID)
+	return nil
+}
+
+// removeFavourite returns the IDs of the collections it changed
+func (r *MemoryCollectionRepository) removeFavourite(favID uuid.UUID) []uuid.UUID {
+	var changed []uuid.UUID
+	for i := 0; i < collectionShardCount; i++ {
+		shard := r.shards[i]
+		shard.mu.Lock()
+		for id, collection := range shard.collections {
+			if i := slices.Index(collection.FavouriteIDs, favID); i >= 0 {
+				collection.FavouriteIDs = slices.Delete(collection.FavouriteIDs, i, i+1)
+				collection.UpdatedAt = time.Now()
+				changed = append(changed, id)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return changed
+}
+
+func (r *MemoryCollectionRepository) DeleteByUser(userID uuid.UUID) error {
+	r.deleteByUser(userID)
+	return nil
+}
+
+// deleteByUser returns the IDs of the collections it deleted
+func (r *MemoryCollectionRepository) deleteByUser(userID uuid.UUID) []uuid.UUID {
+	var deleted []uuid.UUID
+	for i := 0; i < collectionShardCount; i++ {
+		shard := r.shards[i]
+		shard.mu.Lock()
+		for id, collection := range shard.collections {
+			if collection.UserID == userID {
+				delete(shard.collections, id)
+				deleted = append(deleted, id)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return deleted
+}
+
+// restore puts a collection back as-is, used when replaying the journal
+func (r *MemoryCollectionRepository) restore(collection *models.Collection) {
+	shard := r.pickShard(collection.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.collections[collection.ID] = collection
+}
+
+func (r *MemoryCollectionRepository) remove(id uuid.UUID) {
+	shard := r.pickShard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	delete(shard.collections, id)
+}
+
+func (r *MemoryCollectionRepository) listAll() []*models.Collection {
+	var result []*models.Collection
+	for i := 0; i < collectionShardCount; i++ {
+		shard := r.shards[i]
+		shard.mu.RLock()
+		for _, collection := range shard.collections {
+			result = append(result, cloneCollection(collection))
+		}
+		shard.mu.RUnlock()
+	}
+	return result
+}
+
+// insertItem adds favID at position, or at the end when position is out of range
+func insertItem(items []uuid.UUID, favID uuid.UUID, position int) ([]uuid.UUID, error) {
+	if slices.Contains(items, favID) {
+		return nil, errors.ErrCollectionItemExists
+	}
+	if position < 0 || position > len(items) {
+		position = len(items)
+	}
+	return slices.Insert(slices.Clone(items), position, favID), nil
+}
+
+// samePermutation reports whether b holds exactly the items of a
+func samePermutation(a, b []uuid.UUID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[uuid.UUID]bool, len(a))
+	for _, id := range a {
+		seen[id] = true
+	}
+	for _, id := range b {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+	return true
+}
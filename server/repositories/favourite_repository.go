@@ -3,6 +3,7 @@ package repositories
 import (
 	"hash/fnv"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"favourite_assets/server/models"
@@ -16,13 +17,31 @@ type favouriteShard struct {
 	favourites map[uuid.UUID]*models.Favourite
 }
 
-type FavouriteRepository struct {
+// userAssetKey identifies the favourite of one user for one asset
+type userAssetKey struct {
+	userID  uuid.UUID
+	assetID uuid.UUID
+}
+
+// MemoryFavouriteRepository keeps favourites in sharded in-memory maps
+type MemoryFavouriteRepository struct {
 	shards [favouriteShardCount]*favouriteShard
+
+	// idxMu guards the secondary indexes and is always taken before a shard
+	// lock, so an index never points at a favourite that is not stored
+	idxMu       sync.RWMutex
+	byUser      map[uuid.UUID]map[uuid.UUID]struct{}
+	byAsset     map[uuid.UUID]map[uuid.UUID]struct{}
+	byUserAsset map[userAssetKey]uuid.UUID
 }
 
-// NewFavouriteRepository initializes shards
-func NewFavoriteRepository() *FavouriteRepository {
-	r := &FavouriteRepository{}
+// NewMemoryFavouriteRepository initializes shards
+func NewMemoryFavouriteRepository() *MemoryFavouriteRepository {
+	r := &MemoryFavouriteRepository{
+		byUser:      make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		byAsset:     make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		byUserAsset: make(map[userAssetKey]uuid.UUID),
+	}
 	for i := 0; i < favouriteShardCount; i++ {
 		r.shards[i] = &favouriteShard{
 			favourites: make(map[uuid.UUID]*models.Favourite),
@@ -32,13 +51,57 @@ func NewFavoriteRepository() *FavouriteRepository {
 }
 
 // pickShard selects a shard based on favourite ID
-func (r *FavouriteRepository) pickShard(favID uuid.UUID) *favouriteShard {
+func (r *MemoryFavouriteRepository) pickShard(favID uuid.UUID) *favouriteShard {
 	h := fnv.New32a()
 	h.Write(favID[:])
 	return r.shards[uint(h.Sum32())%favouriteShardCount]
 }
 
-func (r *FavouriteRepository) Create(fav *models.Favourite) error {
+// index adds fav to the secondary indexes; idxMu must be held
+func (r *MemoryFavouriteRepository) index(fav *models.Favourite) {
+	addToSet(r.byUser, fav.UserID, fav.ID)
+	addToSet(r.byAsset, fav.AssetID, fav.ID)
+	r.byUserAsset[userAssetKey{fav.UserID, fav.AssetID}] = fav.ID
+}
+
+// unindex removes fav from the secondary indexes; idxMu must be held
+func (r *MemoryFavouriteRepository) unindex(fav *models.Favourite) {
+	removeFromSet(r.byUser, fav.UserID, fav.ID)
+	removeFromSet(r.byAsset, fav.AssetID, fav.ID)
+	key := userAssetKey{fav.UserID, fav.AssetID}
+	if r.byUserAsset[key] == fav.ID {
+		delete(r.byUserAsset, key)
+	}
+}
+
+func addToSet(index map[uuid.UUID]map[uuid.UUID]struct{}, key, id uuid.UUID) {
+	set, ok := index[key]
+	if !ok {
+		set = make(map[uuid.UUID]struct{})
+		index[key] = set
+	}
+	set[id] = struct{}{}
+}
+
+func removeFromSet(index map[uuid.UUID]map[uuid.UUID]struct{}, key, id uuid.UUID) {
+	set := index[key]
+	delete(set, id)
+	if len(set) == 0 {
+		delete(index, key)
+	}
+}
+
+// Create stores fav unless the user already has a favourite for the same
+// asset. The check and the insert happen under idxMu, so concurrent creates
+// for one pair cannot both succeed.
+func (r *MemoryFavouriteRepository) Create(fav *models.Favourite) error {
+	r.idxMu.Lock()
+	defer r.idxMu.Unlock()
+
+	if _, exists := r.byUserAsset[userAssetKey{fav.UserID, fav.AssetID}]; exists {
+		return errors.ErrFavouriteDuplicate
+	}
+
 	shard := r.pickShard(fav.ID)
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
@@ -47,11 +110,14 @@ func (r *FavouriteRepository) Create(fav *models.Favourite) error {
 		return errors.ErrFavouriteExists
 	}
 
-	shard.favourites[fav.ID] = fav
+	// Stored values are never written to, readers share them without a lock
+	stored := *fav
+	shard.favourites[fav.ID] = &stored
+	r.index(&stored)
 	return nil
 }
 
-func (r *FavouriteRepository) GetByID(favID uuid.UUID) (*models.Favourite, error) {
+func (r *MemoryFavouriteRepository) GetByID(favID uuid.UUID) (*models.Favourite, error) {
 	shard := r.pickShard(favID)
 	shard.mu.RLock()
 	defer shard.mu.RUnlock()
@@ -63,35 +129,114 @@ func (r *FavouriteRepository) GetByID(favID uuid.UUID) (*models.Favourite, error
 	return fav, nil
 }
 
-func (r *FavouriteRepository) Delete(favID uuid.UUID) error {
+func (r *MemoryFavouriteRepository) Update(fav *models.Favourite) error {
+	shard := r.pickShard(fav.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	existing, ok := shard.favourites[fav.ID]
+	if !ok {
+		return errors.ErrFavouriteNotFound
+	}
+
+	// Swap in a changed copy, readers may hold the stored one
+	updated := *existing
+	updated.CustomDescription = fav.CustomDescription
+	updated.Notes = fav.Notes
+	updated.UpdatedAt = time.Now()
+	shard.favourites[fav.ID] = &updated
+	fav.UpdatedAt = updated.UpdatedAt
+	return nil
+}
+
+func (r *MemoryFavouriteRepository) Delete(favID uuid.UUID) error {
+	r.idxMu.Lock()
+	defer r.idxMu.Unlock()
+
 	shard := r.pickShard(favID)
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
-	if _, ok := shard.favourites[favID]; !ok {
+	fav, ok := shard.favourites[favID]
+	if !ok {
 		return errors.ErrFavouriteNotFound
 	}
 
 	delete(shard.favourites, favID)
+	r.unindex(fav)
 	return nil
 }
 
-func (r *FavouriteRepository) ListByUser(userID uuid.UUID) []*models.Favourite {
-	var result []*models.Favourite
-	for i := 0; i < favouriteShardCount; i++ {
-		shard := r.shards[i]
+func (r *MemoryFavouriteRepository) DeleteByUser(userID uuid.UUID) ([]uuid.UUID, error) {
+	return r.deleteIndexed(r.byUser, userID), nil
+}
+
+func (r *MemoryFavouriteRepository) DeleteByAsset(assetID uuid.UUID) ([]uuid.UUID, error) {
+	return r.deleteIndexed(r.byAsset, assetID), nil
+}
+
+// deleteIndexed removes the favourites listed under key in index
+func (r *MemoryFavouriteRepository) deleteIndexed(index map[uuid.UUID]map[uuid.UUID]struct{}, key uuid.UUID) []uuid.UUID {
+	r.idxMu.Lock()
+	defer r.idxMu.Unlock()
+
+	// unindex shrinks the set, so collect the IDs first
+	ids := make([]uuid.UUID, 0, len(index[key]))
+	for id := range index[key] {
+		ids = append(ids, id)
+	}
+
+	for _, id := range ids {
+		shard := r.pickShard(id)
+		shard.mu.Lock()
+		if fav, ok := shard.favourites[id]; ok {
+			delete(shard.favourites, id)
+			r.unindex(fav)
+		}
+		shard.mu.Unlock()
+	}
+	return ids
+}
+
+// ListByUser reads the user index, so it costs O(favourites of the user)
+func (r *MemoryFavouriteRepository) ListByUser(userID uuid.UUID) ([]*models.Favourite, error) {
+	r.idxMu.RLock()
+	defer r.idxMu.RUnlock()
+	return r.lookup(r.byUser[userID]), nil
+}
+
+func (r *MemoryFavouriteRepository) ListByAsset(assetID uuid.UUID) ([]*models.Favourite, error) {
+	r.idxMu.RLock()
+	defer r.idxMu.RUnlock()
+	return r.lookup(r.byAsset[assetID]), nil
+}
+
+func (r *MemoryFavouriteRepository) GetByUserAndAsset(userID, assetID uuid.UUID) (*models.Favourite, error) {
+	r.idxMu.RLock()
+	defer r.idxMu.RUnlock()
+
+	favID, ok := r.byUserAsset[userAssetKey{userID, assetID}]
+	if !ok {
+		return nil, errors.ErrFavouriteNotFound
+	}
+	return r.GetByID(favID)
+}
+
+// lookup fetches the favourites of an index entry; idxMu must be held
+func (r *MemoryFavouriteRepository) lookup(ids map[uuid.UUID]struct{}) []*models.Favourite {
+	result := make([]*models.Favourite, 0, len(ids))
+	for id := range ids {
+		shard := r.pickShard(id)
 		shard.mu.RLock()
-		for _, fav := range shard.favourites {
-			if fav.UserID == userID {
-				result = append(result, fav)
-			}
+		if fav, ok := shard.favourites[id]; ok {
+			result = append(result, fav)
 		}
 		shard.mu.RUnlock()
 	}
 	return result
 }
 
-func (r *FavouriteRepository) Get(favID uuid.UUID) (models.Favourite, error) {
+func (r *MemoryFavouriteRepository) Get(favID uuid.UUID) (models.Favourite, error) {
 	shard := r.pickShard(favID)
 	shard.mu.RLock()
 	defer shard.mu.RUnlock()
@@ -102,4 +247,45 @@ func (r *FavouriteRepository) Get(favID uuid.UUID) (models.Favourite, error) {
 	}
 
 	return *fav, nil
-}
\ No newline at end of file
+}
+
+// restore puts a favourite back as-is, used when replaying the journal
+func (r *MemoryFavouriteRepository) restore(fav *models.Favourite) {
+	r.idxMu.Lock()
+	defer r.idxMu.Unlock()
+
+	shard := r.pickShard(fav.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if existing, ok := shard.favourites[fav.ID]; ok {
+		r.unindex(existing)
+	}
+	shard.favourites[fav.ID] = fav
+	r.index(fav)
+}
+
+func (r *MemoryFavouriteRepository) remove(favID uuid.UUID) {
+	r.idxMu.Lock()
+	defer r.idxMu.Unlock()
+
+	shard := r.pickShard(favID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if fav, ok := shard.favourites[favID]; ok {
+		r.unindex(fav)
+		delete(shard.favourites, favID)
+	}
+}
+
+func (r *MemoryFavouriteRepository) listAll() []*models.Favourite {
+	var result []*models.Favourite
+	for i := 0; i < favouriteShardCount; i++ {
+		shard := r.shards[i]
+		shard.mu.RLock()
+		for _, fav := range shard.favourites {
+			result = append(result, fav)
+		}
+		shard.mu.RUnlock()
+	}
+	return result
+}
@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+	"github.com/google/uuid"
+)
+
+// checkFavouriteIndexes rebuilds the secondary indexes from the shards and
+// compares them with the maintained ones
+func checkFavouriteIndexes(t *testing.T, r *MemoryFavouriteRepository) {
+	t.Helper()
+	want := NewMemoryFavouriteRepository()
+	for _, fav := range r.listAll() {
+		want.index(fav)
+	}
+
+	r.idxMu.RLock()
+	defer r.idxMu.RUnlock()
+	if !maps.EqualFunc(r.byUser, want.byUser, maps.Equal) {
+		t.Errorf("byUser holds %v, want %v", r.byUser, want.byUser)
+	}
+	if !maps.EqualFunc(r.byAsset, want.byAsset, maps.Equal) {
+		t.Errorf("byAsset holds %v, want %v", r.byAsset, want.byAsset)
+	}
+	if !maps.Equal(r.byUserAsset, want.byUserAsset) {
+		t.Errorf("byUserAsset holds %v, want %v", r.byUserAsset, want.byUserAsset)
+	}
+}
+
+func newFavourite(userID, assetID uuid.UUID) *models.Favourite {
+	return &models.Favourite{ID: uuid.New(), UserID: userID, AssetID: assetID, AssetType: models.AssetChart, CreatedAt: time.Now()}
+}
+
+func TestFavouriteIndexes(t *testing.T) {
+	r := NewMemoryFavouriteRepository()
+	users := []uuid.UUID{uuid.New(), uuid.New()}
+	assets := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	favs := map[[2]int]*models.Favourite{}
+	for u, userID := range users {
+		for a, assetID := range assets {
+			fav := newFavourite(userID, assetID)
+			if err := r.Create(fav); err != nil {
+				t.Fatal(err)
+			}
+			favs[[2]int{u, a}] = fav
+		}
+	}
+	checkFavouriteIndexes(t, r)
+
+	if err := r.Create(newFavourite(users[0], assets[0])); err != errors.ErrFavouriteDuplicate {
+		t.Errorf("got %v, want ErrFavouriteDuplicate", err)
+	}
+	checkFavouriteIndexes(t, r)
+
+	edited := *favs[[2]int{0, 0}]
+	edited.Notes = "for the board"
+	if err := r.Update(&edited); err != nil {
+		t.Fatal(err)
+	}
+	checkFavouriteIndexes(t, r)
+
+	if err := r.Delete(favs[[2]int{0, 1}].ID); err != nil {
+		t.Fatal(err)
+	}
+	checkFavouriteIndexes(t, r)
+	if _, err := r.GetByUserAndAsset(users[0], assets[1]); err != errors.ErrFavouriteNotFound {
+		t.Errorf("got %v, want the deleted favourite gone from byUserAsset", err)
+	}
+
+	// The pair is free again once its favourite is deleted
+	if err := r.Create(newFavourite(users[0], assets[1])); err != nil {
+		t.Fatal(err)
+	}
+	checkFavouriteIndexes(t, r)
+
+	if ids, _ := r.DeleteByAsset(assets[2]); len(ids) != 2 {
+		t.Errorf("got %d favourites deleted with the asset, want 2", len(ids))
+	}
+	checkFavouriteIndexes(t, r)
+	if ids, _ := r.DeleteByUser(users[1]); len(ids) != 2 {
+		t.Errorf("got %d favourites deleted with the user, want 2", len(ids))
+	}
+	checkFavouriteIndexes(t, r)
+	if list, _ := r.ListByUser(users[0]); len(list) != 2 {
+		t.Errorf("got %d favourites for the remaining user, want 2", len(list))
+	}
+
+	// Journal replay moves a favourite to another asset in place
+	moved := *favs[[2]int{0, 0}]
+	moved.AssetID = assets[2]
+	r.restore(&moved)
+	checkFavouriteIndexes(t, r)
+	if list, _ := r.ListByAsset(assets[0]); len(list) != 0 {
+		t.Errorf("got %v under the old asset, want none", list)
+	}
+	r.remove(moved.ID)
+	checkFavouriteIndexes(t, r)
+}
+
+// Next to TestAddFavouriteConcurrentDuplicates in the services, which
+// checks the outcome of racing creates, this checks what they leave behind
+func TestFavouriteIndexesConcurrent(t *testing.T) {
+	r := NewMemoryFavouriteRepository()
+	users := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	assets := []uuid.UUID{uuid.New(), uuid.New(), uuid.New(), uuid.New()}
+
+	var wg sync.WaitGroup
+	for i := range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			userID, assetID := users[i%len(users)], assets[i%len(assets)]
+			fav := newFavourite(userID, assetID)
+			if err := r.Create(fav); err != nil {
+				return
+			}
+			edited := *fav
+			edited.Notes = "seen"
+			_ = r.Update(&edited)
+			if _, err := r.ListByUser(userID); err != nil {
+				t.Error(err)
+			}
+			switch i % 4 {
+			case 0:
+				_ = r.Delete(fav.ID)
+			case 1:
+				_, _ = r.DeleteByAsset(assetID)
+			}
+		}()
+	}
+	wg.Wait()
+	checkFavouriteIndexes(t, r)
+}
@@ -0,0 +1,412 @@
+package repositories
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// walRecord is one line of the write-ahead log. A put carries the full state
+// of the entity after the mutation, so replaying is a plain upsert.
+type walRecord struct {
+	Seq    uint64          `json:"seq"`
+	Op     string          `json:"op"`
+	Entity string          `json:"entity"`
+	ID     uuid.UUID       `json:"id"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+type snapshotFile struct {
+	Seq      uint64                       `json:"seq"`
+	TakenAt  time.Time                    `json:"takenAt"`
+	Entities map[string][]json.RawMessage `json:"entities"`
+}
+
+// journalEntity connects one in-memory repository to the journal
+type journalEntity struct {
+	// load returns the current state of id, or false if it does not exist
+	load func(id uuid.UUID) (any, bool)
+	// restore upserts a state previously returned by load
+	restore func(data json.RawMessage) error
+	remove  func(id uuid.UUID)
+	// dump returns every stored entity, for snapshots
+	dump func() []any
+}
+
+type JournalOptions struct {
+	// SyncWrites fsyncs the log after every record
+	SyncWrites bool
+	// SnapshotInterval is how often the log is compacted into a snapshot, 0 disables it
+	SnapshotInterval time.Duration
+}
+
+// walFile is the open log; *os.File in production, replaced in tests to
+// make writes fail
+type walFile interface {
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// Journal makes the in-memory repositories durable. Every mutation is
+// appended to a write-ahead log, and the log is periodically compacted into a
+// snapshot. On startup the last snapshot is loaded and the log replayed.
+type Journal struct {
+	dir  string
+	opts JournalOptions
+
+	// mu serializes mutations with their log records, so the log order
+	// always matches the order in which the maps were changed
+	mu       sync.Mutex
+	file     walFile
+	size     int64
+	seq      uint64
+	entities map[string]*journalEntity
+	// failed is the append error after which the maps no longer match the
+	// log; every later mutation and snapshot is refused with it
+	failed error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newJournal(dir string, opts JournalOptions) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Journal{
+		dir:      dir,
+		opts:     opts,
+		entities: make(map[string]*journalEntity),
+	}, nil
+}
+
+func (j *Journal) register(name string, e *journalEntity) {
+	j.entities[name] = e
+}
+
+// mutate runs fn and, if it succeeds, logs the resulting state of id
+func (j *Journal) mutate(entity string, id uuid.UUID, fn func() error) error {
+	return j.mutateMany(entity, func() ([]uuid.UUID, error) {
+		return []uuid.UUID{id}, fn()
+	})
+}
+
+// mutateMany runs fn and, if it succeeds, logs the resulting state of every
+// ID it reports as changed
+func (j *Journal) mutateMany(entity string, fn func() ([]uuid.UUID, error)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.failed != nil {
+		return fmt.Errorf("journal: writes refused after a failed append: %w", j.failed)
+	}
+
+	ids, err := fn()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		rec := walRecord{Seq: j.seq + 1, Op: opDelete, Entity: entity, ID: id}
+		if state, ok := j.entities[entity].load(id); ok {
+			data, err := json.Marshal(state)
+			if err != nil {
+				return err
+			}
+			rec.Op = opPut
+			rec.Data = data
+		}
+
+		if err := j.append(rec); err != nil {
+			// The map already changed and the change is not in the log, so
+			// the two disagree until a restart reloads the log
+			log.Printf("journal: failed to append %s %s %s, refusing further writes: %v", rec.Op, entity, id, err)
+			j.failed = err
+			return err
+		}
+		j.seq = rec.Seq
+	}
+	return nil
+}
+
+func (j *Journal) append(rec walRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := j.file.Write(line); err != nil {
+		return j.rewind(err)
+	}
+	if j.opts.SyncWrites {
+		if err := j.file.Sync(); err != nil {
+			return j.rewind(err)
+		}
+	}
+	j.size += int64(len(line))
+	return nil
+}
+
+// rewind cuts off whatever part of a failed record reached the log, so the
+// next start does not find it in the middle of the file, and returns err
+func (j *Journal) rewind(err error) error {
+	if truncErr := j.file.Truncate(j.size); truncErr != nil {
+		log.Printf("journal: failed to cut the log back to %d bytes: %v", j.size, truncErr)
+	} else if _, seekErr := j.file.Seek(j.size, io.SeekStart); seekErr != nil {
+		log.Printf("journal: failed to seek the log back to %d bytes: %v", j.size, seekErr)
+	}
+	return err
+}
+
+// open loads the snapshot, replays the log on top of it and opens the log
+// for appending
+func (j *Journal) open() error {
+	if err := j.loadSnapshot(); err != nil {
+		return err
+	}
+
+	path := filepath.Join(j.dir, walFileName)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	valid, err := j.replay(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	// Drop a torn record left by a crash in the middle of a write
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+
+	j.file = file
+	j.size = valid
+	return nil
+}
+
+func (j *Journal) loadSnapshot() error {
+	raw, err := os.ReadFile(filepath.Join(j.dir, snapshotFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap snapshotFile
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return fmt.Errorf("journal: corrupt snapshot: %w", err)
+	}
+
+	for name, items := range snap.Entities {
+		entity, ok := j.entities[name]
+		if !ok {
+			return fmt.Errorf("journal: unknown entity %q in snapshot", name)
+		}
+		for _, item := range items {
+			if err := entity.restore(item); err != nil {
+				return fmt.Errorf("journal: snapshot %s: %w", name, err)
+			}
+		}
+	}
+
+	j.seq = snap.Seq
+	return nil
+}
+
+// replay applies the records newer than the snapshot and returns the offset
+// of the end of the last complete record. Only the final record may be
+// incomplete; a corrupt one before it is an error.
+func (j *Journal) replay(r io.Reader) (int64, error) {
+	reader := bufio.NewReader(r)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Anything after the last newline is an incomplete write
+			if len(line) > 0 {
+				log.Printf("journal: discarding %d bytes of an incomplete record at offset %d", len(line), offset)
+			}
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		// A complete record that does not parse is not a torn write, and
+		// dropping it would lose every record after it
+		var rec walRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			return 0, fmt.Errorf("journal: corrupt record at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+
+		if rec.Seq <= j.seq {
+			continue
+		}
+
+		entity, ok := j.entities[rec.Entity]
+		if !ok {
+			return 0, fmt.Errorf("journal: unknown entity %q in log", rec.Entity)
+		}
+		switch rec.Op {
+		case opPut:
+			if err := entity.restore(rec.Data); err != nil {
+				return 0, fmt.Errorf("journal: record %d: %w", rec.Seq, err)
+			}
+		case opDelete:
+			entity.remove(rec.ID)
+		default:
+			return 0, fmt.Errorf("journal: record %d: unknown op %q", rec.Seq, rec.Op)
+		}
+		j.seq = rec.Seq
+	}
+}
+
+// Snapshot writes the current state to disk and truncates the log
+func (j *Journal) Snapshot() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// The maps hold a change the caller was told failed
+	if j.failed != nil {
+		return fmt.Errorf("journal: snapshot refused after a failed append: %w", j.failed)
+	}
+
+	snap := snapshotFile{
+		Seq:      j.seq,
+		TakenAt:  time.Now().UTC(),
+		Entities: make(map[string][]json.RawMessage, len(j.entities)),
+	}
+	for name, entity := range j.entities {
+		items := []json.RawMessage{}
+		for _, state := range entity.dump() {
+			data, err := json.Marshal(state)
+			if err != nil {
+				return err
+			}
+			items = append(items, data)
+		}
+		snap.Entities[name] = items
+	}
+
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename, so a crash never leaves a half
+	// written snapshot behind
+	tmp := filepath.Join(j.dir, snapshotFileName+".tmp")
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(raw); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(j.dir, snapshotFileName)); err != nil {
+		return err
+	}
+	// The rename must be on disk before the log it replaces is emptied
+	if err := syncDir(j.dir); err != nil {
+		return err
+	}
+
+	// Records up to snap.Seq are now in the snapshot; even if truncating
+	// fails they are skipped on replay
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	j.size = 0
+	_, err = j.file.Seek(0, io.SeekStart)
+	return err
+}
+
+// syncDir fsyncs a directory, making the entries renamed into it durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (j *Journal) startSnapshots() {
+	if j.opts.SnapshotInterval <= 0 {
+		return
+	}
+
+	j.stop = make(chan struct{})
+	j.done = make(chan struct{})
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(j.opts.SnapshotInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := j.Snapshot(); err != nil {
+					log.Printf("journal: snapshot failed: %v", err)
+				}
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the periodic snapshots, takes a final one and closes the log
+func (j *Journal) Close() error {
+	if j.stop != nil {
+		close(j.stop)
+		<-j.done
+	}
+
+	err := j.Snapshot()
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
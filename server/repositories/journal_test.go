@@ -0,0 +1,199 @@
+package repositories
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"favourite_assets/server/models"
+	"github.com/google/uuid"
+)
+
+func openJournaled(t *testing.T, dir string) *Store {
+	t.Helper()
+	store, err := OpenJournaledStore(dir, JournalOptions{SyncWrites: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func createUser(t *testing.T, store *Store, name string) *models.User {
+	t.Helper()
+	user := &models.User{ID: uuid.New(), Name: name, Email: strings.ToLower(name) + "@example.com", CreatedAt: time.Now()}
+	if err := store.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func userNames(t *testing.T, store *Store) map[string]bool {
+	t.Helper()
+	users, err := store.Users.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool, len(users))
+	for _, user := range users {
+		names[user.Name] = true
+	}
+	return names
+}
+
+func walSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func appendToWAL(t *testing.T, dir, data string) {
+	t.Helper()
+	file, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The stores left open below stand for processes that crashed: they are
+// never closed, so nothing but the log records their changes
+
+func TestJournalReplaysLog(t *testing.T) {
+	dir := t.TempDir()
+	crashed := openJournaled(t, dir)
+	ada := createUser(t, crashed, "Ada")
+	grace := createUser(t, crashed, "Grace")
+	if err := crashed.Users.Delete(grace.ID); err != nil {
+		t.Fatal(err)
+	}
+	ada.Name = "Ada Lovelace"
+	if err := crashed.Users.Update(ada); err != nil {
+		t.Fatal(err)
+	}
+
+	store := openJournaled(t, dir)
+	defer store.Close()
+	if names := userNames(t, store); len(names) != 1 || !names["Ada Lovelace"] {
+		t.Errorf("got %v, want only the renamed user", names)
+	}
+}
+
+func TestJournalSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store := openJournaled(t, dir)
+	createUser(t, store, "Ada")
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if size := walSize(t, dir); size != 0 {
+		t.Fatalf("got a %d byte log after the snapshot, want it truncated", size)
+	}
+
+	// Changes after the snapshot are replayed on top of it
+	crashed := openJournaled(t, dir)
+	createUser(t, crashed, "Grace")
+
+	store = openJournaled(t, dir)
+	defer store.Close()
+	if names := userNames(t, store); len(names) != 2 || !names["Ada"] || !names["Grace"] {
+		t.Errorf("got %v, want the snapshot and the log", names)
+	}
+}
+
+func TestJournalDropsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	crashed := openJournaled(t, dir)
+	createUser(t, crashed, "Ada")
+	complete := walSize(t, dir)
+	appendToWAL(t, dir, `{"seq":2,"op":"put","entity":"us`)
+
+	crashed = openJournaled(t, dir)
+	if size := walSize(t, dir); size != complete {
+		t.Fatalf("got a %d byte log, want the torn record cut at %d", size, complete)
+	}
+	createUser(t, crashed, "Grace")
+
+	store := openJournaled(t, dir)
+	defer store.Close()
+	if names := userNames(t, store); len(names) != 2 || !names["Ada"] || !names["Grace"] {
+		t.Errorf("got %v, want both users around the torn record", names)
+	}
+}
+
+func TestJournalRejectsCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	crashed := openJournaled(t, dir)
+	createUser(t, crashed, "Ada")
+	createUser(t, crashed, "Grace")
+
+	// Damage the first of the two records
+	path := filepath.Join(dir, walFileName)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[0] = '#'
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenJournaledStore(dir, JournalOptions{}); err == nil || !strings.Contains(err.Error(), "corrupt record") {
+		t.Fatalf("got %v, want startup to fail on the corrupt record", err)
+	}
+	if got := walSize(t, dir); got != int64(len(raw)) {
+		t.Errorf("got a %d byte log, want it left at %d for inspection", got, len(raw))
+	}
+}
+
+// tornWAL writes half of every record and then fails, like a full disk
+type tornWAL struct {
+	*os.File
+}
+
+func (f tornWAL) Write(p []byte) (int, error) {
+	n, _ := f.File.Write(p[:len(p)/2])
+	return n, syscall.ENOSPC
+}
+
+func TestJournalFailedAppend(t *testing.T) {
+	dir := t.TempDir()
+	store := openJournaled(t, dir)
+	createUser(t, store, "Ada")
+	complete := walSize(t, dir)
+
+	j := store.Users.(*journaledUserRepository).j
+	j.file = tornWAL{j.file.(*os.File)}
+	grace := &models.User{ID: uuid.New(), Name: "Grace", Email: "grace@example.com", CreatedAt: time.Now()}
+	if err := store.Users.Create(grace); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("got %v, want the write error", err)
+	}
+	if size := walSize(t, dir); size != complete {
+		t.Fatalf("got a %d byte log, want the half record cut at %d", size, complete)
+	}
+
+	// The maps no longer match the log, so nothing more is written
+	j.file = j.file.(tornWAL).File
+	linus := &models.User{ID: uuid.New(), Name: "Linus", Email: "linus@example.com", CreatedAt: time.Now()}
+	if err := store.Users.Create(linus); err == nil {
+		t.Fatal("got a write accepted after the failed append")
+	}
+	if err := store.Close(); err == nil {
+		t.Error("got a snapshot taken after the failed append")
+	}
+
+	store = openJournaled(t, dir)
+	defer store.Close()
+	if names := userNames(t, store); len(names) != 1 || !names["Ada"] {
+		t.Errorf("got %v, want only the user logged before the failure", names)
+	}
+}
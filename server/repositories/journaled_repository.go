@@ -0,0 +1,364 @@
+package repositories
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+const (
+	entityUser       = "user"
+	entityAsset      = "asset"
+	entityFavourite  = "favourite"
+	entityCollection = "collection"
+	entityVersion    = "assetVersion"
+	entityAudit      = "auditEntry"
+)
+
+// OpenJournaledStore returns a store backed by the in-memory sharded maps,
+// made durable by a write-ahead log and snapshots kept in dir
+func OpenJournaledStore(dir string, opts JournalOptions) (*Store, error) {
+	j, err := newJournal(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	users := NewMemoryUserRepository()
+	assets := NewMemoryAssetRepository()
+	favourites := NewMemoryFavouriteRepository()
+	collections := NewMemoryCollectionRepository()
+	versions := NewMemoryAssetVersionRepository()
+	audit := NewMemoryAuditRepository()
+
+	// Trashed users and assets are logged and snapshotted like live ones
+	j.register(entityUser, &journalEntity{
+		load: func(id uuid.UUID) (any, bool) {
+			return users.lookup(id)
+		},
+		restore: func(data json.RawMessage) error {
+			var user models.User
+			if err := json.Unmarshal(data, &user); err != nil {
+				return err
+			}
+			// Users logged before versions were counted start at 1, like new ones
+			user.Version = max(user.Version, 1)
+			users.restore(&user)
+			return nil
+		},
+		remove: users.remove,
+		dump: func() []any {
+			return toAny(users.listAll())
+		},
+	})
+
+	j.register(entityAsset, &journalEntity{
+		load: func(id uuid.UUID) (any, bool) {
+			asset, ok := assets.lookup(id)
+			if !ok {
+				return nil, false
+			}
+			return journaledAsset{Type: asset.GetType(), Asset: asset}, true
+		},
+		restore: func(data json.RawMessage) error {
+			asset, err := decodeJournaledAsset(data)
+			if err != nil {
+				return err
+			}
+			asset.Base().Version = max(asset.Base().Version, 1)
+			assets.restore(asset)
+			return nil
+		},
+		remove: assets.remove,
+		dump: func() []any {
+			list := assets.listAll()
+			result := make([]any, 0, len(list))
+			for _, asset := range list {
+				result = append(result, journaledAsset{Type: asset.GetType(), Asset: asset})
+			}
+			return result
+		},
+	})
+
+	j.register(entityFavourite, &journalEntity{
+		load: func(id uuid.UUID) (any, bool) {
+			fav, err := favourites.GetByID(id)
+			return fav, err == nil
+		},
+		restore: func(data json.RawMessage) error {
+			var fav models.Favourite
+			if err := json.Unmarshal(data, &fav); err != nil {
+				return err
+			}
+			favourites.restore(&fav)
+			return nil
+		},
+		remove: favourites.remove,
+		dump: func() []any {
+			return toAny(favourites.listAll())
+		},
+	})
+
+	j.register(entityCollection, &journalEntity{
+		load: func(id uuid.UUID) (any, bool) {
+			collection, err := collections.GetByID(id)
+			return collection, err == nil
+		},
+		restore: func(data json.RawMessage) error {
+			var collection models.Collection
+			if err := json.Unmarshal(data, &collection); err != nil {
+				return err
+			}
+			collections.restore(&collection)
+			return nil
+		},
+		remove: collections.remove,
+		dump: func() []any {
+			return toAny(collections.listAll())
+		},
+	})
+
+	j.register(entityVersion, &journalEntity{
+		load: func(id uuid.UUID) (any, bool) {
+			return versions.getByID(id)
+		},
+		restore: func(data json.RawMessage) error {
+			var version models.AssetVersion
+			if err := json.Unmarshal(data, &version); err != nil {
+				return err
+			}
+			versions.restore(&version)
+			return nil
+		},
+		remove: versions.remove,
+		dump: func() []any {
+			return toAny(versions.listAll())
+		},
+	})
+
+	j.register(entityAudit, &journalEntity{
+		load: func(id uuid.UUID) (any, bool) {
+			return audit.getByID(id)
+		},
+		restore: func(data json.RawMessage) error {
+			var entry models.AuditEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+			audit.restore(&entry)
+			return nil
+		},
+		remove: audit.remove,
+		dump: func() []any {
+			return toAny(audit.listAll())
+		},
+	})
+
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	j.startSnapshots()
+
+	return &Store{
+		Users:         &journaledUserRepository{users, j},
+		Assets:        &journaledAssetRepository{assets, j},
+		Favourites:    &journaledFavouriteRepository{favourites, j},
+		Collections:   &journaledCollectionRepository{collections, j},
+		AssetVersions: &journaledAssetVersionRepository{versions, j},
+		Audit:         &journaledAuditRepository{audit, j},
+		close:         j.Close,
+	}, nil
+}
+
+// journaledAsset keeps the type next to the asset so it can be decoded again
+type journaledAsset struct {
+	Type  models.AssetType `json:"type"`
+	Asset any              `json:"asset"`
+}
+
+func decodeJournaledAsset(data json.RawMessage) (models.Asset, error) {
+	var envelope struct {
+		Type  models.AssetType `json:"type"`
+		Asset json.RawMessage  `json:"asset"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	asset, ok := models.NewAsset(envelope.Type)
+	if !ok {
+		return nil, errors.ErrUnknownAssetType
+	}
+	if err := json.Unmarshal(envelope.Asset, asset); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+func toAny[T any](items []T) []any {
+	result := make([]any, len(items))
+	for i, item := range items {
+		result[i] = item
+	}
+	return result
+}
+
+// The journaled repositories log every successful mutation; reads go straight
+// to the embedded in-memory repository
+
+type journaledUserRepository struct {
+	*MemoryUserRepository
+	j *Journal
+}
+
+func (r *journaledUserRepository) Create(user *models.User) error {
+	return r.j.mutate(entityUser, user.ID, func() error { return r.MemoryUserRepository.Create(user) })
+}
+
+func (r *journaledUserRepository) Update(user *models.User) error {
+	return r.j.mutate(entityUser, user.ID, func() error { return r.MemoryUserRepository.Update(user) })
+}
+
+func (r *journaledUserRepository) Delete(userID uuid.UUID) error {
+	return r.j.mutate(entityUser, userID, func() error { return r.MemoryUserRepository.Delete(userID) })
+}
+
+func (r *journaledUserRepository) Trash(userID uuid.UUID, version int, deletedBy string, at time.Time) error {
+	return r.j.mutate(entityUser, userID, func() error { return r.MemoryUserRepository.Trash(userID, version, deletedBy, at) })
+}
+
+func (r *journaledUserRepository) Restore(userID uuid.UUID) error {
+	return r.j.mutate(entityUser, userID, func() error { return r.MemoryUserRepository.Restore(userID) })
+}
+
+type journaledAssetRepository struct {
+	*MemoryAssetRepository
+	j *Journal
+}
+
+func (r *journaledAssetRepository) Create(asset models.Asset) error {
+	return r.j.mutate(entityAsset, asset.GetID(), func() error { return r.MemoryAssetRepository.Create(asset) })
+}
+
+func (r *journaledAssetRepository) Update(asset models.Asset) error {
+	return r.j.mutate(entityAsset, asset.GetID(), func() error { return r.MemoryAssetRepository.Update(asset) })
+}
+
+func (r *journaledAssetRepository) Delete(id uuid.UUID) error {
+	return r.j.mutate(entityAsset, id, func() error { return r.MemoryAssetRepository.Delete(id) })
+}
+
+func (r *journaledAssetRepository) Trash(id uuid.UUID, deletedBy string, at time.Time) error {
+	return r.j.mutate(entityAsset, id, func() error { return r.MemoryAssetRepository.Trash(id, deletedBy, at) })
+}
+
+func (r *journaledAssetRepository) Restore(id uuid.UUID) error {
+	return r.j.mutate(entityAsset, id, func() error { return r.MemoryAssetRepository.Restore(id) })
+}
+
+type journaledFavouriteRepository struct {
+	*MemoryFavouriteRepository
+	j *Journal
+}
+
+func (r *journaledFavouriteRepository) Create(fav *models.Favourite) error {
+	return r.j.mutate(entityFavourite, fav.ID, func() error { return r.MemoryFavouriteRepository.Create(fav) })
+}
+
+func (r *journaledFavouriteRepository) Update(fav *models.Favourite) error {
+	return r.j.mutate(entityFavourite, fav.ID, func() error { return r.MemoryFavouriteRepository.Update(fav) })
+}
+
+func (r *journaledFavouriteRepository) Delete(favID uuid.UUID) error {
+	return r.j.mutate(entityFavourite, favID, func() error { return r.MemoryFavouriteRepository.Delete(favID) })
+}
+
+func (r *journaledFavouriteRepository) DeleteByUser(userID uuid.UUID) ([]uuid.UUID, error) {
+	return r.deleteMany(func() ([]uuid.UUID, error) { return r.MemoryFavouriteRepository.DeleteByUser(userID) })
+}
+
+func (r *journaledFavouriteRepository) DeleteByAsset(assetID uuid.UUID) ([]uuid.UUID, error) {
+	return r.deleteMany(func() ([]uuid.UUID, error) { return r.MemoryFavouriteRepository.DeleteByAsset(assetID) })
+}
+
+func (r *journaledFavouriteRepository) deleteMany(fn func() ([]uuid.UUID, error)) ([]uuid.UUID, error) {
+	var deleted []uuid.UUID
+	err := r.j.mutateMany(entityFavourite, func() ([]uuid.UUID, error) {
+		var err error
+		deleted, err = fn()
+		return deleted, err
+	})
+	return deleted, err
+}
+
+type journaledCollectionRepository struct {
+	*MemoryCollectionRepository
+	j *Journal
+}
+
+func (r *journaledCollectionRepository) Create(collection *models.Collection) error {
+	return r.j.mutate(entityCollection, collection.ID, func() error { return r.MemoryCollectionRepository.Create(collection) })
+}
+
+func (r *journaledCollectionRepository) Rename(id uuid.UUID, name string) error {
+	return r.j.mutate(entityCollection, id, func() error { return r.MemoryCollectionRepository.Rename(id, name) })
+}
+
+func (r *journaledCollectionRepository) Delete(id uuid.UUID) error {
+	return r.j.mutate(entityCollection, id, func() error { return r.MemoryCollectionRepository.Delete(id) })
+}
+
+func (r *journaledCollectionRepository) AddItem(id, favID uuid.UUID, position int) error {
+	return r.j.mutate(entityCollection, id, func() error { return r.MemoryCollectionRepository.AddItem(id, favID, position) })
+}
+
+func (r *journaledCollectionRepository) RemoveItem(id, favID uuid.UUID) error {
+	return r.j.mutate(entityCollection, id, func() error { return r.MemoryCollectionRepository.RemoveItem(id, favID) })
+}
+
+func (r *journaledCollectionRepository) Reorder(id uuid.UUID, favIDs []uuid.UUID) error {
+	return r.j.mutate(entityCollection, id, func() error { return r.MemoryCollectionRepository.Reorder(id, favIDs) })
+}
+
+func (r *journaledCollectionRepository) RemoveFavourite(favID uuid.UUID) error {
+	return r.j.mutateMany(entityCollection, func() ([]uuid.UUID, error) {
+		return r.MemoryCollectionRepository.removeFavourite(favID), nil
+	})
+}
+
+func (r *journaledCollectionRepository) DeleteByUser(userID uuid.UUID) error {
+	return r.j.mutateMany(entityCollection, func() ([]uuid.UUID, error) {
+		return r.MemoryCollectionRepository.deleteByUser(userID), nil
+	})
+}
+
+type journaledAssetVersionRepository struct {
+	*MemoryAssetVersionRepository
+	j *Journal
+}
+
+func (r *journaledAssetVersionRepository) Add(version *models.AssetVersion) error {
+	return r.j.mutate(entityVersion, version.ID, func() error { return r.MemoryAssetVersionRepository.Add(version) })
+}
+
+func (r *journaledAssetVersionRepository) Delete(id uuid.UUID) error {
+	return r.j.mutate(entityVersion, id, func() error { return r.MemoryAssetVersionRepository.Delete(id) })
+}
+
+func (r *journaledAssetVersionRepository) DeleteByAsset(assetID uuid.UUID) error {
+	return r.j.mutateMany(entityVersion, func() ([]uuid.UUID, error) {
+		return r.MemoryAssetVersionRepository.deleteByAsset(assetID), nil
+	})
+}
+
+type journaledAuditRepository struct {
+	*MemoryAuditRepository
+	j *Journal
+}
+
+func (r *journaledAuditRepository) Append(entry *models.AuditEntry) error {
+	return r.j.mutate(entityAudit, entry.ID, func() error { return r.MemoryAuditRepository.Append(entry) })
+}
@@ -0,0 +1,49 @@
+CREATE TABLE users (
+    id          TEXT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    email       TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE assets (
+    id          TEXT PRIMARY KEY,
+    type        TEXT NOT NULL,
+    description TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE chart (
+    asset_id    TEXT PRIMARY KEY REFERENCES assets(id),
+    title       TEXT NOT NULL,
+    x_axis      TEXT NOT NULL,
+    y_axis      TEXT NOT NULL,
+    data        TEXT NOT NULL
+);
+
+CREATE TABLE insight (
+    asset_id    TEXT PRIMARY KEY REFERENCES assets(id),
+    text        TEXT NOT NULL
+);
+
+CREATE TABLE audience (
+    asset_id       TEXT PRIMARY KEY REFERENCES assets(id),
+    gender         TEXT NOT NULL,
+    birth_country  TEXT NOT NULL,
+    age_group      TEXT NOT NULL,
+    hours_social   INTEGER NOT NULL,
+    purchases_last INTEGER NOT NULL
+);
+
+-- Favourites reference users and assets, but integrity on delete is
+-- handled by the services so that both backends behave the same
+CREATE TABLE favourites (
+    id          TEXT PRIMARY KEY,
+    user_id     TEXT NOT NULL,
+    asset_id    TEXT NOT NULL,
+    asset_type  TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX favourites_user_id_idx ON favourites (user_id);
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN username TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN identity_issuer TEXT;
+ALTER TABLE users ADD COLUMN identity_subject TEXT;
+
+CREATE UNIQUE INDEX users_identity_idx ON users (identity_issuer, identity_subject);
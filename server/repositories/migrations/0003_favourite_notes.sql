@@ -0,0 +1,3 @@
+ALTER TABLE favourites ADD COLUMN custom_description TEXT NOT NULL DEFAULT '';
+ALTER TABLE favourites ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE favourites ADD COLUMN updated_at TIMESTAMP;
@@ -0,0 +1,18 @@
+CREATE TABLE collections (
+    id          TEXT PRIMARY KEY,
+    user_id     TEXT NOT NULL,
+    name        TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX collections_user_id_idx ON collections (user_id);
+
+CREATE TABLE collection_items (
+    collection_id TEXT NOT NULL REFERENCES collections(id),
+    favourite_id  TEXT NOT NULL,
+    position      INTEGER NOT NULL,
+    PRIMARY KEY (collection_id, favourite_id)
+);
+
+CREATE INDEX collection_items_favourite_id_idx ON collection_items (favourite_id);
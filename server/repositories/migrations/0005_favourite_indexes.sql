@@ -0,0 +1,3 @@
+-- Lookups by asset and by (user, asset), the latter for duplicate checks
+CREATE INDEX favourites_asset_id_idx ON favourites (asset_id);
+CREATE INDEX favourites_user_asset_idx ON favourites (user_id, asset_id);
@@ -0,0 +1,9 @@
+-- Keep the oldest favourite of every (user, asset) pair, then enforce it
+DELETE FROM favourites WHERE id IN (
+    SELECT f.id FROM favourites f
+    JOIN favourites g ON g.user_id = f.user_id AND g.asset_id = f.asset_id
+    WHERE g.created_at < f.created_at OR (g.created_at = f.created_at AND g.id < f.id)
+);
+DELETE FROM collection_items WHERE favourite_id NOT IN (SELECT id FROM favourites);
+DROP INDEX favourites_user_asset_idx;
+CREATE UNIQUE INDEX favourites_user_asset_idx ON favourites (user_id, asset_id);
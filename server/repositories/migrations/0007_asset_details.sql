@@ -0,0 +1,5 @@
+-- Asset types without a table of their own keep their fields as a JSON document
+CREATE TABLE asset_details (
+    asset_id    TEXT PRIMARY KEY REFERENCES assets(id),
+    data        TEXT NOT NULL
+);
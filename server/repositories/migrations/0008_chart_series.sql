@@ -0,0 +1,2 @@
+ALTER TABLE chart ADD COLUMN x_axis_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE chart ADD COLUMN series TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+CREATE TABLE asset_versions (
+    id            TEXT PRIMARY KEY,
+    asset_id      TEXT NOT NULL,
+    version       INTEGER NOT NULL,
+    author        TEXT NOT NULL,
+    created_at    TIMESTAMP NOT NULL,
+    restored_from INTEGER NOT NULL DEFAULT 0,
+    data          TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX asset_versions_asset_id_version_idx ON asset_versions (asset_id, version);
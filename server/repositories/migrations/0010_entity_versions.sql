@@ -0,0 +1,3 @@
+-- Rows written before versions were counted start at 1, like new ones
+ALTER TABLE assets ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+-- A deleted_at set means the row is in the trash, waiting to be purged
+ALTER TABLE assets ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE assets ADD COLUMN deleted_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN deleted_by TEXT NOT NULL DEFAULT '';
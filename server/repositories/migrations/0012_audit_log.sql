@@ -0,0 +1,17 @@
+-- The audit log is only ever inserted into
+CREATE TABLE audit_log (
+    id          TEXT PRIMARY KEY,
+    at          TIMESTAMP NOT NULL,
+    actor_sub   TEXT NOT NULL,
+    actor       TEXT NOT NULL,
+    action      TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id   TEXT NOT NULL,
+    before_data TEXT,
+    after_data  TEXT,
+    request_id  TEXT NOT NULL
+);
+
+CREATE INDEX audit_log_at_idx ON audit_log (at);
+CREATE INDEX audit_log_actor_sub_idx ON audit_log (actor_sub, at);
+CREATE INDEX audit_log_target_idx ON audit_log (target_type, target_id, at);
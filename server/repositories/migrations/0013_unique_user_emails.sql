@@ -0,0 +1,7 @@
+-- Keep the email on the oldest user of every address, then enforce it
+UPDATE users SET email = '' WHERE id IN (
+    SELECT u.id FROM users u
+    JOIN users v ON LOWER(v.email) = LOWER(u.email)
+    WHERE u.email <> '' AND (v.created_at < u.created_at OR (v.created_at = u.created_at AND v.id < u.id))
+);
+CREATE UNIQUE INDEX users_email_idx ON users (LOWER(email)) WHERE email <> '';
@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/models"
+	"favourite_assets/server/search"
+)
+
+// Users and assets in the trash are hidden from every read, and fail updates
+// with a not found error, until they are restored. Delete removes them for
+// good, trashed or not.
+
+type UserRepository interface {
+	Create(user *models.User) error
+	GetByID(userID uuid.UUID) (*models.User, error)
+	// GetByIdentity finds the user linked to an external identity, even in
+	// the trash: the identity stays linked to it until it is purged
+	GetByIdentity(identity models.ExternalIdentity) (*models.User, error)
+	// GetByEmail finds the user with an email, ignoring case, even in the
+	// trash. Emails are unique, except for empty ones, which match nobody.
+	GetByEmail(email string) (*models.User, error)
+	// Update fails with ErrPreconditionFailed unless the stored user is still
+	// at user.Version, and bumps user.Version on success
+	Update(user *models.User) error
+	Delete(userID uuid.UUID) error
+	List() ([]*models.User, error)
+	// Trash moves a user into the trash, Restore takes it back out. Trash
+	// fails with ErrPreconditionFailed unless the user is still at version.
+	Trash(userID uuid.UUID, version int, deletedBy string, at time.Time) error
+	Restore(userID uuid.UUID) error
+	ListTrash() ([]*models.User, error)
+	// GetTrashed returns a user that is in the trash
+	GetTrashed(userID uuid.UUID) (*models.User, error)
+}
+
+type AssetRepository interface {
+	Create(asset models.Asset) error
+	GetByID(id uuid.UUID) (models.Asset, error)
+	// GetByIDs returns the assets that exist among ids, keyed by ID
+	GetByIDs(ids []uuid.UUID) (map[uuid.UUID]models.Asset, error)
+	// Update fails with ErrPreconditionFailed unless the stored asset is
+	// still at the asset's version, and bumps the version on success
+	Update(asset models.Asset) error
+	Delete(id uuid.UUID) error
+	ListAll() ([]models.Asset, error)
+	// Trash moves an asset into the trash, Restore takes it back out
+	Trash(id uuid.UUID, deletedBy string, at time.Time) error
+	Restore(id uuid.UUID) error
+	ListTrash() ([]models.Asset, error)
+	// GetTrashed returns an asset that is in the trash
+	GetTrashed(id uuid.UUID) (models.Asset, error)
+	// Search ranks assets against a free-text query, using an index that is
+	// kept up to date by the writes above
+	Search(q search.Query) ([]search.Hit, error)
+}
+
+type FavouriteRepository interface {
+	// Create fails with ErrFavouriteDuplicate if the user already has a
+	// favourite for the asset, atomically with the insert
+	Create(fav *models.Favourite) error
+	GetByID(favID uuid.UUID) (*models.Favourite, error)
+	// Update saves the user editable fields of a favourite
+	Update(fav *models.Favourite) error
+	Delete(favID uuid.UUID) error
+	ListByUser(userID uuid.UUID) ([]*models.Favourite, error)
+	ListByAsset(assetID uuid.UUID) ([]*models.Favourite, error)
+	// GetByUserAndAsset finds the favourite a user holds for an asset
+	GetByUserAndAsset(userID, assetID uuid.UUID) (*models.Favourite, error)
+	// DeleteByUser and DeleteByAsset remove every matching favourite and
+	// return the IDs they removed
+	DeleteByUser(userID uuid.UUID) ([]uuid.UUID, error)
+	DeleteByAsset(assetID uuid.UUID) ([]uuid.UUID, error)
+}
+
+type CollectionRepository interface {
+	Create(collection *models.Collection) error
+	GetByID(id uuid.UUID) (*models.Collection, error)
+	ListByUser(userID uuid.UUID) ([]*models.Collection, error)
+	Rename(id uuid.UUID, name string) error
+	Delete(id uuid.UUID) error
+	// AddItem inserts favID at position, or appends it when position is out of range
+	AddItem(id, favID uuid.UUID, position int) error
+	RemoveItem(id, favID uuid.UUID) error
+	// Reorder sets the order of the items; favIDs must hold exactly the current items
+	Reorder(id uuid.UUID, favIDs []uuid.UUID) error
+	// RemoveFavourite drops favID from every collection that holds it
+	RemoveFavourite(favID uuid.UUID) error
+	DeleteByUser(userID uuid.UUID) error
+}
+
+type AssetVersionRepository interface {
+	// Add fails with ErrConflict if the asset already has a version with
+	// the same number, atomically with the insert
+	Add(version *models.AssetVersion) error
+	// List returns the versions of an asset, oldest first
+	List(assetID uuid.UUID) ([]*models.AssetVersion, error)
+	Get(assetID uuid.UUID, version int) (*models.AssetVersion, error)
+	// Delete takes back a version by its ID, when the asset write it was
+	// recorded for fails
+	Delete(id uuid.UUID) error
+	DeleteByAsset(assetID uuid.UUID) error
+}
+
+// AuditRepository is append-only: entries are never changed or deleted
+type AuditRepository interface {
+	// Append fails with ErrConflict if an entry with the same ID exists
+	Append(entry *models.AuditEntry) error
+	// Query returns the entries matching filter, oldest first
+	Query(filter models.AuditFilter) ([]*models.AuditEntry, error)
+}
+
+// Store groups the repositories of one persistence backend
+type Store struct {
+	Users       UserRepository
+	Assets      AssetRepository
+	Favourites  FavouriteRepository
+	Collections CollectionRepository
+	// AssetVersions keeps the history of every asset
+	AssetVersions AssetVersionRepository
+	// Audit records who changed what
+	Audit AuditRepository
+
+	close func() error
+}
+
+// Close releases the resources held by the backend
+func (s *Store) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
+
+// NewMemoryStore returns a store backed by the in-memory sharded maps
+func NewMemoryStore() *Store {
+	return &Store{
+		Users:         NewMemoryUserRepository(),
+		Assets:        NewMemoryAssetRepository(),
+		Favourites:    NewMemoryFavouriteRepository(),
+		Collections:   NewMemoryCollectionRepository(),
+		AssetVersions: NewMemoryAssetVersionRepository(),
+		Audit:         NewMemoryAuditRepository(),
+	}
+}
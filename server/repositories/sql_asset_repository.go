@@ -0,0 +1,390 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+	"favourite_assets/server/search"
+)
+
+// SQLAssetRepository stores the common asset fields in "assets" and the
+// type-specific ones in "chart", "insight" and "audience". Any other
+// registered type is kept as a JSON document in "asset_details".
+type SQLAssetRepository struct {
+	db *sqlDB
+	// index covers the writes of this process. It is built from the table
+	// when the store is opened, and rebuilt to pick up the writes of other
+	// processes sharing the database.
+	index atomic.Pointer[search.Index]
+	// indexMu orders the updates of the index
+	indexMu sync.Mutex
+}
+
+func newSQLAssetRepository(db *sqlDB) (*SQLAssetRepository, error) {
+	r := &SQLAssetRepository{db: db}
+	if err := r.rebuildIndex(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// rebuildIndex replaces the index with one built from the table. Writes wait
+// for it, so none is indexed into the old index and lost.
+func (r *SQLAssetRepository) rebuildIndex() error {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+	assets, err := r.ListAll()
+	if err != nil {
+		return err
+	}
+	index := search.NewIndex()
+	for _, asset := range assets {
+		indexAsset(index, asset)
+	}
+	r.index.Store(index)
+	return nil
+}
+
+// startReindexing rebuilds the index every interval until the returned
+// function is called
+func (r *SQLAssetRepository) startReindexing(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.rebuildIndex(); err != nil {
+					log.Printf("assets: rebuilding the search index failed: %v", err)
+				}
+			case <-stopped:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stopped)
+		<-done
+	}
+}
+
+// reindex refreshes the index entry of an asset after a write. It reads the
+// committed row, so concurrent writes of one asset cannot leave the index
+// with an older version.
+func (r *SQLAssetRepository) reindex(id uuid.UUID) {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+	asset, err := r.GetByID(id)
+	switch err {
+	case nil:
+		indexAsset(r.index.Load(), asset)
+	case errors.ErrAssetNotFound:
+		r.index.Load().Remove(id)
+	}
+}
+
+func (r *SQLAssetRepository) Search(q search.Query) ([]search.Hit, error) {
+	return r.index.Load().Search(q), nil
+}
+
+const assetSelect = `SELECT a.id, a.type, a.description, a.created_at, a.updated_at, a.version, a.deleted_at, a.deleted_by,
+	c.title, c.x_axis, c.y_axis, c.data, c.x_axis_type, c.series,
+	i.text,
+	au.gender, au.birth_country, au.age_group, au.hours_social, au.purchases_last,
+	d.data
+FROM assets a
+LEFT JOIN chart c ON c.asset_id = a.id
+LEFT JOIN insight i ON i.asset_id = a.id
+LEFT JOIN audience au ON au.asset_id = a.id
+LEFT JOIN asset_details d ON d.asset_id = a.id`
+
+func scanAsset(row interface{ Scan(...any) error }) (models.Asset, error) {
+	var (
+		base                            models.BaseAsset
+		assetType                       models.AssetType
+		title, xAxis, yAxis, data       sql.NullString
+		xAxisType, series               sql.NullString
+		text                            sql.NullString
+		gender, birthCountry, ageGroup  sql.NullString
+		hoursSocial, purchasesLastMonth sql.NullInt64
+		details                         sql.NullString
+		deletedAt                       sql.NullTime
+	)
+
+	err := row.Scan(&base.ID, &assetType, &base.Description, &base.CreatedAt, &base.UpdatedAt, &base.Version, &deletedAt, &base.DeletedBy,
+		&title, &xAxis, &yAxis, &data, &xAxisType, &series,
+		&text,
+		&gender, &birthCountry, &ageGroup, &hoursSocial, &purchasesLastMonth,
+		&details)
+	if err != nil {
+		return nil, err
+	}
+	base.DeletedAt = nullTime(deletedAt)
+
+	switch assetType {
+	case models.AssetChart:
+		chart := &models.Chart{
+			BaseAsset: base,
+			Title:     title.String,
+			XAxis:     xAxis.String,
+			YAxis:     yAxis.String,
+			XAxisType: models.ChartAxisType(xAxisType.String),
+		}
+		if data.Valid && data.String != "" {
+			if err := json.Unmarshal([]byte(data.String), &chart.Data); err != nil {
+				return nil, err
+			}
+		}
+		if series.Valid && series.String != "" {
+			if err := json.Unmarshal([]byte(series.String), &chart.Series); err != nil {
+				return nil, err
+			}
+		}
+		return chart, nil
+	case models.AssetInsight:
+		return &models.Insight{BaseAsset: base, Text: text.String}, nil
+	case models.AssetAudience:
+		return &models.Audience{
+			BaseAsset:          base,
+			Gender:             gender.String,
+			BirthCountry:       birthCountry.String,
+			AgeGroup:           ageGroup.String,
+			HoursOnSocial:      int(hoursSocial.Int64),
+			PurchasesLastMonth: int(purchasesLastMonth.Int64),
+		}, nil
+	}
+
+	asset, ok := models.NewAsset(assetType)
+	if !ok || !details.Valid {
+		return nil, errors.ErrUnknownAssetType
+	}
+	if err := json.Unmarshal([]byte(details.String), asset); err != nil {
+		return nil, err
+	}
+	*asset.Base() = base
+	return asset, nil
+}
+
+func (r *SQLAssetRepository) Create(asset models.Asset) error {
+	return r.write(asset.GetID(), func(tx *sql.Tx) error {
+		base := asset.Base()
+		_, err := r.db.exec(tx,
+			`INSERT INTO assets (id, type, description, created_at, updated_at, version) VALUES (?, ?, ?, ?, ?, ?)`,
+			asset.GetID(), asset.GetType(), asset.GetDescription(), base.CreatedAt.UTC(), base.UpdatedAt.UTC(), base.Version)
+		if isUniqueViolation(err) {
+			return errors.ErrAssetExists
+		}
+		if err != nil {
+			return err
+		}
+		return r.insertDetails(tx, asset)
+	})
+}
+
+func (r *SQLAssetRepository) insertDetails(tx *sql.Tx, asset models.Asset) error {
+	var err error
+	switch a := asset.(type) {
+	case *models.Chart:
+		data, jsonErr := json.Marshal(a.Data)
+		if jsonErr != nil {
+			return jsonErr
+		}
+		series, jsonErr := json.Marshal(a.Series)
+		if jsonErr != nil {
+			return jsonErr
+		}
+		_, err = r.db.exec(tx, `INSERT INTO chart (asset_id, title, x_axis, y_axis, data, x_axis_type, series) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			a.ID, a.Title, a.XAxis, a.YAxis, string(data), a.XAxisType, string(series))
+	case *models.Insight:
+		_, err = r.db.exec(tx, `INSERT INTO insight (asset_id, text) VALUES (?, ?)`, a.ID, a.Text)
+	case *models.Audience:
+		_, err = r.db.exec(tx, `INSERT INTO audience (asset_id, gender, birth_country, age_group, hours_social, purchases_last) VALUES (?, ?, ?, ?, ?, ?)`,
+			a.ID, a.Gender, a.BirthCountry, a.AgeGroup, a.HoursOnSocial, a.PurchasesLastMonth)
+	default:
+		if _, ok := models.LookupAssetKind(asset.GetType()); !ok {
+			return errors.ErrUnknownAssetType
+		}
+		data, jsonErr := json.Marshal(asset)
+		if jsonErr != nil {
+			return jsonErr
+		}
+		_, err = r.db.exec(tx, `INSERT INTO asset_details (asset_id, data) VALUES (?, ?)`, asset.GetID(), string(data))
+	}
+	return err
+}
+
+func (r *SQLAssetRepository) deleteDetails(tx *sql.Tx, id uuid.UUID) error {
+	for _, table := range []string{"chart", "insight", "audience", "asset_details"} {
+		if _, err := r.db.exec(tx, `DELETE FROM `+table+` WHERE asset_id = ?`, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLAssetRepository) GetByID(id uuid.UUID) (models.Asset, error) {
+	return r.get(r.db.db, id)
+}
+
+func (r *SQLAssetRepository) get(q execer, id uuid.UUID) (models.Asset, error) {
+	asset, err := scanAsset(r.db.queryRow(q, assetSelect+` WHERE a.id = ? AND a.deleted_at IS NULL`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrAssetNotFound
+	}
+	return asset, err
+}
+
+func (r *SQLAssetRepository) GetTrashed(id uuid.UUID) (models.Asset, error) {
+	asset, err := scanAsset(r.db.queryRow(r.db.db, assetSelect+` WHERE a.id = ? AND a.deleted_at IS NOT NULL`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrAssetNotFound
+	}
+	return asset, err
+}
+
+// maxInParams keeps IN lists below the bind parameter limits of both dialects
+const maxInParams = 500
+
+func (r *SQLAssetRepository) GetByIDs(ids []uuid.UUID) (map[uuid.UUID]models.Asset, error) {
+	result := make(map[uuid.UUID]models.Asset, len(ids))
+
+	for start := 0; start < len(ids); start += maxInParams {
+		chunk := ids[start:min(start+maxInParams, len(ids))]
+		args := make([]any, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ")
+		rows, err := r.db.query(r.db.db, assetSelect+` WHERE a.id IN (`+placeholders+`) AND a.deleted_at IS NULL`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			asset, err := scanAsset(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			result[asset.GetID()] = asset
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (r *SQLAssetRepository) Update(asset models.Asset) error {
+	base := asset.Base()
+	err := r.write(asset.GetID(), func(tx *sql.Tx) error {
+		res, err := r.db.exec(tx, `UPDATE assets SET description = ?, updated_at = ?, version = version + 1 WHERE id = ? AND version = ? AND deleted_at IS NULL`,
+			asset.GetDescription(), base.UpdatedAt.UTC(), asset.GetID(), base.Version)
+		if err != nil {
+			return err
+		}
+		if err := affectedOne(res, errors.ErrPreconditionFailed); err != nil {
+			if _, getErr := r.get(tx, asset.GetID()); getErr == errors.ErrAssetNotFound {
+				return getErr
+			}
+			return err
+		}
+		// Details are replaced wholesale, which keeps this independent of the asset type
+		if err := r.deleteDetails(tx, asset.GetID()); err != nil {
+			return err
+		}
+		return r.insertDetails(tx, asset)
+	})
+	if err != nil {
+		return err
+	}
+	base.Version++
+	return nil
+}
+
+func (r *SQLAssetRepository) Delete(id uuid.UUID) error {
+	return r.write(id, func(tx *sql.Tx) error {
+		if err := r.deleteDetails(tx, id); err != nil {
+			return err
+		}
+		res, err := r.db.exec(tx, `DELETE FROM assets WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		return affectedOne(res, errors.ErrAssetNotFound)
+	})
+}
+
+// write runs fn in a transaction and updates the index once it is committed
+func (r *SQLAssetRepository) write(id uuid.UUID, fn func(tx *sql.Tx) error) error {
+	if err := r.db.inTx(fn); err != nil {
+		return err
+	}
+	r.reindex(id)
+	return nil
+}
+
+func (r *SQLAssetRepository) Trash(id uuid.UUID, deletedBy string, at time.Time) error {
+	return r.write(id, func(tx *sql.Tx) error {
+		res, err := r.db.exec(tx, `UPDATE assets SET deleted_at = ?, deleted_by = ? WHERE id = ? AND deleted_at IS NULL`,
+			at.UTC(), deletedBy, id)
+		if err != nil {
+			return err
+		}
+		return affectedOne(res, errors.ErrAssetNotFound)
+	})
+}
+
+func (r *SQLAssetRepository) Restore(id uuid.UUID) error {
+	return r.write(id, func(tx *sql.Tx) error {
+		res, err := r.db.exec(tx, `UPDATE assets SET deleted_at = NULL, deleted_by = '' WHERE id = ? AND deleted_at IS NOT NULL`, id)
+		if err != nil {
+			return err
+		}
+		return affectedOne(res, errors.ErrAssetNotFound)
+	})
+}
+
+func (r *SQLAssetRepository) ListAll() ([]models.Asset, error) {
+	return r.list(` WHERE a.deleted_at IS NULL`)
+}
+
+func (r *SQLAssetRepository) ListTrash() ([]models.Asset, error) {
+	return r.list(` WHERE a.deleted_at IS NOT NULL`)
+}
+
+func (r *SQLAssetRepository) list(where string) ([]models.Asset, error) {
+	rows, err := r.db.query(r.db.db, assetSelect+where)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.Asset{}
+	for rows.Next() {
+		asset, err := scanAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, asset)
+	}
+	return result, rows.Err()
+}
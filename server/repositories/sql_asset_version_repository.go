@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+// SQLAssetVersionRepository stores asset versions in "asset_versions", with
+// the snapshot encoded as JSON
+type SQLAssetVersionRepository struct {
+	db *sqlDB
+}
+
+const assetVersionColumns = `id, asset_id, version, author, created_at, restored_from, data`
+
+func scanAssetVersion(row interface{ Scan(...any) error }) (*models.AssetVersion, error) {
+	v := &models.AssetVersion{}
+	var data string
+	if err := row.Scan(&v.ID, &v.AssetID, &v.Version, &v.Author, &v.CreatedAt, &v.RestoredFrom, &data); err != nil {
+		return nil, err
+	}
+	asset, err := models.DecodeAsset([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	v.Asset = asset
+	return v, nil
+}
+
+func (r *SQLAssetVersionRepository) Add(version *models.AssetVersion) error {
+	data, err := json.Marshal(version.Asset)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.exec(r.db.db,
+		`INSERT INTO asset_versions (`+assetVersionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		version.ID, version.AssetID, version.Version, version.Author, version.CreatedAt.UTC(), version.RestoredFrom, string(data))
+	if isUniqueViolation(err) {
+		return errors.ErrConflict
+	}
+	return err
+}
+
+func (r *SQLAssetVersionRepository) List(assetID uuid.UUID) ([]*models.AssetVersion, error) {
+	rows, err := r.db.query(r.db.db,
+		`SELECT `+assetVersionColumns+` FROM asset_versions WHERE asset_id = ? ORDER BY version`, assetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*models.AssetVersion{}
+	for rows.Next() {
+		v, err := scanAssetVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+func (r *SQLAssetVersionRepository) Get(assetID uuid.UUID, version int) (*models.AssetVersion, error) {
+	v, err := scanAssetVersion(r.db.queryRow(r.db.db,
+		`SELECT `+assetVersionColumns+` FROM asset_versions WHERE asset_id = ? AND version = ?`, assetID, version))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrVersionNotFound
+	}
+	return v, err
+}
+
+func (r *SQLAssetVersionRepository) Delete(id uuid.UUID) error {
+	res, err := r.db.exec(r.db.db, `DELETE FROM asset_versions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res, errors.ErrVersionNotFound)
+}
+
+func (r *SQLAssetVersionRepository) DeleteByAsset(assetID uuid.UUID) error {
+	_, err := r.db.exec(r.db.db, `DELETE FROM asset_versions WHERE asset_id = ?`, assetID)
+	return err
+}
@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+// SQLAuditRepository stores the audit log in "audit_log", with the actor and
+// the snapshots encoded as JSON. The actor's subject has its own column so
+// the log can be filtered by it.
+type SQLAuditRepository struct {
+	db *sqlDB
+}
+
+const auditColumns = `id, at, actor, action, target_type, target_id, before_data, after_data, request_id`
+
+func scanAuditEntry(row interface{ Scan(...any) error }) (*models.AuditEntry, error) {
+	entry := &models.AuditEntry{}
+	var actor string
+	var before, after sql.NullString
+	if err := row.Scan(&entry.ID, &entry.Time, &actor, &entry.Action, &entry.TargetType, &entry.TargetID,
+		&before, &after, &entry.RequestID); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(actor), &entry.Actor); err != nil {
+		return nil, err
+	}
+	if before.Valid {
+		entry.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		entry.After = json.RawMessage(after.String)
+	}
+	return entry, nil
+}
+
+// nullJSON maps an empty snapshot to NULL
+func nullJSON(data json.RawMessage) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+func (r *SQLAuditRepository) Append(entry *models.AuditEntry) error {
+	actor, err := json.Marshal(entry.Actor)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.exec(r.db.db,
+		`INSERT INTO audit_log (actor_sub, `+auditColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Actor.Subject, entry.ID, entry.Time.UTC(), string(actor), entry.Action, entry.TargetType, entry.TargetID,
+		nullJSON(entry.Before), nullJSON(entry.After), entry.RequestID)
+	if isUniqueViolation(err) {
+		return errors.ErrConflict
+	}
+	return err
+}
+
+func (r *SQLAuditRepository) Query(filter models.AuditFilter) ([]*models.AuditEntry, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if filter.Actor != "" {
+		where, args = append(where, `actor_sub = ?`), append(args, filter.Actor)
+	}
+	if filter.TargetType != "" {
+		where, args = append(where, `target_type = ?`), append(args, filter.TargetType)
+	}
+	if filter.TargetID != uuid.Nil {
+		where, args = append(where, `target_id = ?`), append(args, filter.TargetID)
+	}
+	if !filter.From.IsZero() {
+		where, args = append(where, `at >= ?`), append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where, args = append(where, `at < ?`), append(args, filter.To.UTC())
+	}
+
+	query := `SELECT ` + auditColumns + ` FROM audit_log`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	rows, err := r.db.query(r.db.db, query+` ORDER BY at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*models.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,215 @@
+package repositories
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+// SQLCollectionRepository stores collections in "collections" and their
+// ordered favourites in "collection_items"
+type SQLCollectionRepository struct {
+	db *sqlDB
+}
+
+const collectionColumns = `id, user_id, name, created_at, updated_at`
+
+func scanCollection(row interface{ Scan(...any) error }) (*models.Collection, error) {
+	c := &models.Collection{FavouriteIDs: []uuid.UUID{}}
+	if err := row.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *SQLCollectionRepository) Create(collection *models.Collection) error {
+	return r.db.inTx(func(tx *sql.Tx) error {
+		_, err := r.db.exec(tx,
+			`INSERT INTO collections (`+collectionColumns+`) VALUES (?, ?, ?, ?, ?)`,
+			collection.ID, collection.UserID, collection.Name, collection.CreatedAt.UTC(), collection.UpdatedAt.UTC())
+		if isUniqueViolation(err) {
+			return errors.ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+		return r.writeItems(tx, collection.ID, collection.FavouriteIDs)
+	})
+}
+
+func (r *SQLCollectionRepository) GetByID(id uuid.UUID) (*models.Collection, error) {
+	return r.get(r.db.db, id)
+}
+
+func (r *SQLCollectionRepository) get(q execer, id uuid.UUID) (*models.Collection, error) {
+	collection, err := scanCollection(r.db.queryRow(q, `SELECT `+collectionColumns+` FROM collections WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrCollectionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := r.items(q, id)
+	if err != nil {
+		return nil, err
+	}
+	collection.FavouriteIDs = items
+	return collection, nil
+}
+
+func (r *SQLCollectionRepository) items(q execer, id uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.query(q, `SELECT favourite_id FROM collection_items WHERE collection_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []uuid.UUID{}
+	for rows.Next() {
+		var favID uuid.UUID
+		if err := rows.Scan(&favID); err != nil {
+			return nil, err
+		}
+		items = append(items, favID)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLCollectionRepository) ListByUser(userID uuid.UUID) ([]*models.Collection, error) {
+	rows, err := r.db.query(r.db.db, `SELECT `+collectionColumns+` FROM collections WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*models.Collection{}
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result = append(result, collection)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, collection := range result {
+		if collection.FavouriteIDs, err = r.items(r.db.db, collection.ID); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (r *SQLCollectionRepository) Rename(id uuid.UUID, name string) error {
+	res, err := r.db.exec(r.db.db, `UPDATE collections SET name = ?, updated_at = ? WHERE id = ?`, name, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res, errors.ErrCollectionNotFound)
+}
+
+func (r *SQLCollectionRepository) Delete(id uuid.UUID) error {
+	return r.db.inTx(func(tx *sql.Tx) error {
+		if _, err := r.db.exec(tx, `DELETE FROM collection_items WHERE collection_id = ?`, id); err != nil {
+			return err
+		}
+		res, err := r.db.exec(tx, `DELETE FROM collections WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		return affectedOne(res, errors.ErrCollectionNotFound)
+	})
+}
+
+// modifyItems loads the ordered items, lets fn rearrange them and writes
+// them back in one transaction
+func (r *SQLCollectionRepository) modifyItems(id uuid.UUID, fn func(items []uuid.UUID) ([]uuid.UUID, error)) error {
+	return r.db.inTx(func(tx *sql.Tx) error {
+		// Touch the row first so concurrent changes to the same collection are serialized
+		res, err := r.db.exec(tx, `UPDATE collections SET updated_at = ? WHERE id = ?`, time.Now().UTC(), id)
+		if err != nil {
+			return err
+		}
+		if err := affectedOne(res, errors.ErrCollectionNotFound); err != nil {
+			return err
+		}
+
+		items, err := r.items(tx, id)
+		if err != nil {
+			return err
+		}
+		items, err = fn(items)
+		if err != nil {
+			return err
+		}
+
+		if _, err := r.db.exec(tx, `DELETE FROM collection_items WHERE collection_id = ?`, id); err != nil {
+			return err
+		}
+		return r.writeItems(tx, id, items)
+	})
+}
+
+func (r *SQLCollectionRepository) writeItems(tx *sql.Tx, id uuid.UUID, items []uuid.UUID) error {
+	for position, favID := range items {
+		if _, err := r.db.exec(tx,
+			`INSERT INTO collection_items (collection_id, favourite_id, position) VALUES (?, ?, ?)`,
+			id, favID, position); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLCollectionRepository) AddItem(id, favID uuid.UUID, position int) error {
+	return r.modifyItems(id, func(items []uuid.UUID) ([]uuid.UUID, error) {
+		return insertItem(items, favID, position)
+	})
+}
+
+func (r *SQLCollectionRepository) RemoveItem(id, favID uuid.UUID) error {
+	return r.modifyItems(id, func(items []uuid.UUID) ([]uuid.UUID, error) {
+		i := slices.Index(items, favID)
+		if i < 0 {
+			return nil, errors.ErrFavouriteNotFound
+		}
+		return slices.Delete(items, i, i+1), nil
+	})
+}
+
+func (r *SQLCollectionRepository) Reorder(id uuid.UUID, favIDs []uuid.UUID) error {
+	return r.modifyItems(id, func(items []uuid.UUID) ([]uuid.UUID, error) {
+		if !samePermutation(items, favIDs) {
+			return nil, errors.ErrInvalidOrder
+		}
+		return favIDs, nil
+	})
+}
+
+func (r *SQLCollectionRepository) RemoveFavourite(favID uuid.UUID) error {
+	// Positions keep a gap, which does not affect the order
+	_, err := r.db.exec(r.db.db, `DELETE FROM collection_items WHERE favourite_id = ?`, favID)
+	return err
+}
+
+func (r *SQLCollectionRepository) DeleteByUser(userID uuid.UUID) error {
+	return r.db.inTx(func(tx *sql.Tx) error {
+		if _, err := r.db.exec(tx,
+			`DELETE FROM collection_items WHERE collection_id IN (SELECT id FROM collections WHERE user_id = ?)`,
+			userID); err != nil {
+			return err
+		}
+		_, err := r.db.exec(tx, `DELETE FROM collections WHERE user_id = ?`, userID)
+		return err
+	})
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+// SQLFavouriteRepository stores favourites in the "favourites" table
+type SQLFavouriteRepository struct {
+	db *sqlDB
+}
+
+const favouriteColumns = `id, user_id, asset_id, asset_type, custom_description, notes, created_at, updated_at`
+
+func scanFavourite(row interface{ Scan(...any) error }) (*models.Favourite, error) {
+	fav := &models.Favourite{}
+	var updatedAt sql.NullTime
+	if err := row.Scan(&fav.ID, &fav.UserID, &fav.AssetID, &fav.AssetType,
+		&fav.CustomDescription, &fav.Notes, &fav.CreatedAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	// Rows created before favourites could be edited have no updated_at
+	fav.UpdatedAt = fav.CreatedAt
+	if updatedAt.Valid {
+		fav.UpdatedAt = updatedAt.Time
+	}
+	return fav, nil
+}
+
+func (r *SQLFavouriteRepository) Create(fav *models.Favourite) error {
+	_, err := r.db.exec(r.db.db,
+		`INSERT INTO favourites (`+favouriteColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		fav.ID, fav.UserID, fav.AssetID, fav.AssetType,
+		fav.CustomDescription, fav.Notes, fav.CreatedAt.UTC(), fav.UpdatedAt.UTC())
+	// IDs are random, so a violation comes from the (user_id, asset_id) index
+	if isUniqueViolation(err) {
+		return errors.ErrFavouriteDuplicate
+	}
+	return err
+}
+
+func (r *SQLFavouriteRepository) GetByID(favID uuid.UUID) (*models.Favourite, error) {
+	fav, err := scanFavourite(r.db.queryRow(r.db.db, `SELECT `+favouriteColumns+` FROM favourites WHERE id = ?`, favID))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrFavouriteNotFound
+	}
+	return fav, err
+}
+
+func (r *SQLFavouriteRepository) Update(fav *models.Favourite) error {
+	now := time.Now().UTC()
+	res, err := r.db.exec(r.db.db,
+		`UPDATE favourites SET custom_description = ?, notes = ?, updated_at = ? WHERE id = ?`,
+		fav.CustomDescription, fav.Notes, now, fav.ID)
+	if err != nil {
+		return err
+	}
+	if err := affectedOne(res, errors.ErrFavouriteNotFound); err != nil {
+		return err
+	}
+
+	fav.UpdatedAt = now
+	return nil
+}
+
+func (r *SQLFavouriteRepository) Delete(favID uuid.UUID) error {
+	res, err := r.db.exec(r.db.db, `DELETE FROM favourites WHERE id = ?`, favID)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res, errors.ErrFavouriteNotFound)
+}
+
+func (r *SQLFavouriteRepository) ListByUser(userID uuid.UUID) ([]*models.Favourite, error) {
+	return r.list(`SELECT `+favouriteColumns+` FROM favourites WHERE user_id = ?`, userID)
+}
+
+func (r *SQLFavouriteRepository) ListByAsset(assetID uuid.UUID) ([]*models.Favourite, error) {
+	return r.list(`SELECT `+favouriteColumns+` FROM favourites WHERE asset_id = ?`, assetID)
+}
+
+func (r *SQLFavouriteRepository) GetByUserAndAsset(userID, assetID uuid.UUID) (*models.Favourite, error) {
+	fav, err := scanFavourite(r.db.queryRow(r.db.db,
+		`SELECT `+favouriteColumns+` FROM favourites WHERE user_id = ? AND asset_id = ?`, userID, assetID))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrFavouriteNotFound
+	}
+	return fav, err
+}
+
+func (r *SQLFavouriteRepository) DeleteByUser(userID uuid.UUID) ([]uuid.UUID, error) {
+	return r.deleteWhere(`user_id = ?`, userID)
+}
+
+func (r *SQLFavouriteRepository) DeleteByAsset(assetID uuid.UUID) ([]uuid.UUID, error) {
+	return r.deleteWhere(`asset_id = ?`, assetID)
+}
+
+// deleteWhere deletes the favourites matching cond and returns their IDs
+func (r *SQLFavouriteRepository) deleteWhere(cond string, args ...any) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.inTx(func(tx *sql.Tx) error {
+		rows, err := r.db.query(tx, `SELECT id FROM favourites WHERE `+cond, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		_, err = r.db.exec(tx, `DELETE FROM favourites WHERE `+cond, args...)
+		return err
+	})
+	return ids, err
+}
+
+func (r *SQLFavouriteRepository) list(query string, args ...any) ([]*models.Favourite, error) {
+	rows, err := r.db.query(r.db.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.Favourite
+	for rows.Next() {
+		fav, err := scanFavourite(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, fav)
+	}
+	return result, rows.Err()
+}
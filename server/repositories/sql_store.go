@@ -0,0 +1,240 @@
+package repositories
+
+import (
+	"database/sql"
+	"embed"
+	stderrors "errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Supported SQL dialects, named after their database/sql drivers
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+type sqlDB struct {
+	db      *sql.DB
+	dialect string
+}
+
+// SQLOptions tune the SQL backends
+type SQLOptions struct {
+	// ReindexInterval is how often the search index is rebuilt from the
+	// assets table, picking up the writes of other processes; 0 disables it
+	ReindexInterval time.Duration
+}
+
+// OpenSQLStore connects to a Postgres or SQLite database, applies pending
+// migrations and returns a store backed by it
+func OpenSQLStore(dialect, dsn string, opts SQLOptions) (*Store, error) {
+	if dialect != DialectPostgres && dialect != DialectSQLite {
+		return nil, fmt.Errorf("unsupported sql dialect %q", dialect)
+	}
+
+	db, err := sql.Open(dialect, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == DialectSQLite {
+		// SQLite allows a single writer, serialize access instead of failing with SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &sqlDB{db: db, dialect: dialect}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	assets, err := newSQLAssetRepository(s)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	stopReindex := assets.startReindexing(opts.ReindexInterval)
+
+	return &Store{
+		Users:         &SQLUserRepository{s},
+		Assets:        assets,
+		Favourites:    &SQLFavouriteRepository{s},
+		Collections:   &SQLCollectionRepository{s},
+		AssetVersions: &SQLAssetVersionRepository{s},
+		Audit:         &SQLAuditRepository{s},
+		close: func() error {
+			stopReindex()
+			return db.Close()
+		},
+	}, nil
+}
+
+// rebind rewrites "?" placeholders to the dialect's syntax
+func (s *sqlDB) rebind(query string) string {
+	if s.dialect != DialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (s *sqlDB) exec(q execer, query string, args ...any) (sql.Result, error) {
+	return q.Exec(s.rebind(query), args...)
+}
+
+func (s *sqlDB) query(q execer, query string, args ...any) (*sql.Rows, error) {
+	return q.Query(s.rebind(query), args...)
+}
+
+func (s *sqlDB) queryRow(q execer, query string, args ...any) *sql.Row {
+	return q.QueryRow(s.rebind(query), args...)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func (s *sqlDB) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrate applies every embedded migration that has not been recorded yet.
+// Files are named <version>_<name>.sql and run in version order.
+func (s *sqlDB) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return err
+	}
+
+	applied := map[int]bool{}
+	rows, err := s.db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[v] = true
+	}
+	rows.Close()
+
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		version, err := strconv.Atoi(strings.SplitN(entry.Name(), "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("migration %s: invalid version", entry.Name())
+		}
+		if applied[version] {
+			continue
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		err = s.inTx(func(tx *sql.Tx) error {
+			for _, stmt := range strings.Split(string(body), ";") {
+				if strings.TrimSpace(stripComments(stmt)) == "" {
+					continue
+				}
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			_, err := s.exec(tx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, version, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err was caused by a primary key or
+// unique constraint
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if stderrors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// affectedOne maps "no row matched" to notFound
+func affectedOne(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// nullTime maps a NULL timestamp to nil
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func stripComments(stmt string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(stmt, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,355 @@
+package repositories
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+	"favourite_assets/server/search"
+	"github.com/google/uuid"
+)
+
+func openSQLite(t *testing.T) *Store {
+	t.Helper()
+	store, err := OpenSQLStore(DialectSQLite, filepath.Join(t.TempDir(), "store.db"), SQLOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func newChart(title string) *models.Chart {
+	now := time.Now()
+	return &models.Chart{
+		BaseAsset: models.BaseAsset{ID: uuid.New(), Description: "monthly", CreatedAt: now, UpdatedAt: now, Version: 1},
+		Title:     title,
+		XAxis:     "month",
+		YAxis:     "amount",
+		Data:      [][2]any{{"2024-01", 10.0}, {"2024-02", 12.5}},
+	}
+}
+
+func TestSQLMigrationsRunTwice(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "store.db")
+	store, err := OpenSQLStore(DialectSQLite, dsn, SQLOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := createUser(t, store, "Ada")
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every migration is already applied, opening again must not redo any
+	store, err = OpenSQLStore(DialectSQLite, dsn, SQLOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := store.Users.GetByID(user.ID); err != nil {
+		t.Errorf("got %v, want the user kept across the reopen", err)
+	}
+}
+
+func TestSQLUserRepository(t *testing.T) {
+	store := openSQLite(t)
+	users := store.Users
+
+	user := createUser(t, store, "Ada")
+	if user.Version != 1 {
+		t.Errorf("got version %d, want 1", user.Version)
+	}
+	if err := users.Create(&models.User{ID: user.ID, Name: "Copy", Email: "copy@example.com"}); err != errors.ErrUserExists {
+		t.Errorf("got %v for a duplicate ID, want ErrUserExists", err)
+	}
+	if err := users.Create(&models.User{ID: uuid.New(), Name: "Copy", Email: "ADA@example.com"}); err != errors.ErrUserExists {
+		t.Errorf("got %v for a duplicate email, want ErrUserExists", err)
+	}
+	if got, err := users.GetByEmail("Ada@Example.com"); err != nil || got.ID != user.ID {
+		t.Errorf("got %+v (%v), want the user found by email", got, err)
+	}
+	// Empty emails are not unique
+	for i := 0; i < 2; i++ {
+		if err := users.Create(&models.User{ID: uuid.New(), Name: "Anonymous"}); err != nil {
+			t.Errorf("got %v, want users without an email created", err)
+		}
+	}
+
+	user.Name = "Ada Lovelace"
+	if err := users.Update(user); err != nil {
+		t.Fatal(err)
+	}
+	stale := *user
+	stale.Version = 1
+	if err := users.Update(&stale); err != errors.ErrPreconditionFailed {
+		t.Errorf("got %v for a stale version, want ErrPreconditionFailed", err)
+	}
+	if got, err := users.GetByID(user.ID); err != nil || got.Name != "Ada Lovelace" || got.Version != 2 {
+		t.Errorf("got %+v (%v), want the renamed user at version 2", got, err)
+	}
+
+	if err := users.Trash(user.ID, user.Version, "admin-sub", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.GetByID(user.ID); err != errors.ErrUserNotFound {
+		t.Errorf("got %v, want a trashed user hidden", err)
+	}
+	if trashed, err := users.GetTrashed(user.ID); err != nil || trashed.DeletedBy != "admin-sub" || trashed.DeletedAt == nil {
+		t.Errorf("got %+v (%v), want the user in the trash", trashed, err)
+	}
+	if err := users.Restore(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := users.List(); err != nil || len(list) != 3 {
+		t.Errorf("got %d users (%v), want the restored one", len(list), err)
+	}
+
+	if err := users.Delete(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Delete(user.ID); err != errors.ErrUserNotFound {
+		t.Errorf("got %v deleting twice, want ErrUserNotFound", err)
+	}
+}
+
+func TestSQLAssetRepository(t *testing.T) {
+	store := openSQLite(t)
+	assets := store.Assets
+
+	chart := newChart("Revenue")
+	now := time.Now()
+	insight := &models.Insight{BaseAsset: models.BaseAsset{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Version: 1}, Text: "Sales grew 20%"}
+	audience := &models.Audience{BaseAsset: models.BaseAsset{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Version: 1},
+		Gender: "female", BirthCountry: "GR", AgeGroup: "25-34", HoursOnSocial: 3, PurchasesLastMonth: 2}
+	for _, asset := range []models.Asset{chart, insight, audience} {
+		if err := assets.Create(asset); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := assets.Create(chart); err != errors.ErrAssetExists {
+		t.Errorf("got %v for a duplicate ID, want ErrAssetExists", err)
+	}
+
+	got, err := assets.GetByID(audience.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, ok := got.(*models.Audience); !ok || stored.HoursOnSocial != 3 || stored.BirthCountry != "GR" {
+		t.Errorf("got %+v, want the audience read back", got)
+	}
+
+	chart.Title = "Net revenue"
+	if err := assets.Update(chart); err != nil {
+		t.Fatal(err)
+	}
+	if chart.Version != 2 {
+		t.Errorf("got version %d, want 2", chart.Version)
+	}
+	stale := *chart
+	stale.Version = 1
+	if err := assets.Update(&stale); err != errors.ErrPreconditionFailed {
+		t.Errorf("got %v for a stale version, want ErrPreconditionFailed", err)
+	}
+	got, err = assets.GetByID(chart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored := got.(*models.Chart); stored.Title != "Net revenue" || len(stored.Data) != 2 {
+		t.Errorf("got %+v, want the updated chart with its data", stored)
+	}
+
+	if err := assets.Trash(insight.ID, "admin-sub", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	byID, err := assets.GetByIDs([]uuid.UUID{chart.ID, insight.ID, audience.ID})
+	if err != nil || len(byID) != 2 || byID[insight.ID] != nil {
+		t.Errorf("got %v (%v), want the two live assets", byID, err)
+	}
+	if _, err := assets.GetTrashed(insight.ID); err != nil {
+		t.Errorf("got %v, want the insight in the trash", err)
+	}
+	if err := assets.Restore(insight.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := assets.Delete(audience.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := assets.Delete(audience.ID); err != errors.ErrAssetNotFound {
+		t.Errorf("got %v deleting twice, want ErrAssetNotFound", err)
+	}
+	if all, err := assets.ListAll(); err != nil || len(all) != 2 {
+		t.Errorf("got %d assets (%v), want 2", len(all), err)
+	}
+}
+
+func TestSQLFavouriteRepository(t *testing.T) {
+	store := openSQLite(t)
+	favourites := store.Favourites
+
+	user := createUser(t, store, "Ada")
+	chart := newChart("Revenue")
+	if err := store.Assets.Create(chart); err != nil {
+		t.Fatal(err)
+	}
+	fav := &models.Favourite{ID: uuid.New(), UserID: user.ID, AssetID: chart.ID, AssetType: models.AssetChart, CreatedAt: time.Now()}
+	if err := favourites.Create(fav); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unique (user_id, asset_id) index maps to the duplicate error
+	again := &models.Favourite{ID: uuid.New(), UserID: user.ID, AssetID: chart.ID, AssetType: models.AssetChart, CreatedAt: time.Now()}
+	if err := favourites.Create(again); err != errors.ErrFavouriteDuplicate {
+		t.Errorf("got %v, want ErrFavouriteDuplicate", err)
+	}
+
+	fav.Notes = "for the board"
+	if err := favourites.Update(fav); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := favourites.GetByUserAndAsset(user.ID, chart.ID); err != nil || got.ID != fav.ID || got.Notes != "for the board" {
+		t.Errorf("got %+v (%v), want the updated favourite", got, err)
+	}
+	if list, err := favourites.ListByAsset(chart.ID); err != nil || len(list) != 1 {
+		t.Errorf("got %d favourites (%v) of the asset, want 1", len(list), err)
+	}
+
+	ids, err := favourites.DeleteByUser(user.ID)
+	if err != nil || !slices.Equal(ids, []uuid.UUID{fav.ID}) {
+		t.Errorf("got %v (%v), want the favourite deleted", ids, err)
+	}
+	if err := favourites.Delete(fav.ID); err != errors.ErrFavouriteNotFound {
+		t.Errorf("got %v, want ErrFavouriteNotFound", err)
+	}
+}
+
+func TestSQLCollectionRepository(t *testing.T) {
+	store := openSQLite(t)
+	collections := store.Collections
+
+	user := uuid.New()
+	favs := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	now := time.Now()
+	collection := &models.Collection{ID: uuid.New(), UserID: user, Name: "Reports", CreatedAt: now, UpdatedAt: now}
+	if err := collections.Create(collection); err != nil {
+		t.Fatal(err)
+	}
+	for _, favID := range favs {
+		if err := collections.AddItem(collection.ID, favID, -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reordered := []uuid.UUID{favs[2], favs[0], favs[1]}
+	if err := collections.Reorder(collection.ID, reordered); err != nil {
+		t.Fatal(err)
+	}
+	if err := collections.Reorder(collection.ID, favs[:2]); err != errors.ErrInvalidOrder {
+		t.Errorf("got %v for a partial order, want ErrInvalidOrder", err)
+	}
+	if err := collections.RemoveFavourite(favs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := collections.Rename(collection.ID, "Board reports"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := collections.GetByID(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Board reports" || !slices.Equal(got.FavouriteIDs, []uuid.UUID{favs[2], favs[1]}) {
+		t.Errorf("got %q with %v, want the renamed collection in the new order", got.Name, got.FavouriteIDs)
+	}
+
+	if err := collections.DeleteByUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collections.GetByID(collection.ID); err != errors.ErrCollectionNotFound {
+		t.Errorf("got %v, want ErrCollectionNotFound", err)
+	}
+}
+
+func TestSQLAssetVersionAndAuditRepositories(t *testing.T) {
+	store := openSQLite(t)
+
+	chart := newChart("Revenue")
+	for version := 1; version <= 2; version++ {
+		v := &models.AssetVersion{ID: uuid.New(), AssetID: chart.ID, Version: version, Author: "admin-sub", CreatedAt: time.Now(), Asset: chart}
+		if err := store.AssetVersions.Add(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.AssetVersions.Add(&models.AssetVersion{ID: uuid.New(), AssetID: chart.ID, Version: 2, Asset: chart}); err != errors.ErrConflict {
+		t.Errorf("got %v for a taken version number, want ErrConflict", err)
+	}
+	if got, err := store.AssetVersions.Get(chart.ID, 1); err != nil || got.Asset.(*models.Chart).Title != "Revenue" {
+		t.Errorf("got %+v (%v), want version 1 with its snapshot", got, err)
+	}
+	if err := store.AssetVersions.DeleteByAsset(chart.ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := store.AssetVersions.List(chart.ID); err != nil || len(list) != 0 {
+		t.Errorf("got %d versions (%v), want none", len(list), err)
+	}
+
+	entry := &models.AuditEntry{ID: uuid.New(), Time: time.Now(), Actor: models.Actor{Subject: "admin-sub"},
+		Action: models.AuditCreate, TargetType: models.TargetAsset, TargetID: chart.ID, After: json.RawMessage(`{"title":"Revenue"}`)}
+	if err := store.Audit.Append(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Audit.Append(entry); err != errors.ErrConflict {
+		t.Errorf("got %v appending twice, want ErrConflict", err)
+	}
+	entries, err := store.Audit.Query(models.AuditFilter{TargetID: chart.ID})
+	if err != nil || len(entries) != 1 || entries[0].Actor.Subject != "admin-sub" || string(entries[0].After) != `{"title":"Revenue"}` {
+		t.Errorf("got %+v (%v), want the entry read back", entries, err)
+	}
+}
+
+func TestSQLSearchIndexRebuild(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "store.db")
+	open := func() *Store {
+		store, err := OpenSQLStore(DialectSQLite, dsn, SQLOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	}
+	hits := func(store *Store, text string) int {
+		t.Helper()
+		found, err := store.Assets.Search(search.Query{Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(found)
+	}
+
+	// Two instances sharing the database
+	this, other := open(), open()
+	revenue := newChart("Revenue")
+	if err := this.Assets.Create(revenue); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Assets.Create(newChart("Churn")); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Assets.Trash(revenue.ID, "admin-sub", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if hits(this, "churn") != 0 || hits(this, "revenue") != 1 {
+		t.Fatal("the index saw writes of another instance before a rebuild")
+	}
+
+	if err := this.Assets.(*SQLAssetRepository).rebuildIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if hits(this, "churn") != 1 || hits(this, "revenue") != 0 {
+		t.Error("the rebuilt index does not match the table")
+	}
+}
@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+// SQLUserRepository stores users in the "users" table
+type SQLUserRepository struct {
+	db *sqlDB
+}
+
+const userColumns = `id, name, email, username, identity_issuer, identity_subject, created_at, updated_at, version, deleted_at, deleted_by`
+
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
+	user := &models.User{}
+	var issuer, subject sql.NullString
+	var deletedAt sql.NullTime
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Username, &issuer, &subject, &user.CreatedAt, &user.UpdatedAt, &user.Version,
+		&deletedAt, &user.DeletedBy); err != nil {
+		return nil, err
+	}
+	user.DeletedAt = nullTime(deletedAt)
+	if issuer.Valid && subject.Valid {
+		user.Identity = &models.ExternalIdentity{Issuer: issuer.String, Subject: subject.String}
+	}
+	return user, nil
+}
+
+// identityColumns returns the issuer and subject, or NULLs for unlinked users
+func identityColumns(user *models.User) (any, any) {
+	if user.Identity == nil {
+		return nil, nil
+	}
+	return user.Identity.Issuer, user.Identity.Subject
+}
+
+func (r *SQLUserRepository) Create(user *models.User) error {
+	now := time.Now().UTC()
+	issuer, subject := identityColumns(user)
+	_, err := r.db.exec(r.db.db,
+		`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, NULL, '')`,
+		user.ID, user.Name, user.Email, user.Username, issuer, subject, now, now)
+	if isUniqueViolation(err) {
+		return errors.ErrUserExists
+	}
+	if err != nil {
+		return err
+	}
+
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.Version = 1
+	return nil
+}
+
+func (r *SQLUserRepository) GetByID(userID uuid.UUID) (*models.User, error) {
+	user, err := scanUser(r.db.queryRow(r.db.db, `SELECT `+userColumns+` FROM users WHERE id = ? AND deleted_at IS NULL`, userID))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (r *SQLUserRepository) GetTrashed(userID uuid.UUID) (*models.User, error) {
+	user, err := scanUser(r.db.queryRow(r.db.db, `SELECT `+userColumns+` FROM users WHERE id = ? AND deleted_at IS NOT NULL`, userID))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (r *SQLUserRepository) GetByIdentity(identity models.ExternalIdentity) (*models.User, error) {
+	user, err := scanUser(r.db.queryRow(r.db.db,
+		`SELECT `+userColumns+` FROM users WHERE identity_issuer = ? AND identity_subject = ?`,
+		identity.Issuer, identity.Subject))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (r *SQLUserRepository) GetByEmail(email string) (*models.User, error) {
+	if email == "" {
+		return nil, errors.ErrUserNotFound
+	}
+	user, err := scanUser(r.db.queryRow(r.db.db,
+		`SELECT `+userColumns+` FROM users WHERE LOWER(email) = LOWER(?) AND email <> ''`, email))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (r *SQLUserRepository) Update(user *models.User) error {
+	now := time.Now().UTC()
+	issuer, subject := identityColumns(user)
+	res, err := r.db.exec(r.db.db,
+		`UPDATE users SET name = ?, email = ?, username = ?, identity_issuer = ?, identity_subject = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND version = ? AND deleted_at IS NULL`,
+		user.Name, user.Email, user.Username, issuer, subject, now, user.ID, user.Version)
+	if isUniqueViolation(err) {
+		return errors.ErrUserExists
+	}
+	if err != nil {
+		return err
+	}
+	if err := affectedOne(res, errors.ErrPreconditionFailed); err != nil {
+		if _, getErr := r.GetByID(user.ID); getErr == errors.ErrUserNotFound {
+			return getErr
+		}
+		return err
+	}
+
+	user.UpdatedAt = now
+	user.Version++
+	return nil
+}
+
+func (r *SQLUserRepository) Delete(userID uuid.UUID) error {
+	res, err := r.db.exec(r.db.db, `DELETE FROM users WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res, errors.ErrUserNotFound)
+}
+
+func (r *SQLUserRepository) Trash(userID uuid.UUID, version int, deletedBy string, at time.Time) error {
+	res, err := r.db.exec(r.db.db, `UPDATE users SET deleted_at = ?, deleted_by = ? WHERE id = ? AND version = ? AND deleted_at IS NULL`,
+		at.UTC(), deletedBy, userID, version)
+	if err != nil {
+		return err
+	}
+	if err := affectedOne(res, errors.ErrPreconditionFailed); err != nil {
+		if _, getErr := r.GetByID(userID); getErr == errors.ErrUserNotFound {
+			return getErr
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *SQLUserRepository) Restore(userID uuid.UUID) error {
+	res, err := r.db.exec(r.db.db, `UPDATE users SET deleted_at = NULL, deleted_by = '' WHERE id = ? AND deleted_at IS NOT NULL`, userID)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res, errors.ErrUserNotFound)
+}
+
+func (r *SQLUserRepository) List() ([]*models.User, error) {
+	return r.list(` WHERE deleted_at IS NULL`)
+}
+
+func (r *SQLUserRepository) ListTrash() ([]*models.User, error) {
+	return r.list(` WHERE deleted_at IS NOT NULL`)
+}
+
+func (r *SQLUserRepository) list(where string) ([]*models.User, error) {
+	rows, err := r.db.query(r.db.db, `SELECT `+userColumns+` FROM users`+where)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*models.User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, user)
+	}
+	return result, rows.Err()
+}
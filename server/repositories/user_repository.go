@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"hash/fnv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,13 +18,24 @@ type userShard struct {
 	users map[uuid.UUID]*models.User
 }
 
-type UserRepository struct {
+// MemoryUserRepository keeps users in sharded in-memory maps
+type MemoryUserRepository struct {
 	shards [userShardCount]*userShard
+
+	// identityMu guards identities and emails and is always taken before a
+	// shard lock
+	identityMu sync.Mutex
+	identities map[models.ExternalIdentity]uuid.UUID
+	// emails maps lower cased emails to their user; empty ones are left out
+	emails map[string]uuid.UUID
 }
 
-// NewUserRepository initializes the shards
-func NewUserRepository() *UserRepository {
-	r := &UserRepository{}
+// NewMemoryUserRepository initializes the shards
+func NewMemoryUserRepository() *MemoryUserRepository {
+	r := &MemoryUserRepository{
+		identities: make(map[models.ExternalIdentity]uuid.UUID),
+		emails:     make(map[string]uuid.UUID),
+	}
 	for i := 0; i < userShardCount; i++ {
 		r.shards[i] = &userShard{
 			users: make(map[uuid.UUID]*models.User),
@@ -33,13 +45,16 @@ func NewUserRepository() *UserRepository {
 }
 
 // pickShard selects a shard based on userID
-func (r *UserRepository) pickShard(userID uuid.UUID) *userShard {
+func (r *MemoryUserRepository) pickShard(userID uuid.UUID) *userShard {
 	h := fnv.New32a()
 	h.Write(userID[:])
 	return r.shards[uint(h.Sum32())%userShardCount]
 }
 
-func (r *UserRepository) Create(user *models.User) error {
+func (r *MemoryUserRepository) Create(user *models.User) error {
+	r.identityMu.Lock()
+	defer r.identityMu.Unlock()
+
 	shard := r.pickShard(user.ID)
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
@@ -47,63 +62,274 @@ func (r *UserRepository) Create(user *models.User) error {
 	if _, exists := shard.users[user.ID]; exists {
 		return errors.ErrUserExists
 	}
+	if user.Identity != nil {
+		if _, linked := r.identities[*user.Identity]; linked {
+			return errors.ErrUserExists
+		}
+	}
+	if _, taken := r.emails[emailKey(user.Email)]; taken {
+		return errors.ErrUserExists
+	}
+	if user.Identity != nil {
+		r.identities[*user.Identity] = user.ID
+	}
+	r.indexEmail(user)
 
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
-	shard.users[user.ID] = user
+	user.Version = 1
+	shard.users[user.ID] = cloneUser(user)
 	return nil
 }
 
-func (r *UserRepository) GetByID(userID uuid.UUID) (*models.User, error) {
+// emailKey is the key of email in emails, emails are compared ignoring case
+func emailKey(email string) string {
+	return strings.ToLower(email)
+}
+
+// indexEmail and unindexEmail keep emails in step with user, the caller
+// holds identityMu
+func (r *MemoryUserRepository) indexEmail(user *models.User) {
+	if user.Email != "" {
+		r.emails[emailKey(user.Email)] = user.ID
+	}
+}
+
+func (r *MemoryUserRepository) unindexEmail(user *models.User) {
+	if owner, ok := r.emails[emailKey(user.Email)]; ok && owner == user.ID {
+		delete(r.emails, emailKey(user.Email))
+	}
+}
+
+// cloneUser copies a user, so callers never share it with the store
+func cloneUser(u *models.User) *models.User {
+	clone := *u
+	if u.Identity != nil {
+		identity := *u.Identity
+		clone.Identity = &identity
+	}
+	return &clone
+}
+
+func (r *MemoryUserRepository) GetByID(userID uuid.UUID) (*models.User, error) {
 	shard := r.pickShard(userID)
 	shard.mu.RLock()
 	defer shard.mu.RUnlock()
 
 	user, ok := shard.users[userID]
+	if !ok || user.DeletedAt != nil {
+		return nil, errors.ErrUserNotFound
+	}
+	return cloneUser(user), nil
+}
+
+func (r *MemoryUserRepository) GetByIdentity(identity models.ExternalIdentity) (*models.User, error) {
+	r.identityMu.Lock()
+	userID, ok := r.identities[identity]
+	r.identityMu.Unlock()
+
+	if !ok {
+		return nil, errors.ErrUserNotFound
+	}
+	user, ok := r.lookup(userID)
 	if !ok {
 		return nil, errors.ErrUserNotFound
 	}
 	return user, nil
 }
 
-func (r *UserRepository) Update(user *models.User) error {
+func (r *MemoryUserRepository) GetByEmail(email string) (*models.User, error) {
+	if email == "" {
+		return nil, errors.ErrUserNotFound
+	}
+	r.identityMu.Lock()
+	userID, ok := r.emails[emailKey(email)]
+	r.identityMu.Unlock()
+
+	if !ok {
+		return nil, errors.ErrUserNotFound
+	}
+	user, ok := r.lookup(userID)
+	if !ok {
+		return nil, errors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (r *MemoryUserRepository) Update(user *models.User) error {
+	r.identityMu.Lock()
+	defer r.identityMu.Unlock()
+
 	shard := r.pickShard(user.ID)
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
 	existing, ok := shard.users[user.ID]
-	if !ok {
+	if !ok || existing.DeletedAt != nil {
 		return errors.ErrUserNotFound
 	}
+	if existing.Version != user.Version {
+		return errors.ErrPreconditionFailed
+	}
+
+	if user.Identity != nil {
+		if owner, linked := r.identities[*user.Identity]; linked && owner != user.ID {
+			return errors.ErrUserExists
+		}
+	}
+	if owner, taken := r.emails[emailKey(user.Email)]; taken && owner != user.ID {
+		return errors.ErrUserExists
+	}
+	if existing.Identity != nil {
+		delete(r.identities, *existing.Identity)
+	}
+	if user.Identity != nil {
+		identity := *user.Identity
+		r.identities[identity] = user.ID
+		existing.Identity = &identity
+	} else {
+		existing.Identity = nil
+	}
+
+	r.unindexEmail(existing)
+	r.indexEmail(user)
 
 	existing.Name = user.Name
 	existing.Email = user.Email
+	existing.Username = user.Username
 	existing.UpdatedAt = time.Now()
+	existing.Version++
+	user.UpdatedAt = existing.UpdatedAt
+	user.Version = existing.Version
 	return nil
 }
 
-func (r *UserRepository) Delete(userID uuid.UUID) error {
+func (r *MemoryUserRepository) Delete(userID uuid.UUID) error {
+	r.identityMu.Lock()
+	defer r.identityMu.Unlock()
+
 	shard := r.pickShard(userID)
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
-	if _, ok := shard.users[userID]; !ok {
+	user, ok := shard.users[userID]
+	if !ok {
 		return errors.ErrUserNotFound
 	}
 
+	if user.Identity != nil {
+		delete(r.identities, *user.Identity)
+	}
+	r.unindexEmail(user)
 	delete(shard.users, userID)
 	return nil
 }
 
-func (r *UserRepository) List() []*models.User {
+func (r *MemoryUserRepository) List() ([]*models.User, error) {
+	return r.list(func(user *models.User) bool { return user.DeletedAt == nil }), nil
+}
+
+func (r *MemoryUserRepository) ListTrash() ([]*models.User, error) {
+	return r.list(func(user *models.User) bool { return user.DeletedAt != nil }), nil
+}
+
+func (r *MemoryUserRepository) list(keep func(*models.User) bool) []*models.User {
 	result := make([]*models.User, 0)
 	for i := 0; i < userShardCount; i++ {
 		shard := r.shards[i]
 		shard.mu.RLock()
 		for _, user := range shard.users {
-			result = append(result, user)
+			if keep(user) {
+				result = append(result, cloneUser(user))
+			}
 		}
 		shard.mu.RUnlock()
 	}
 	return result
-}
\ No newline at end of file
+}
+
+func (r *MemoryUserRepository) Trash(userID uuid.UUID, version int, deletedBy string, at time.Time) error {
+	shard := r.pickShard(userID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	user, ok := shard.users[userID]
+	if !ok || user.DeletedAt != nil {
+		return errors.ErrUserNotFound
+	}
+	if user.Version != version {
+		return errors.ErrPreconditionFailed
+	}
+	user.DeletedAt = &at
+	user.DeletedBy = deletedBy
+	return nil
+}
+
+func (r *MemoryUserRepository) Restore(userID uuid.UUID) error {
+	shard := r.pickShard(userID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	user, ok := shard.users[userID]
+	if !ok || user.DeletedAt == nil {
+		return errors.ErrUserNotFound
+	}
+	user.DeletedAt = nil
+	user.DeletedBy = ""
+	return nil
+}
+
+func (r *MemoryUserRepository) GetTrashed(userID uuid.UUID) (*models.User, error) {
+	user, ok := r.lookup(userID)
+	if !ok || user.DeletedAt == nil {
+		return nil, errors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// lookup returns a user whether or not it is in the trash
+func (r *MemoryUserRepository) lookup(userID uuid.UUID) (*models.User, bool) {
+	shard := r.pickShard(userID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	user, ok := shard.users[userID]
+	if !ok {
+		return nil, false
+	}
+	return cloneUser(user), true
+}
+
+func (r *MemoryUserRepository) listAll() []*models.User {
+	return r.list(func(*models.User) bool { return true })
+}
+
+// restore puts a user back as-is, used when replaying the journal
+func (r *MemoryUserRepository) restore(user *models.User) {
+	r.remove(user.ID)
+
+	r.identityMu.Lock()
+	defer r.identityMu.Unlock()
+	shard := r.pickShard(user.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if user.Identity != nil {
+		r.identities[*user.Identity] = user.ID
+	}
+	r.indexEmail(user)
+	shard.users[user.ID] = user
+}
+
+func (r *MemoryUserRepository) remove(userID uuid.UUID) {
+	r.identityMu.Lock()
+	defer r.identityMu.Unlock()
+	shard := r.pickShard(userID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if user, ok := shard.users[userID]; ok {
+		if user.Identity != nil {
+			delete(r.identities, *user.Identity)
+		}
+		r.unindexEmail(user)
+	}
+	delete(shard.users, userID)
+}
@@ -11,9 +11,11 @@ func RegisterRoutes(
 	userController *controllers.UserController,
 	assetController *controllers.AssetController,
 	favController *controllers.FavouriteController,
-	authMiddleware func(next http.Handler) http.Handler,
+	collectionController *controllers.CollectionController,
+	auditController *controllers.AuditController,
+	authMiddlewares ...func(next http.Handler) http.Handler,
 ) {
-	r.Use(authMiddleware)
+	r.Use(authMiddlewares...)
 
 	// Users
 	r.Route("/users", func(r chi.Router) {
@@ -22,6 +24,9 @@ func RegisterRoutes(
 		r.Get("/by-id", userController.GetUserHandler)
 		r.Put("/", userController.UpdateUserHandler)
 		r.Delete("/", userController.DeleteUserHandler)
+		r.Get("/trash", userController.ListTrashHandler)
+		r.Post("/trash/restore", userController.RestoreTrashHandler)
+		r.Delete("/trash", userController.PurgeTrashHandler)
 	})
 
 	// Assets
@@ -29,15 +34,55 @@ func RegisterRoutes(
 		r.Post("/", assetController.CreateAssetHandler)
 		r.Get("/", assetController.ListAssetsHandler)
 		r.Get("/by-id", assetController.GetAssetHandler)
+		r.Get("/render", assetController.RenderAssetHandler)
+		r.Get("/search", assetController.SearchAssetsHandler)
 		r.Put("/", assetController.UpdateAssetHandler)
+		r.Patch("/", assetController.PatchAssetHandler)
 		r.Delete("/", assetController.DeleteAssetHandler)
+		r.Get("/versions", assetController.ListVersionsHandler)
+		r.Get("/versions/by-id", assetController.GetVersionHandler)
+		r.Get("/versions/diff", assetController.DiffVersionsHandler)
+		r.Post("/versions/restore", assetController.RestoreVersionHandler)
+		r.Get("/trash", assetController.ListTrashHandler)
+		r.Post("/trash/restore", assetController.RestoreTrashHandler)
+		r.Delete("/trash", assetController.PurgeTrashHandler)
+	})
+
+	// Audit log
+	r.Route("/audit", func(r chi.Router) {
+		r.Get("/", auditController.ListAuditHandler)
+		r.Get("/export", auditController.ExportAuditHandler)
 	})
 
 	// Favourites
 	r.Route("/favorites", func(r chi.Router) {
 		r.Post("/", favController.AddFavouriteHandler)
+		r.Patch("/", favController.UpdateFavouriteHandler)
 		r.Delete("/", favController.RemoveFavouriteHandler)
 		r.Get("/", favController.ListFavouritesHandler)
 		r.Get("/by-id", favController.GetFavouriteHandler)
 	})
+
+	// Current user
+	r.Route("/me", func(r chi.Router) {
+		r.Get("/", userController.GetMeHandler)
+		r.Route("/favourites", func(r chi.Router) {
+			r.Post("/", favController.AddMyFavouriteHandler)
+			r.Patch("/", favController.UpdateMyFavouriteHandler)
+			r.Delete("/", favController.RemoveMyFavouriteHandler)
+			r.Get("/", favController.ListMyFavouritesHandler)
+			r.Get("/by-id", favController.GetMyFavouriteHandler)
+		})
+
+		r.Route("/collections", func(r chi.Router) {
+			r.Post("/", collectionController.CreateCollectionHandler)
+			r.Get("/", collectionController.ListCollectionsHandler)
+			r.Get("/by-id", collectionController.GetCollectionHandler)
+			r.Put("/", collectionController.RenameCollectionHandler)
+			r.Delete("/", collectionController.DeleteCollectionHandler)
+			r.Post("/items", collectionController.AddItemHandler)
+			r.Delete("/items", collectionController.RemoveItemHandler)
+			r.Put("/items", collectionController.ReorderItemsHandler)
+		})
+	})
 }
\ No newline at end of file
@@ -0,0 +1,248 @@
+// Package search keeps an in-memory inverted index of documents and ranks
+// them against free-text queries with BM25.
+package search
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// BM25 parameters: k1 caps how much repeating a term counts, b how much long
+// documents are penalized
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// prefixWeight scales matches on a longer word than the one searched for
+const prefixWeight = 0.5
+
+// minPrefix is the shortest query word that also matches as a prefix
+const minPrefix = 2
+
+// Field is a piece of text of a document. Weight scales how much a match in
+// it counts, e.g. 3 for a title and 1 for body text.
+type Field struct {
+	Name   string
+	Text   string
+	Weight float64
+}
+
+// Query searches the index. All words must match, the last one may be cut
+// short. Kinds restricts the results to documents of these kinds.
+type Query struct {
+	Text  string
+	Kinds []string
+	Limit int
+}
+
+// Hit is a matching document, best first
+type Hit struct {
+	ID    uuid.UUID
+	Kind  string
+	Score float64
+}
+
+type document struct {
+	kind string
+	// terms maps each stem to its weighted number of occurrences
+	terms  map[string]float64
+	words  []string
+	length float64
+}
+
+type word struct {
+	stem string
+	docs int
+}
+
+// Index is an inverted index safe for concurrent use
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[uuid.UUID]*document
+	postings map[string]map[uuid.UUID]float64
+	// words maps every indexed word to its stem; sorted lists them for
+	// prefix lookups
+	words       map[string]*word
+	sorted      []string
+	totalLength float64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[uuid.UUID]*document),
+		postings: make(map[string]map[uuid.UUID]float64),
+		words:    make(map[string]*word),
+	}
+}
+
+// Put indexes a document, replacing an earlier version with the same ID
+func (ix *Index) Put(id uuid.UUID, kind string, fields []Field) {
+	doc := analyze(kind, fields)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+	ix.add(id, doc)
+}
+
+// Remove drops a document from the index
+func (ix *Index) Remove(id uuid.UUID) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+// Len returns the number of indexed documents
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+func analyze(kind string, fields []Field) *document {
+	doc := &document{kind: kind, terms: make(map[string]float64)}
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		for _, w := range Tokenize(f.Text) {
+			doc.terms[Stem(w)] += f.Weight
+			doc.length += f.Weight
+			if !seen[w] {
+				seen[w] = true
+				doc.words = append(doc.words, w)
+			}
+		}
+	}
+	return doc
+}
+
+func (ix *Index) add(id uuid.UUID, doc *document) {
+	ix.docs[id] = doc
+	ix.totalLength += doc.length
+	for stem, tf := range doc.terms {
+		if ix.postings[stem] == nil {
+			ix.postings[stem] = make(map[uuid.UUID]float64)
+		}
+		ix.postings[stem][id] = tf
+	}
+	for _, w := range doc.words {
+		if entry, ok := ix.words[w]; ok {
+			entry.docs++
+			continue
+		}
+		ix.words[w] = &word{stem: Stem(w), docs: 1}
+		i, _ := slices.BinarySearch(ix.sorted, w)
+		ix.sorted = slices.Insert(ix.sorted, i, w)
+	}
+}
+
+func (ix *Index) remove(id uuid.UUID) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	delete(ix.docs, id)
+	ix.totalLength -= doc.length
+	for stem := range doc.terms {
+		delete(ix.postings[stem], id)
+		if len(ix.postings[stem]) == 0 {
+			delete(ix.postings, stem)
+		}
+	}
+	for _, w := range doc.words {
+		entry := ix.words[w]
+		if entry.docs--; entry.docs > 0 {
+			continue
+		}
+		delete(ix.words, w)
+		if i, found := slices.BinarySearch(ix.sorted, w); found {
+			ix.sorted = slices.Delete(ix.sorted, i, i+1)
+		}
+	}
+}
+
+// Search returns the documents matching every word of the query, best first
+func (ix *Index) Search(q Query) []Hit {
+	words := Tokenize(q.Text)
+	if len(words) == 0 {
+		return nil
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if len(ix.docs) == 0 {
+		return nil
+	}
+	avgLength := ix.totalLength / float64(len(ix.docs))
+
+	var scores map[uuid.UUID]float64
+	for i, w := range words {
+		wordScores := make(map[uuid.UUID]float64)
+		for stem, weight := range ix.expand(w, i == len(words)-1) {
+			postings := ix.postings[stem]
+			df := float64(len(postings))
+			idf := math.Log(1 + (float64(len(ix.docs))-df+0.5)/(df+0.5))
+			for id, tf := range postings {
+				norm := tf * (k1 + 1) / (tf + k1*(1-b+b*ix.docs[id].length/avgLength))
+				wordScores[id] = max(wordScores[id], weight*idf*norm)
+			}
+		}
+
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+		for id := range scores {
+			if s, ok := wordScores[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		kind := ix.docs[id].kind
+		if len(q.Kinds) > 0 && !slices.Contains(q.Kinds, kind) {
+			continue
+		}
+		hits = append(hits, Hit{ID: id, Kind: kind, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return bytes.Compare(hits[i].ID[:], hits[j].ID[:]) < 0
+	})
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	return hits
+}
+
+// expand returns the stems a query word matches, with the weight of each
+// match. With prefix set, words starting with w match too.
+func (ix *Index) expand(w string, prefix bool) map[string]float64 {
+	matches := make(map[string]float64)
+	stem := Stem(w)
+	if _, ok := ix.postings[stem]; ok {
+		matches[stem] = 1
+	}
+	if !prefix || len(w) < minPrefix {
+		return matches
+	}
+	i, _ := slices.BinarySearch(ix.sorted, w)
+	for ; i < len(ix.sorted) && strings.HasPrefix(ix.sorted[i], w); i++ {
+		if s := ix.words[ix.sorted[i]].stem; s != stem {
+			matches[s] = max(matches[s], prefixWeight)
+		}
+	}
+	return matches
+}
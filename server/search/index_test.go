@@ -0,0 +1,105 @@
+package search
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// checkIndex rebuilds the postings, words and lengths from the documents
+// and compares them with the maintained ones
+func checkIndex(t *testing.T, ix *Index) {
+	t.Helper()
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	postings := 0
+	words := make(map[string]int)
+	var totalLength float64
+	for id, doc := range ix.docs {
+		totalLength += doc.length
+		for stem, tf := range doc.terms {
+			if got, ok := ix.postings[stem][id]; !ok || got != tf {
+				t.Errorf("posting of %q for %s is %v, want %v", stem, id, got, tf)
+			}
+			postings++
+		}
+		for _, w := range doc.words {
+			words[w]++
+		}
+	}
+
+	for stem, docs := range ix.postings {
+		if len(docs) == 0 {
+			t.Errorf("empty posting list kept for %q", stem)
+		}
+		postings -= len(docs)
+	}
+	if postings != 0 {
+		t.Errorf("postings hold %d entries more than the documents", -postings)
+	}
+	if len(ix.words) != len(words) {
+		t.Errorf("got %d words, want %d", len(ix.words), len(words))
+	}
+	for w, n := range words {
+		if entry, ok := ix.words[w]; !ok || entry.docs != n {
+			t.Errorf("word %q is counted in %v documents, want %d", w, entry, n)
+		}
+	}
+	sorted := slices.Sorted(func(yield func(string) bool) {
+		for w := range words {
+			if !yield(w) {
+				return
+			}
+		}
+	})
+	if !slices.Equal(ix.sorted, sorted) {
+		t.Errorf("sorted words are %v, want %v", ix.sorted, sorted)
+	}
+	if diff := ix.totalLength - totalLength; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("total length is %v, want %v", ix.totalLength, totalLength)
+	}
+}
+
+func TestIndexConsistency(t *testing.T) {
+	ix := NewIndex()
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+
+	ix.Put(a, "chart", []Field{{Name: "title", Text: "Monthly revenue", Weight: 3}, {Name: "description", Text: "Revenue by month", Weight: 1}})
+	ix.Put(b, "insight", []Field{{Name: "text", Text: "Revenue grew in March", Weight: 1}})
+	ix.Put(c, "chart", []Field{{Name: "title", Text: "Churn", Weight: 3}})
+	checkIndex(t, ix)
+
+	// Replacing a document drops the words only it used
+	ix.Put(a, "chart", []Field{{Name: "title", Text: "Quarterly turnover", Weight: 3}})
+	checkIndex(t, ix)
+	if hits := ix.Search(Query{Text: "monthly"}); len(hits) != 0 {
+		t.Errorf("got %v, want the replaced text gone", hits)
+	}
+	if hits := ix.Search(Query{Text: "revenue"}); len(hits) != 1 || hits[0].ID != b {
+		t.Errorf("got %v, want only the insight", hits)
+	}
+
+	ix.Remove(b)
+	ix.Remove(b)
+	checkIndex(t, ix)
+	if hits := ix.Search(Query{Text: "rev"}); len(hits) != 0 {
+		t.Errorf("got %v, want no prefix match on removed words", hits)
+	}
+
+	// Putting a removed document back restores it
+	ix.Put(b, "insight", []Field{{Name: "text", Text: "Revenue grew in March", Weight: 1}})
+	checkIndex(t, ix)
+	if hits := ix.Search(Query{Text: "revenue", Kinds: []string{"insight"}}); len(hits) != 1 {
+		t.Errorf("got %v, want the insight back", hits)
+	}
+
+	for _, id := range []uuid.UUID{a, b, c} {
+		ix.Remove(id)
+	}
+	checkIndex(t, ix)
+	if ix.Len() != 0 || len(ix.postings) != 0 || len(ix.sorted) != 0 || ix.totalLength != 0 {
+		t.Errorf("got %d documents, %d postings and %d words left, want an empty index", ix.Len(), len(ix.postings), len(ix.sorted))
+	}
+}
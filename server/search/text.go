@@ -0,0 +1,59 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopWords are too common to help find anything
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"the": true, "to": true, "was": true, "with": true,
+}
+
+// Tokenize splits text into lower case words, dropping stop words
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	result := words[:0]
+	for _, w := range words {
+		if !stopWords[w] {
+			result = append(result, w)
+		}
+	}
+	return result
+}
+
+// Stem reduces an English word to a common form by stripping plural and
+// verb endings, so that "charts" and "charting" both become "chart". It is
+// deliberately simple: it only has to map related words to the same term.
+func Stem(word string) string {
+	n := len(word)
+	switch {
+	case n > 4 && strings.HasSuffix(word, "ies"):
+		return word[:n-3] + "y"
+	case strings.HasSuffix(word, "sses"):
+		return word[:n-2]
+	case n > 5 && strings.HasSuffix(word, "ing"):
+		return undouble(word[:n-3])
+	case n > 4 && strings.HasSuffix(word, "ed") && !strings.HasSuffix(word, "eed"):
+		return undouble(word[:n-2])
+	case n > 4 && strings.HasSuffix(word, "ly"):
+		return word[:n-2]
+	case n > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us"):
+		return word[:n-1]
+	}
+	return word
+}
+
+// undouble drops a doubled final consonant left by a removed ending, as in
+// "running"
+func undouble(stem string) string {
+	n := len(stem)
+	if n > 2 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiouls", rune(stem[n-1])) {
+		return stem[:n-1]
+	}
+	return stem
+}
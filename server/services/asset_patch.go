@@ -0,0 +1,204 @@
+package services
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/etag"
+	"favourite_assets/server/models"
+	"favourite_assets/server/validation"
+
+	"github.com/google/uuid"
+)
+
+// serverAssetFields are set by the server. PUT and PATCH ignore them, so an
+// asset can be sent back as it was read, but "id" and "type" must still
+// name the stored asset.
+var serverAssetFields = []string{"id", "type", "createdAt", "updatedAt", "version", "deletedAt", "deletedBy"}
+
+// assetFieldAliases maps names accepted by older clients to the field names
+var assetFieldAliases = map[string]string{"hoursSocialDaily": "hoursOnSocial"}
+
+// PatchAsset applies a JSON Merge Patch (RFC 7396) to an asset: members of
+// patch replace the stored fields, null resets a field and anything omitted is
+// left unchanged. Every invalid field is reported in a ValidationError. The
+// result is recorded as a new version by actor. It fails with
+// ErrPreconditionFailed when ifMatch does not allow the current version.
+func (s *AssetService) PatchAsset(assetID uuid.UUID, patch json.RawMessage, actor models.Actor, ifMatch etag.Condition) (models.Asset, error) {
+	unlock := s.lockAsset(assetID)
+	defer unlock()
+
+	existing, err := s.repo.GetByID(assetID)
+	if err != nil {
+		return nil, assetLookupError(err)
+	}
+
+	if !ifMatch.Allows(existing.Base().Version) {
+		return nil, errors.ErrPreconditionFailed
+	}
+
+	current, err := assetDocument(existing)
+	if err != nil {
+		return nil, err
+	}
+	return s.applyAssetDocument(existing, current, patch, actor)
+}
+
+// ReplaceAsset overwrites every editable field of an asset with body; fields
+// missing from body are reset. The result is recorded as a new version by
+// actor. It fails with ErrPreconditionFailed when ifMatch does not allow the
+// current version.
+func (s *AssetService) ReplaceAsset(assetID uuid.UUID, body json.RawMessage, actor models.Actor, ifMatch etag.Condition) (models.Asset, error) {
+	unlock := s.lockAsset(assetID)
+	defer unlock()
+
+	existing, err := s.repo.GetByID(assetID)
+	if err != nil {
+		return nil, assetLookupError(err)
+	}
+	if !ifMatch.Allows(existing.Base().Version) {
+		return nil, errors.ErrPreconditionFailed
+	}
+	return s.applyAssetDocument(existing, map[string]any{}, body, actor)
+}
+
+// applyAssetDocument merges patch into the document of existing, decodes the
+// result into a new asset of the same type and stores it as a new version.
+// The caller holds the asset's lock.
+func (s *AssetService) applyAssetDocument(existing models.Asset, document map[string]any, patch json.RawMessage, actor models.Actor) (models.Asset, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil || members == nil {
+		return nil, errors.ErrInvalidBody
+	}
+	for alias, field := range assetFieldAliases {
+		if value, ok := members[alias]; ok {
+			if _, exists := members[field]; !exists {
+				members[field] = value
+			}
+			delete(members, alias)
+		}
+	}
+
+	// Check each member on its own, so every invalid field is reported
+	// instead of only the first one the decoder trips over
+	v := &validation.Validator{}
+	for _, field := range slices.Sorted(maps.Keys(members)) {
+		if slices.Contains(serverAssetFields, field) {
+			if !matchesStored(existing, field, members[field]) {
+				v.Add(field, "cannot be changed")
+			}
+			delete(members, field)
+			continue
+		}
+		if message := checkAssetField(existing.GetType(), field, members[field]); message != "" {
+			v.Add(field, message)
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	decodedPatch := make(map[string]any, len(members))
+	for field, value := range members {
+		var decoded any
+		if err := json.Unmarshal(value, &decoded); err != nil {
+			return nil, errors.ErrInvalidBody
+		}
+		decodedPatch[field] = decoded
+	}
+	merged, err := json.Marshal(mergePatch(document, decodedPatch))
+	if err != nil {
+		return nil, err
+	}
+
+	updated, _ := models.NewAsset(existing.GetType())
+	if err := json.Unmarshal(merged, updated); err != nil {
+		return nil, errors.ErrInvalidBody
+	}
+
+	// Work on a new value, the stored asset is untouched until Update succeeds
+	base := updated.Base()
+	base.ID = existing.GetID()
+	base.CreatedAt = existing.Base().CreatedAt
+	base.UpdatedAt = time.Now()
+
+	if err := validateAsset(updated); err != nil {
+		return nil, err
+	}
+	if _, err := s.updateVersioned(existing, updated, actor, 0); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// matchesStored reports whether a server field sent in a request agrees with
+// the stored asset. Only the ID and the type are compared, the others are
+// ignored whatever they hold.
+func matchesStored(existing models.Asset, field string, value json.RawMessage) bool {
+	switch field {
+	case "id":
+		var id uuid.UUID
+		return json.Unmarshal(value, &id) == nil && id == existing.GetID()
+	case "type":
+		var assetType string
+		return json.Unmarshal(value, &assetType) == nil && models.AssetType(strings.ToLower(assetType)) == existing.GetType()
+	}
+	return true
+}
+
+// mergePatch implements the MergePatch algorithm of RFC 7396, section 2
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// assetDocument returns the JSON object form of an asset
+func assetDocument(asset models.Asset) (map[string]any, error) {
+	raw, err := json.Marshal(asset)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]any
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// checkAssetField returns why value is not acceptable for field of an asset
+// type, or "" if it is
+func checkAssetField(assetType models.AssetType, field string, value json.RawMessage) string {
+	single, err := json.Marshal(map[string]json.RawMessage{field: value})
+	if err != nil {
+		return "is invalid"
+	}
+
+	target, _ := models.NewAsset(assetType)
+	err = validation.DecodeStrictBytes(single, target)
+	if validationErr, ok := err.(*errors.ValidationError); ok {
+		return validationErr.Fields[0].Message
+	}
+	if err != nil {
+		return "is invalid"
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/etag"
+	"favourite_assets/server/models"
+)
+
+func TestReplaceAssetServerFields(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			_, assets, _ := newServices(store, DeleteCascade, DeleteCascade)
+			asset, err := assets.CreateAsset(&models.Insight{Text: "Sales grew 20%"}, testActor)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A document read from the API goes back unchanged but for the edit
+			document, err := assetDocument(asset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			document["text"] = "Sales grew 25%"
+			document["type"] = "Insight"
+			body, err := json.Marshal(document)
+			if err != nil {
+				t.Fatal(err)
+			}
+			replaced, err := assets.ReplaceAsset(asset.GetID(), body, testActor, etag.Condition{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replaced.(*models.Insight).Text != "Sales grew 25%" || replaced.Base().Version != 2 {
+				t.Errorf("got %+v, want the new text at version 2", replaced)
+			}
+
+			for _, body := range []string{
+				`{"type": "chart", "text": "Sales grew 30%"}`,
+				`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "text": "Sales grew 30%"}`,
+			} {
+				_, err := assets.ReplaceAsset(asset.GetID(), json.RawMessage(body), testActor, etag.Condition{})
+				validationErr, ok := err.(*errors.ValidationError)
+				if !ok || len(validationErr.Fields) != 1 || validationErr.Fields[0].Message != "cannot be changed" {
+					t.Errorf("got %v for %s, want the changed field refused", err, body)
+				}
+			}
+		})
+	}
+}
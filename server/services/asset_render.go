@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"container/list"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+	"favourite_assets/server/render"
+)
+
+// renderCacheSize is the number of rendered images kept in memory
+const renderCacheSize = 128
+
+// Rendering is an asset drawn as an image
+type Rendering struct {
+	ContentType string
+	Data        []byte
+	// UpdatedAt is the version of the asset the image was drawn from
+	UpdatedAt time.Time
+}
+
+// RenderAsset draws an asset as an image. Images are cached until the asset
+// changes.
+func (s *AssetService) RenderAsset(id uuid.UUID, opts models.RenderOptions) (*Rendering, error) {
+	if !slices.Contains(render.Formats, opts.Format) {
+		return nil, errors.ErrUnsupportedFormat
+	}
+
+	asset, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	kind, ok := models.LookupAssetKind(asset.GetType())
+	if !ok || kind.Render == nil {
+		return nil, errors.ErrAssetNotRenderable
+	}
+
+	key := renderKey{id: id, opts: opts}
+	updatedAt := asset.Base().UpdatedAt
+	if cached, ok := s.renders.get(key, updatedAt); ok {
+		return cached, nil
+	}
+
+	var buf bytes.Buffer
+	if err := kind.Render(asset, opts, &buf); err != nil {
+		return nil, err
+	}
+	rendering := &Rendering{
+		ContentType: render.ContentType(opts.Format),
+		Data:        buf.Bytes(),
+		UpdatedAt:   updatedAt,
+	}
+	s.renders.put(key, rendering)
+	return rendering, nil
+}
+
+type renderKey struct {
+	id   uuid.UUID
+	opts models.RenderOptions
+}
+
+type renderEntry struct {
+	key       renderKey
+	rendering *Rendering
+}
+
+// renderCache is a least recently used cache of rendered images
+type renderCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[renderKey]*list.Element
+}
+
+func newRenderCache(size int) *renderCache {
+	return &renderCache{size: size, order: list.New(), entries: map[renderKey]*list.Element{}}
+}
+
+// get returns the cached image when it was drawn from the given version
+func (c *renderCache) get(key renderKey, updatedAt time.Time) (*Rendering, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*renderEntry)
+	if !entry.rendering.UpdatedAt.Equal(updatedAt) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return entry.rendering, true
+}
+
+func (c *renderCache) put(key renderKey, rendering *Rendering) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*renderEntry).rendering = rendering
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&renderEntry{key: key, rendering: rendering})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*renderEntry).key)
+	}
+}
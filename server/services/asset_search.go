@@ -0,0 +1,70 @@
+package services
+
+import (
+	"github.com/google/uuid"
+
+	"favourite_assets/server/models"
+	"favourite_assets/server/search"
+)
+
+// Search result limits
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// SearchResult is an asset matching a search, with its relevance
+type SearchResult struct {
+	Score float64      `json:"score"`
+	Asset models.Asset `json:"asset"`
+}
+
+// SearchAssets ranks assets against a free-text query, optionally keeping
+// only some types
+func (s *AssetService) SearchAssets(text string, types []models.AssetType, limit int) ([]SearchResult, error) {
+	q := search.Query{Text: text, Limit: limit}
+	for _, t := range types {
+		q.Kinds = append(q.Kinds, string(t))
+	}
+
+	// The index can hold assets deleted since, which are left out. Ask for
+	// more until the page is full or the index has no more hits.
+	for {
+		hits, err := s.repo.Search(q)
+		if err != nil {
+			return nil, err
+		}
+		results, err := s.searchResults(hits)
+		if err != nil {
+			return nil, err
+		}
+		if limit <= 0 || len(results) >= limit || len(hits) < q.Limit {
+			if limit > 0 && len(results) > limit {
+				results = results[:limit]
+			}
+			return results, nil
+		}
+		q.Limit *= 2
+	}
+}
+
+// searchResults pairs hits with the assets they found, leaving out those
+// that no longer exist
+func (s *AssetService) searchResults(hits []search.Hit) ([]SearchResult, error) {
+	ids := make([]uuid.UUID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	assets, err := s.repo.GetByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+	for _, hit := range hits {
+		if asset, ok := assets[hit.ID]; ok {
+			results = append(results, SearchResult{Score: hit.Score, Asset: asset})
+		}
+	}
+	return results, nil
+}
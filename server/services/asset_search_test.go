@@ -0,0 +1,55 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"favourite_assets/server/models"
+	"favourite_assets/server/repositories"
+)
+
+func TestSearchAssetsFillsPages(t *testing.T) {
+	// Two instances sharing a database: this one's index keeps what the
+	// other one deletes
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	var stores []*repositories.Store
+	for range 2 {
+		store, err := repositories.OpenSQLStore(repositories.DialectSQLite, dsn, repositories.SQLOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		stores = append(stores, store)
+	}
+	this, other := stores[0], stores[1]
+	_, assets, _ := newServices(this, DeleteCascade, DeleteCascade)
+
+	// The deleted assets rank first
+	for _, text := range []string{"Sales sales sales", "Sales sales sales", "Sales sales sales", "Sales", "Sales", "Sales"} {
+		asset, err := assets.CreateAsset(&models.Insight{Text: text}, testActor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != "Sales" {
+			if err := other.Assets.Trash(asset.GetID(), "admin-sub", time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for limit, want := range map[int]int{1: 1, 2: 2, 3: 3, 10: 3} {
+		results, err := assets.SearchAssets("sales", nil, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != want {
+			t.Errorf("limit %d: got %d results, want %d", limit, len(results), want)
+		}
+		for _, result := range results {
+			if result.Asset.(*models.Insight).Text != "Sales" {
+				t.Errorf("limit %d: got deleted asset %q", limit, result.Asset.(*models.Insight).Text)
+			}
+		}
+	}
+}
@@ -1,106 +1,207 @@
 package services
 
 import (
+	"log"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"favourite_assets/server/etag"
+	"favourite_assets/server/filter"
 	"favourite_assets/server/models"
+	"favourite_assets/server/paging"
 	"favourite_assets/server/repositories"
 	"favourite_assets/server/errors"
 
 )
 
 type AssetService struct {
-	repo *repositories.AssetRepository
+	repo         repositories.AssetRepository
+	versions     repositories.AssetVersionRepository
+	favourites   repositories.FavouriteRepository
+	collections  repositories.CollectionRepository
+	deletePolicy DeletePolicy
+	audit        *AuditLog
+	renders      *renderCache
+	// locks serializes the writes to an asset with the versions they record
+	locks [assetLockCount]sync.Mutex
 }
 
-func NewAssetService(repo *repositories.AssetRepository) *AssetService {
+func NewAssetService(
+	repo repositories.AssetRepository,
+	versions repositories.AssetVersionRepository,
+	favourites repositories.FavouriteRepository,
+	collections repositories.CollectionRepository,
+	deletePolicy DeletePolicy,
+	audit *AuditLog,
+) *AssetService {
 	return &AssetService{
-		repo: repo,
+		repo:         repo,
+		versions:     versions,
+		favourites:   favourites,
+		collections:  collections,
+		deletePolicy: deletePolicy,
+		audit:        audit,
+		renders:      newRenderCache(renderCacheSize),
 	}
 }
 
-func (s *AssetService) CreateAsset(asset models.Asset) (models.Asset, error) {
+// CreateAsset stores a new asset as its first version, authored by actor. If
+// the version or the audit entry cannot be recorded the asset is deleted
+// again.
+func (s *AssetService) CreateAsset(asset models.Asset, actor models.Actor) (models.Asset, error) {
+	if err := validateAsset(asset); err != nil {
+		return nil, err
+	}
+
 	if asset.GetID() == uuid.Nil {
-		switch a := asset.(type) {
-		case *models.Chart:
-			a.ID = uuid.New()
-			a.CreatedAt = time.Now()
-			a.UpdatedAt = time.Now()
-		case *models.Insight:
-			a.ID = uuid.New()
-			a.CreatedAt = time.Now()
-			a.UpdatedAt = time.Now()
-		case *models.Audience:
-			a.ID = uuid.New()
-			a.CreatedAt = time.Now()
-			a.UpdatedAt = time.Now()
-		default:
-			return nil, errors.ErrBadRequest
-		}
+		base := asset.Base()
+		base.ID = uuid.New()
+		base.CreatedAt = time.Now()
+		base.UpdatedAt = base.CreatedAt
 	}
+	asset.Base().Version = 1
 
 	if err := s.repo.Create(asset); err != nil {
 		return nil, err
 	}
+	version, err := s.recordVersion(asset, actor.Subject, 0)
+	if err != nil {
+		s.undoCreate(asset.GetID(), nil)
+		return nil, err
+	}
+	if err := s.audit.record(actor, models.AuditCreate, models.TargetAsset, asset.GetID(), nil, asset); err != nil {
+		s.undoCreate(asset.GetID(), version)
+		return nil, err
+	}
 	return asset, nil
 }
 
+// undoCreate deletes an asset whose creation could not be completed, with
+// its first version if that was recorded
+func (s *AssetService) undoCreate(id uuid.UUID, version *models.AssetVersion) {
+	if version != nil {
+		if err := s.versions.Delete(version.ID); err != nil {
+			log.Printf("assets: first version of %s left behind: %v", id, err)
+		}
+	}
+	if err := s.repo.Delete(id); err != nil {
+		log.Printf("assets: %s left behind by a failed create: %v", id, err)
+	}
+}
+
 func (s *AssetService) GetAsset(id uuid.UUID) (models.Asset, error) {
 	return s.repo.GetByID(id)
 }
 
-func (s *AssetService) UpdateAsset(assetID uuid.UUID, updatedData map[string]interface{}) (models.Asset, error) {
-    existing, err := s.repo.GetByID(assetID)
-    if err != nil {
-        return nil, errors.ErrNotFound
-    }
-
-    existing.SetDescription(updatedData["description"].(string))
-
-    switch a := existing.(type) {
-    case *models.Chart:
-        a.Title = updatedData["title"].(string)
-        a.XAxis = updatedData["xAxis"].(string)
-        a.YAxis = updatedData["yAxis"].(string)
-		a.UpdatedAt = time.Now() 
-    case *models.Insight:
-        a.Text = updatedData["text"].(string)
-		a.UpdatedAt = time.Now() 
-    case *models.Audience:
-        a.Gender = updatedData["gender"].(string)
-        a.BirthCountry = updatedData["birthCountry"].(string)
-        a.AgeGroup = updatedData["ageGroup"].(string)
-        a.HoursOnSocial = int(updatedData["hoursSocialDaily"].(float64))
-        a.PurchasesLastMonth = int(updatedData["purchasesLastMonth"].(float64))
-		a.UpdatedAt = time.Now() 
-    }
-
-    if err := s.repo.Update(existing); err != nil {
-        return nil, err
-    }
-
-    return existing, nil
+// QueryChart returns a chart with its data reshaped by q
+func (s *AssetService) QueryChart(id uuid.UUID, q models.ChartQuery) (*models.Chart, error) {
+	asset, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	chart, ok := asset.(*models.Chart)
+	if !ok {
+		return nil, errors.ErrNotAChart
+	}
+	return chart.Query(q)
 }
 
-func (s *AssetService) DeleteAsset(id uuid.UUID) error {
-	if err := s.repo.Delete(id); err != nil {
-		return errors.ErrNotFound
+// GetAssets returns the existing assets among ids, keyed by ID
+func (s *AssetService) GetAssets(ids []uuid.UUID) (map[uuid.UUID]models.Asset, error) {
+	return s.repo.GetByIDs(ids)
+}
+
+// DeleteAsset moves an asset into the trash on behalf of actor. Its
+// favourites are hidden until it is restored, and handled according to the
+// delete policy by PurgeAsset. It fails with ErrPreconditionFailed when
+// ifMatch does not allow the asset's current version.
+func (s *AssetService) DeleteAsset(id uuid.UUID, ifMatch etag.Condition, actor models.Actor) error {
+	unlock := s.lockAsset(id)
+	defer unlock()
+
+	existing, err := s.repo.GetByID(id)
+	if err != nil {
+		return assetLookupError(err)
+	}
+	if !ifMatch.Allows(existing.Base().Version) {
+		return errors.ErrPreconditionFailed
+	}
+
+	if s.deletePolicy == DeleteRestrict {
+		favourites, err := s.favourites.ListByAsset(id)
+		if err != nil {
+			return err
+		}
+		if len(favourites) > 0 {
+			return errors.ErrAssetHasFavourites
+		}
+	}
+
+	if err := s.repo.Trash(id, actor.Subject, time.Now()); err != nil {
+		return assetLookupError(err)
 	}
-	return nil
+	trashed, err := s.repo.GetTrashed(id)
+	if err != nil {
+		return err
+	}
+	return s.audit.record(actor, models.AuditDelete, models.TargetAsset, id, existing, trashed)
 }
 
-func (s *AssetService) ListAssets() []models.Asset {
-	return s.repo.ListAll()
+// assetLookupError reports a missing asset as ErrNotFound, as the asset
+// endpoints always have, and passes any other failure through
+func assetLookupError(err error) error {
+	if err == errors.ErrAssetNotFound {
+		return errors.ErrNotFound
+	}
+	return err
 }
 
-func (s *AssetService) ListAssetsByType(assetType models.AssetType) []models.Asset {
-	var result []models.Asset
-	for _, a := range s.repo.ListAll() {
-		if a.GetType() == assetType { 
-			result = append(result, a)
+// AssetSorts are the fields assets can be listed by
+var AssetSorts = []string{paging.SortCreatedAt, paging.SortUpdatedAt, paging.SortTitle, paging.SortDescription}
+
+// ListAssets returns a page of assets, of one type when assetType is set, and
+// the cursor of the next page. A non-empty audience filter (see
+// models.AudienceFilterFields) keeps only the audiences matching it.
+func (s *AssetService) ListAssets(assetType models.AssetType, audienceFilter filter.Filter, page paging.Page) ([]models.Asset, string, error) {
+	assets, err := s.repo.ListAll()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if assetType != "" || len(audienceFilter) > 0 {
+		var matching []models.Asset
+		for _, a := range assets {
+			if assetType != "" && a.GetType() != assetType {
+				continue
+			}
+			if len(audienceFilter) > 0 {
+				audience, ok := a.(*models.Audience)
+				if !ok || !audienceFilter.Match(audience.FilterValue) {
+					continue
+				}
+			}
+			matching = append(matching, a)
 		}
+		assets = matching
 	}
-	return result
+
+	result, next := paging.Apply(page, assets, assetKey)
+	return result, next, nil
 }
 
+func assetKey(asset models.Asset, sort string) paging.Key {
+	key := paging.Key{ID: asset.GetID()}
+	base := asset.Base()
+	switch sort {
+	case paging.SortUpdatedAt:
+		key.Value = paging.TimeKey(base.UpdatedAt)
+	case paging.SortTitle:
+		key.Value = paging.TextKey(models.AssetTitle(asset))
+	case paging.SortDescription:
+		key.Value = paging.TextKey(base.Description)
+	default:
+		key.Value = paging.TimeKey(base.CreatedAt)
+	}
+	return key
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+	"favourite_assets/server/paging"
+)
+
+// ListTrash returns a page of the assets in the trash and the cursor of the
+// next page
+func (s *AssetService) ListTrash(page paging.Page) ([]models.Asset, string, error) {
+	assets, err := s.repo.ListTrash()
+	if err != nil {
+		return nil, "", err
+	}
+	result, next := paging.Apply(page, assets, trashedAssetKey)
+	return result, next, nil
+}
+
+func trashedAssetKey(asset models.Asset, _ string) paging.Key {
+	return paging.Key{ID: asset.GetID(), Value: paging.TimeKey(*asset.Base().DeletedAt)}
+}
+
+// RestoreAsset takes an asset back out of the trash, with its favourites
+func (s *AssetService) RestoreAsset(id uuid.UUID, actor models.Actor) (models.Asset, error) {
+	unlock := s.lockAsset(id)
+	defer unlock()
+
+	trashed, err := s.repo.GetTrashed(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Restore(id); err != nil {
+		return nil, err
+	}
+	asset, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit.record(actor, models.AuditRestore, models.TargetAsset, id, trashed, asset); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// PurgeAsset deletes an asset in the trash for good, with its versions, and
+// handles the favourites pointing at it according to the delete policy
+func (s *AssetService) PurgeAsset(id uuid.UUID, actor models.Actor) error {
+	return s.purge(id, time.Time{}, actor)
+}
+
+// purge purges an asset in the trash, if it was deleted before cutoff when
+// cutoff is set
+func (s *AssetService) purge(id uuid.UUID, cutoff time.Time, actor models.Actor) error {
+	unlock := s.lockAsset(id)
+	defer unlock()
+
+	// Only assets in the trash are purged, a live one is reported as missing
+	trashed, err := s.repo.GetTrashed(id)
+	if err != nil {
+		return err
+	}
+	if !cutoff.IsZero() && !trashed.Base().DeletedAt.Before(cutoff) {
+		return errors.ErrAssetNotFound
+	}
+
+	// The asset goes last: while it is in the trash, purging again after a
+	// failed step finishes the job
+	if s.deletePolicy == DeleteCascade {
+		// With DeleteMarkUnavailable the favourites stay, and are flagged when
+		// read. A favourite added since they were listed is rolled back by
+		// FavouriteService.AddFavourite, which checks the asset again.
+		favourites, err := s.favourites.ListByAsset(id)
+		if err != nil {
+			return err
+		}
+		favIDs := make([]uuid.UUID, len(favourites))
+		for i, fav := range favourites {
+			favIDs[i] = fav.ID
+		}
+		if err := detachFavourites(s.collections, favIDs); err != nil {
+			return err
+		}
+		if _, err := s.favourites.DeleteByAsset(id); err != nil {
+			return err
+		}
+	}
+	if err := s.versions.DeleteByAsset(id); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	return s.audit.record(actor, models.AuditPurge, models.TargetAsset, id, trashed, nil)
+}
+
+// purgeExpired purges the assets deleted before cutoff and returns how many
+// were purged
+func (s *AssetService) purgeExpired(cutoff time.Time) (int, error) {
+	assets, err := s.repo.ListTrash()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, asset := range assets {
+		if !asset.Base().DeletedAt.Before(cutoff) {
+			continue
+		}
+		// Restored, deleted again or purged since it was listed
+		if err := s.purge(asset.GetID(), cutoff, models.SystemActor); err == errors.ErrAssetNotFound {
+			continue
+		} else if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// trashed returns which of ids are assets in the trash
+func (s *AssetService) trashed(ids []uuid.UUID) (map[uuid.UUID]bool, error) {
+	live, err := s.repo.GetByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uuid.UUID]bool)
+	for _, id := range ids {
+		if _, ok := live[id]; ok || result[id] {
+			continue
+		}
+		// Missing assets are rare, so they are looked up one by one
+		_, err := s.repo.GetTrashed(id)
+		if err == errors.ErrAssetNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[id] = true
+	}
+	return result, nil
+}
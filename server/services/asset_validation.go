@@ -0,0 +1,23 @@
+package services
+
+import (
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+	"favourite_assets/server/validation"
+)
+
+const maxAssetDescriptionLength = 1000
+
+// validateAsset checks an asset before it is stored, whether it was created,
+// replaced or patched
+func validateAsset(asset models.Asset) error {
+	kind, ok := models.LookupAssetKind(asset.GetType())
+	if !ok {
+		return errors.ErrUnknownAssetType
+	}
+
+	v := &validation.Validator{}
+	v.MaxLength("description", asset.GetDescription(), maxAssetDescriptionLength)
+	kind.Validate(asset, v)
+	return v.Err()
+}
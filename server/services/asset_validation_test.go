@@ -0,0 +1,48 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+	"favourite_assets/server/repositories"
+)
+
+func TestCreateAssetDescriptionOptional(t *testing.T) {
+	_, assets, _ := newServices(repositories.NewMemoryStore(), DeleteCascade, DeleteCascade)
+
+	// Create requests as the API decodes them, without a description
+	bodies := map[models.AssetType]string{
+		models.AssetChart:    `{"type": "chart", "title": "Sales", "xAxis": "month", "yAxis": "revenue", "xAxisType": "number", "data": [[1, 120.5]]}`,
+		models.AssetInsight:  `{"type": "insight", "text": "Most customers buy on weekends."}`,
+		models.AssetAudience: `{"type": "audience", "gender": "male", "birthCountry": "US", "ageGroup": "25-34", "hoursOnSocial": 3}`,
+		models.AssetReport:   `{"type": "report", "title": "Q3 trends", "sections": [{"heading": "Key findings"}]}`,
+	}
+	for assetType, body := range bodies {
+		kind, ok := models.LookupAssetKind(assetType)
+		if !ok {
+			t.Fatalf("%s: not registered", assetType)
+		}
+		asset, err := kind.Decode([]byte(body))
+		if err != nil {
+			t.Errorf("%s: got %v decoding, want no description accepted", assetType, err)
+			continue
+		}
+		created, err := assets.CreateAsset(asset, testActor)
+		if err != nil {
+			t.Errorf("%s: got %v creating, want no description accepted", assetType, err)
+			continue
+		}
+		if created.GetDescription() != "" {
+			t.Errorf("%s: got description %q, want none", assetType, created.GetDescription())
+		}
+	}
+
+	// When given, it is only limited in length
+	_, err := assets.CreateAsset(&models.Insight{BaseAsset: models.BaseAsset{Description: strings.Repeat("é", maxAssetDescriptionLength+1)}, Text: "x"}, testActor)
+	validationErr, ok := err.(*errors.ValidationError)
+	if !ok || len(validationErr.Fields) != 1 || validationErr.Fields[0].Field != "description" {
+		t.Errorf("got %v, want a field error for description", err)
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"hash/fnv"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+// assetLockCount is the number of locks the writes to assets are spread over
+const assetLockCount = 64
+
+// lockAsset serializes writes to an asset, so versions are numbered in the
+// order the writes happen, and returns the unlock function
+func (s *AssetService) lockAsset(id uuid.UUID) func() {
+	h := fnv.New32a()
+	h.Write(id[:])
+	mu := &s.locks[h.Sum32()%assetLockCount]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// recordVersion stores the current state of asset under its version number
+func (s *AssetService) recordVersion(asset models.Asset, author string, restoredFrom int) (*models.AssetVersion, error) {
+	snapshot, err := models.CloneAsset(asset)
+	if err != nil {
+		return nil, err
+	}
+	version := &models.AssetVersion{
+		ID:           uuid.New(),
+		AssetID:      asset.GetID(),
+		Version:      asset.Base().Version,
+		Author:       author,
+		CreatedAt:    asset.Base().UpdatedAt,
+		RestoredFrom: restoredFrom,
+		Asset:        snapshot,
+	}
+	if err := s.versions.Add(version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// updateVersioned replaces existing with updated and records it as the next
+// version, authored by actor, and in the audit log. Assets stored before
+// versioning get their prior state recorded first, without an author. The
+// version is recorded before the asset is written and taken back if the
+// write fails, so the history never misses a state the asset had. The
+// caller holds the asset's lock.
+func (s *AssetService) updateVersioned(existing, updated models.Asset, actor models.Actor, restoredFrom int) (*models.AssetVersion, error) {
+	versions, err := s.versions.List(existing.GetID())
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		if _, err := s.recordVersion(existing, "", 0); err != nil {
+			return nil, err
+		}
+	}
+
+	updated.Base().Version = existing.Base().Version + 1
+	version, err := s.recordVersion(updated, actor.Subject, restoredFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	// The repository only writes over the version that was read, and bumps it
+	updated.Base().Version = existing.Base().Version
+	if err := s.repo.Update(updated); err != nil {
+		if undoErr := s.versions.Delete(version.ID); undoErr != nil {
+			log.Printf("assets: version %d of %s recorded for a failed update: %v", version.Version, version.AssetID, undoErr)
+		}
+		return nil, err
+	}
+	if err := s.audit.record(actor, models.AuditUpdate, models.TargetAsset, updated.GetID(), existing, updated); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// ListVersions returns the versions of an asset, oldest first
+func (s *AssetService) ListVersions(assetID uuid.UUID) ([]*models.AssetVersion, error) {
+	asset, err := s.repo.GetByID(assetID)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.versions.List(assetID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		// Not changed since before versioning, its current state is the only version
+		versions = append(versions, &models.AssetVersion{
+			AssetID:   assetID,
+			Version:   asset.Base().Version,
+			CreatedAt: asset.Base().UpdatedAt,
+			Asset:     asset,
+		})
+	}
+	return versions, nil
+}
+
+// GetVersion returns one version of an asset
+func (s *AssetService) GetVersion(assetID uuid.UUID, number int) (*models.AssetVersion, error) {
+	versions, err := s.ListVersions(assetID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		if v.Version == number {
+			return v, nil
+		}
+	}
+	return nil, errors.ErrVersionNotFound
+}
+
+// DiffVersions lists the fields that changed from one version of an asset
+// to another
+func (s *AssetService) DiffVersions(assetID uuid.UUID, from, to int) (*models.AssetVersionDiff, error) {
+	before, err := s.GetVersion(assetID, from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.GetVersion(assetID, to)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := models.DiffAssets(before.Asset, after.Asset)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AssetVersionDiff{AssetID: assetID, From: from, To: to, Changes: changes}, nil
+}
+
+// RestoreVersion brings back the content of an old version. The history is
+// kept: the result is recorded as a new version by actor.
+func (s *AssetService) RestoreVersion(assetID uuid.UUID, number int, actor models.Actor) (*models.AssetVersion, error) {
+	unlock := s.lockAsset(assetID)
+	defer unlock()
+
+	existing, err := s.repo.GetByID(assetID)
+	if err != nil {
+		return nil, err
+	}
+	old, err := s.GetVersion(assetID, number)
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := models.CloneAsset(old.Asset)
+	if err != nil {
+		return nil, err
+	}
+	base := restored.Base()
+	base.ID = assetID
+	base.CreatedAt = existing.Base().CreatedAt
+	base.UpdatedAt = time.Now()
+
+	if err := validateAsset(restored); err != nil {
+		return nil, err
+	}
+	return s.updateVersioned(existing, restored, actor, number)
+}
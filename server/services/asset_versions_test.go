@@ -0,0 +1,94 @@
+package services
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/etag"
+	"favourite_assets/server/models"
+	"favourite_assets/server/repositories"
+)
+
+var errStorage = stderrors.New("storage unavailable")
+
+// failingAssets fails asset updates once failUpdate is set
+type failingAssets struct {
+	repositories.AssetRepository
+	failUpdate bool
+}
+
+func (r *failingAssets) Update(asset models.Asset) error {
+	if r.failUpdate {
+		return errStorage
+	}
+	return r.AssetRepository.Update(asset)
+}
+
+// failingVersions fails every version write
+type failingVersions struct {
+	repositories.AssetVersionRepository
+}
+
+func (r *failingVersions) Add(*models.AssetVersion) error {
+	return errStorage
+}
+
+func TestVersionedWritesStayConsistent(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			repo := &failingAssets{AssetRepository: store.Assets}
+			assets := NewAssetService(repo, store.AssetVersions, store.Favourites, store.Collections, DeleteCascade, NewAuditLog(store.Audit))
+
+			asset, err := assets.CreateAsset(&models.Insight{Text: "Sales grew 20%"}, testActor)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A failed update takes back the version recorded for it
+			repo.failUpdate = true
+			if _, err := assets.PatchAsset(asset.GetID(), []byte(`{"text": "Sales grew 25%"}`), testActor, etag.Condition{}); err != errStorage {
+				t.Fatalf("got %v, want the storage error", err)
+			}
+			versions, err := store.AssetVersions.List(asset.GetID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(versions) != 1 {
+				t.Fatalf("got %d versions, want only the first", len(versions))
+			}
+
+			// The next update gets the number the failed one had
+			repo.failUpdate = false
+			if _, err := assets.PatchAsset(asset.GetID(), []byte(`{"text": "Sales grew 30%"}`), testActor, etag.Condition{}); err != nil {
+				t.Fatal(err)
+			}
+			latest, err := assets.GetVersion(asset.GetID(), 2)
+			if err != nil || latest.Asset.(*models.Insight).Text != "Sales grew 30%" {
+				t.Errorf("got %+v (%v), want version 2 with the new text", latest, err)
+			}
+
+			// An asset whose first version cannot be recorded is not kept
+			broken := NewAssetService(store.Assets, &failingVersions{store.AssetVersions}, store.Favourites, store.Collections, DeleteCascade, NewAuditLog(store.Audit))
+			created := &models.Insight{Text: "Churn fell"}
+			if _, err := broken.CreateAsset(created, testActor); err != errStorage {
+				t.Fatalf("got %v, want the storage error", err)
+			}
+			if _, err := store.Assets.GetByID(created.GetID()); err != errors.ErrAssetNotFound {
+				t.Errorf("got %v, want the asset deleted again", err)
+			}
+
+			// Nor is an update that cannot be recorded
+			if _, err := broken.PatchAsset(asset.GetID(), []byte(`{"text": "Sales fell"}`), testActor, etag.Condition{}); err != errStorage {
+				t.Fatalf("got %v, want the storage error", err)
+			}
+			stored, err := store.Assets.GetByID(asset.GetID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.(*models.Insight).Text != "Sales grew 30%" || stored.Base().Version != 2 {
+				t.Errorf("got %+v, want the asset left at version 2", stored)
+			}
+		})
+	}
+}
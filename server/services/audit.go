@@ -0,0 +1,75 @@
+package services
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/models"
+	"favourite_assets/server/paging"
+	"favourite_assets/server/repositories"
+)
+
+// AuditLog records every change made through the services
+type AuditLog struct {
+	repo repositories.AuditRepository
+}
+
+func NewAuditLog(repo repositories.AuditRepository) *AuditLog {
+	return &AuditLog{repo: repo}
+}
+
+// record appends an entry for a change actor made to a target. before and
+// after are snapshotted as JSON right away, nil for a target that did not
+// exist. The change is made by then, so a failure here only means it went
+// unrecorded.
+func (l *AuditLog) record(actor models.Actor, action models.AuditAction, targetType string, targetID uuid.UUID, before, after any) error {
+	entry := &models.AuditEntry{
+		ID:         uuid.New(),
+		Time:       time.Now(),
+		Actor:      actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RequestID:  actor.RequestID,
+	}
+	var err error
+	if entry.Before, err = snapshot(before); err != nil {
+		return err
+	}
+	if entry.After, err = snapshot(after); err != nil {
+		return err
+	}
+	return l.repo.Append(entry)
+}
+
+func snapshot(target any) (json.RawMessage, error) {
+	if target == nil {
+		return nil, nil
+	}
+	return json.Marshal(target)
+}
+
+// AuditSorts are the fields the audit log can be listed by
+var AuditSorts = []string{paging.SortTime}
+
+// Query returns a page of the entries matching filter and the cursor of the
+// next page
+func (l *AuditLog) Query(filter models.AuditFilter, page paging.Page) ([]*models.AuditEntry, string, error) {
+	entries, err := l.repo.Query(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	result, next := paging.Apply(page, entries, auditKey)
+	return result, next, nil
+}
+
+// Export returns every entry matching filter, oldest first
+func (l *AuditLog) Export(filter models.AuditFilter) ([]*models.AuditEntry, error) {
+	return l.repo.Query(filter)
+}
+
+func auditKey(entry *models.AuditEntry, _ string) paging.Key {
+	return paging.Key{ID: entry.ID, Value: paging.TimeKey(entry.Time)}
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"favourite_assets/server/etag"
+	"favourite_assets/server/models"
+	"favourite_assets/server/paging"
+)
+
+func TestAuditLog(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			f := newFixture(t, store, DeleteCascade, DeleteCascade)
+			audit := NewAuditLog(store.Audit)
+
+			notes := "quarterly"
+			if _, err := f.favourites.UpdateFavouriteNotes(f.favourite.ID, f.user.ID, false, FavouriteNotes{Notes: &notes}, testActor); err != nil {
+				t.Fatal(err)
+			}
+			edits, err := audit.Export(models.AuditFilter{TargetType: models.TargetFavourite, TargetID: f.favourite.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(edits) != 2 || edits[1].Action != models.AuditUpdate || string(edits[1].Before) == string(edits[1].After) {
+				t.Fatalf("got %+v, want the favourite's create and an update that changed it", edits)
+			}
+			var favBefore, favAfter models.Favourite
+			if err := json.Unmarshal(edits[1].Before, &favBefore); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(edits[1].After, &favAfter); err != nil {
+				t.Fatal(err)
+			}
+			if favBefore.Notes != "" || favAfter.Notes != notes {
+				t.Errorf("got notes %q -> %q, want \"\" -> %q", favBefore.Notes, favAfter.Notes, notes)
+			}
+
+			actor := models.Actor{Subject: "editor-sub", Username: "editor", Roles: []string{"admin"}, RequestID: "req-1"}
+			if _, err := f.users.UpdateUser(f.user.ID, "Ada Lovelace", "ada@example.com", etag.Condition{}, actor); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.assets.DeleteAsset(f.asset.GetID(), etag.Condition{}, actor); err != nil {
+				t.Fatal(err)
+			}
+			purger := NewTrashPurger(f.users, f.assets, time.Hour)
+			if _, _, err := purger.PurgeExpired(time.Now().Add(2 * time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+
+			// The fixture made four creates and one collection update, then the notes edit
+			all, err := audit.Export(models.AuditFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(all) != 9 {
+				t.Fatalf("got %d entries, want 9", len(all))
+			}
+
+			entries, _, err := audit.Query(models.AuditFilter{Actor: "editor-sub"}, paging.Page{Sort: paging.SortTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 {
+				t.Fatalf("got %d entries by the editor, want 2", len(entries))
+			}
+			update := entries[0]
+			if update.Action != models.AuditUpdate || update.TargetType != models.TargetUser || update.TargetID != f.user.ID ||
+				update.RequestID != "req-1" || update.Actor.Username != "editor" || len(update.Actor.Roles) != 1 {
+				t.Errorf("got %+v, want the user update with its actor", update)
+			}
+			var before, after models.User
+			if err := json.Unmarshal(update.Before, &before); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(update.After, &after); err != nil {
+				t.Fatal(err)
+			}
+			if before.Name != "Ada" || after.Name != "Ada Lovelace" {
+				t.Errorf("got %q -> %q, want the rename", before.Name, after.Name)
+			}
+
+			purges, err := audit.Export(models.AuditFilter{TargetType: models.TargetAsset, TargetID: f.asset.GetID()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(purges) != 3 || purges[2].Action != models.AuditPurge || purges[2].Actor.Subject != models.SystemActor.Subject ||
+				purges[2].Before == nil || purges[2].After != nil {
+				t.Errorf("got %+v, want create, delete and purge by the system", purges)
+			}
+
+			// Time ranges include from and exclude to
+			if entries, err := audit.Export(models.AuditFilter{From: start, To: entries[0].Time}); err != nil || len(entries) != 6 {
+				t.Errorf("got %d entries (%v) before the update, want the fixture's 5 and the notes edit", len(entries), err)
+			}
+			if entries, err := audit.Export(models.AuditFilter{From: time.Now()}); err != nil || len(entries) != 0 {
+				t.Errorf("got %d entries (%v) from now on, want none", len(entries), err)
+			}
+		})
+	}
+}
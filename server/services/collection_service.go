@@ -0,0 +1,166 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+	"favourite_assets/server/repositories"
+)
+
+const maxCollectionNameLength = 200
+
+type CollectionService struct {
+	repo             repositories.CollectionRepository
+	favouriteService *FavouriteService
+	audit            *AuditLog
+}
+
+func NewCollectionService(repo repositories.CollectionRepository, favouriteService *FavouriteService, audit *AuditLog) *CollectionService {
+	return &CollectionService{
+		repo:             repo,
+		favouriteService: favouriteService,
+		audit:            audit,
+	}
+}
+
+func validCollectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxCollectionNameLength {
+		return "", errors.ErrBadRequest
+	}
+	return name, nil
+}
+
+func (s *CollectionService) CreateCollection(userID uuid.UUID, name string, actor models.Actor) (*models.Collection, error) {
+	name, err := validCollectionName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	collection := &models.Collection{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Name:         name,
+		FavouriteIDs: []uuid.UUID{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if err := s.repo.Create(collection); err != nil {
+		return nil, err
+	}
+	if err := s.audit.record(actor, models.AuditCreate, models.TargetCollection, collection.ID, nil, collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func (s *CollectionService) ListCollections(userID uuid.UUID) ([]*models.Collection, error) {
+	return s.repo.ListByUser(userID)
+}
+
+// getOwned returns a collection of userID; other users' collections are
+// reported as missing
+func (s *CollectionService) getOwned(id, userID uuid.UUID) (*models.Collection, error) {
+	collection, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if collection.UserID != userID {
+		return nil, errors.ErrCollectionNotFound
+	}
+	return collection, nil
+}
+
+// GetCollection returns a collection of userID with its favourites in order,
+// embedding their assets when expand is set
+func (s *CollectionService) GetCollection(id, userID uuid.UUID, expand bool) (*models.Collection, error) {
+	collection, err := s.getOwned(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	favourites, err := s.favouriteService.ListFavouritesByUser(userID, expand)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*models.Favourite, len(favourites))
+	for _, fav := range favourites {
+		byID[fav.ID] = fav
+	}
+
+	collection.Favourites = make([]*models.Favourite, 0, len(collection.FavouriteIDs))
+	for _, favID := range collection.FavouriteIDs {
+		if fav, ok := byID[favID]; ok {
+			collection.Favourites = append(collection.Favourites, fav)
+		}
+	}
+	return collection, nil
+}
+
+func (s *CollectionService) RenameCollection(id, userID uuid.UUID, name string, actor models.Actor) (*models.Collection, error) {
+	name, err := validCollectionName(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.update(id, userID, actor, func() error { return s.repo.Rename(id, name) })
+}
+
+// DeleteCollection removes the collection only; its favourites are kept
+func (s *CollectionService) DeleteCollection(id, userID uuid.UUID, actor models.Actor) error {
+	collection, err := s.getOwned(id, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	return s.audit.record(actor, models.AuditDelete, models.TargetCollection, id, collection, nil)
+}
+
+// AddFavourite puts one of the user's favourites in the collection at
+// position (0-based), or at the end when position is negative
+func (s *CollectionService) AddFavourite(id, userID, favID uuid.UUID, position int, actor models.Actor) (*models.Collection, error) {
+	return s.update(id, userID, actor, func() error {
+		if _, err := s.favouriteService.GetFavourite(favID, userID, false, false); err != nil {
+			return err
+		}
+		return s.repo.AddItem(id, favID, position)
+	})
+}
+
+// RemoveFavourite takes a favourite out of the collection without deleting it
+func (s *CollectionService) RemoveFavourite(id, userID, favID uuid.UUID, actor models.Actor) (*models.Collection, error) {
+	return s.update(id, userID, actor, func() error { return s.repo.RemoveItem(id, favID) })
+}
+
+// ReorderFavourites sets the manual order; favIDs must list every favourite
+// of the collection exactly once
+func (s *CollectionService) ReorderFavourites(id, userID uuid.UUID, favIDs []uuid.UUID, actor models.Actor) (*models.Collection, error) {
+	return s.update(id, userID, actor, func() error { return s.repo.Reorder(id, favIDs) })
+}
+
+// update applies fn to a collection of userID and records the change
+func (s *CollectionService) update(id, userID uuid.UUID, actor models.Actor, fn func() error) (*models.Collection, error) {
+	before, err := s.getOwned(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(); err != nil {
+		return nil, err
+	}
+
+	collection, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit.record(actor, models.AuditUpdate, models.TargetCollection, id, before, collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
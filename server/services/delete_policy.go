@@ -0,0 +1,52 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"favourite_assets/server/repositories"
+
+	"github.com/google/uuid"
+)
+
+// DeletePolicy decides what happens to the favourites pointing at a user or
+// an asset that is deleted
+type DeletePolicy string
+
+const (
+	// DeleteCascade deletes the favourites together with their user or asset
+	DeleteCascade DeletePolicy = "cascade"
+	// DeleteRestrict refuses the delete with 409 while favourites point at it
+	DeleteRestrict DeletePolicy = "restrict"
+	// DeleteMarkUnavailable keeps the favourites, which are then returned with
+	// "assetUnavailable" set. Only meaningful for assets.
+	DeleteMarkUnavailable DeletePolicy = "mark"
+)
+
+// ParseUserDeletePolicy accepts "cascade" and "restrict"
+func ParseUserDeletePolicy(value string) (DeletePolicy, error) {
+	switch policy := DeletePolicy(strings.ToLower(value)); policy {
+	case DeleteCascade, DeleteRestrict:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid user delete policy %q, want cascade or restrict", value)
+}
+
+// ParseAssetDeletePolicy accepts "cascade", "restrict" and "mark"
+func ParseAssetDeletePolicy(value string) (DeletePolicy, error) {
+	switch policy := DeletePolicy(strings.ToLower(value)); policy {
+	case DeleteCascade, DeleteRestrict, DeleteMarkUnavailable:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid asset delete policy %q, want cascade, restrict or mark", value)
+}
+
+// detachFavourites drops deleted favourites from the collections holding them
+func detachFavourites(collections repositories.CollectionRepository, favIDs []uuid.UUID) error {
+	for _, favID := range favIDs {
+		if err := collections.RemoveFavourite(favID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
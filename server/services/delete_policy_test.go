@@ -0,0 +1,398 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/etag"
+	"favourite_assets/server/models"
+	"favourite_assets/server/paging"
+	"favourite_assets/server/repositories"
+)
+
+// fixture is one user with one favourite asset, kept in one collection
+type fixture struct {
+	users       *UserService
+	assets      *AssetService
+	favourites  *FavouriteService
+	collections *CollectionService
+
+	user       *models.User
+	asset      models.Asset
+	favourite  *models.Favourite
+	collection *models.Collection
+}
+
+func newFixture(t *testing.T, store *repositories.Store, userPolicy, assetPolicy DeletePolicy) *fixture {
+	t.Helper()
+
+	f := &fixture{}
+	f.users, f.assets, f.favourites = newServices(store, userPolicy, assetPolicy)
+	f.collections = NewCollectionService(store.Collections, f.favourites, NewAuditLog(store.Audit))
+
+	var err error
+	if f.user, err = f.users.CreateUser("Ada", "ada@example.com", testActor); err != nil {
+		t.Fatal(err)
+	}
+	if f.asset, err = f.assets.CreateAsset(&models.Insight{Text: "Sales grew 20%"}, testActor); err != nil {
+		t.Fatal(err)
+	}
+	if f.favourite, err = f.favourites.AddFavourite(f.user.ID, f.asset.GetID(), testActor); err != nil {
+		t.Fatal(err)
+	}
+	if f.collection, err = f.collections.CreateCollection(f.user.ID, "Reports", testActor); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.collections.AddFavourite(f.collection.ID, f.user.ID, f.favourite.ID, -1, testActor); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f *fixture) favouriteExists(t *testing.T, store *repositories.Store) bool {
+	t.Helper()
+	_, err := store.Favourites.GetByID(f.favourite.ID)
+	if err != nil && err != errors.ErrFavouriteNotFound {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestDeleteUserPolicies(t *testing.T) {
+	t.Run("cascade", func(t *testing.T) {
+		for name, store := range stores(t) {
+			t.Run(name, func(t *testing.T) {
+				f := newFixture(t, store, DeleteCascade, DeleteMarkUnavailable)
+
+				if err := f.users.DeleteUser(f.user.ID, etag.Condition{}, testActor); err != nil {
+					t.Fatal(err)
+				}
+				if !f.favouriteExists(t, store) {
+					t.Fatal("favourite was deleted with its user still in the trash")
+				}
+				if err := f.users.PurgeUser(f.user.ID, testActor); err != nil {
+					t.Fatal(err)
+				}
+				if f.favouriteExists(t, store) {
+					t.Error("favourite survived its user")
+				}
+				if _, err := store.Collections.GetByID(f.collection.ID); err != errors.ErrCollectionNotFound {
+					t.Errorf("collection survived its user: %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("restrict", func(t *testing.T) {
+		for name, store := range stores(t) {
+			t.Run(name, func(t *testing.T) {
+				f := newFixture(t, store, DeleteRestrict, DeleteMarkUnavailable)
+
+				if err := f.users.DeleteUser(f.user.ID, etag.Condition{}, testActor); err != errors.ErrUserHasFavourites {
+					t.Fatalf("got %v, want ErrUserHasFavourites", err)
+				}
+				if _, err := f.users.GetUser(f.user.ID); err != nil {
+					t.Errorf("user was deleted: %v", err)
+				}
+
+				// Once the favourites are gone the user can be deleted
+				if err := f.favourites.RemoveFavourite(f.favourite.ID, f.user.ID, false, testActor); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.users.DeleteUser(f.user.ID, etag.Condition{}, testActor); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	})
+}
+
+// racingUsers runs beforeTrash right before a user is trashed, standing in
+// for a request that lands between the checks and the write
+type racingUsers struct {
+	repositories.UserRepository
+	beforeTrash func()
+}
+
+func (r *racingUsers) Trash(userID uuid.UUID, version int, deletedBy string, at time.Time) error {
+	r.beforeTrash()
+	return r.UserRepository.Trash(userID, version, deletedBy, at)
+}
+
+func TestDeleteUserRaces(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			repo := &racingUsers{UserRepository: store.Users}
+			users := NewUserService(repo, store.Favourites, store.Collections, DeleteRestrict, NewAuditLog(store.Audit))
+			user, err := users.CreateUser("Ada", "ada@example.com", testActor)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// An update after the If-Match check makes the tag stale
+			repo.beforeTrash = func() {
+				if _, err := users.UpdateUser(user.ID, "Ada Lovelace", user.Email, etag.Condition{}, testActor); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := users.DeleteUser(user.ID, etag.IfMatch(ifMatchRequest(user.Version)), testActor); err != errors.ErrPreconditionFailed {
+				t.Fatalf("got %v, want ErrPreconditionFailed", err)
+			}
+
+			// A favourite added after the restrict check keeps the user
+			asset, err := NewAssetService(store.Assets, store.AssetVersions, store.Favourites, store.Collections, DeleteCascade, NewAuditLog(store.Audit)).
+				CreateAsset(&models.Insight{Text: "Sales grew 20%"}, testActor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo.beforeTrash = func() {
+				now := time.Now()
+				fav := &models.Favourite{ID: uuid.New(), UserID: user.ID, AssetID: asset.GetID(), AssetType: asset.GetType(), CreatedAt: now, UpdatedAt: now}
+				if err := store.Favourites.Create(fav); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := users.DeleteUser(user.ID, etag.Condition{}, testActor); err != errors.ErrUserHasFavourites {
+				t.Fatalf("got %v, want ErrUserHasFavourites", err)
+			}
+			if got, err := users.GetUser(user.ID); err != nil || got.Name != "Ada Lovelace" {
+				t.Errorf("got %+v (%v), want the updated user kept", got, err)
+			}
+		})
+	}
+}
+
+// ifMatchRequest returns a request with an If-Match header for version
+func ifMatchRequest(version int) *http.Request {
+	r := httptest.NewRequest(http.MethodDelete, "/users", nil)
+	r.Header.Set("If-Match", etag.Format(version))
+	return r
+}
+
+func TestDeleteAssetPolicies(t *testing.T) {
+	t.Run("cascade", func(t *testing.T) {
+		for name, store := range stores(t) {
+			t.Run(name, func(t *testing.T) {
+				f := newFixture(t, store, DeleteCascade, DeleteCascade)
+
+				if err := f.assets.DeleteAsset(f.asset.GetID(), etag.Condition{}, testActor); err != nil {
+					t.Fatal(err)
+				}
+				if !f.favouriteExists(t, store) {
+					t.Fatal("favourite was deleted with its asset still in the trash")
+				}
+				if err := f.assets.PurgeAsset(f.asset.GetID(), testActor); err != nil {
+					t.Fatal(err)
+				}
+				if f.favouriteExists(t, store) {
+					t.Error("favourite survived its asset")
+				}
+				collection, err := store.Collections.GetByID(f.collection.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(collection.FavouriteIDs) != 0 {
+					t.Errorf("collection still holds %v", collection.FavouriteIDs)
+				}
+			})
+		}
+	})
+
+	t.Run("restrict", func(t *testing.T) {
+		for name, store := range stores(t) {
+			t.Run(name, func(t *testing.T) {
+				f := newFixture(t, store, DeleteCascade, DeleteRestrict)
+
+				if err := f.assets.DeleteAsset(f.asset.GetID(), etag.Condition{}, testActor); err != errors.ErrAssetHasFavourites {
+					t.Fatalf("got %v, want ErrAssetHasFavourites", err)
+				}
+				if _, err := f.assets.GetAsset(f.asset.GetID()); err != nil {
+					t.Errorf("asset was deleted: %v", err)
+				}
+				if !f.favouriteExists(t, store) {
+					t.Error("favourite was deleted")
+				}
+			})
+		}
+	})
+
+	t.Run("mark", func(t *testing.T) {
+		for name, store := range stores(t) {
+			t.Run(name, func(t *testing.T) {
+				f := newFixture(t, store, DeleteCascade, DeleteMarkUnavailable)
+
+				if err := f.assets.DeleteAsset(f.asset.GetID(), etag.Condition{}, testActor); err != nil {
+					t.Fatal(err)
+				}
+				// Hidden while the asset is in the trash, flagged once it is purged
+				if _, err := f.favourites.GetFavourite(f.favourite.ID, f.user.ID, false, true); err != errors.ErrFavouriteNotFound {
+					t.Fatalf("got %v, want ErrFavouriteNotFound", err)
+				}
+				if err := f.assets.PurgeAsset(f.asset.GetID(), testActor); err != nil {
+					t.Fatal(err)
+				}
+				fav, err := f.favourites.GetFavourite(f.favourite.ID, f.user.ID, false, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !fav.AssetUnavailable || fav.Asset != nil {
+					t.Errorf("got unavailable=%v asset=%v, want the favourite flagged", fav.AssetUnavailable, fav.Asset)
+				}
+			})
+		}
+	})
+}
+
+func TestTrash(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			f := newFixture(t, store, DeleteCascade, DeleteCascade)
+
+			if err := f.assets.DeleteAsset(f.asset.GetID(), etag.Condition{}, testActor); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.assets.GetAsset(f.asset.GetID()); err != errors.ErrAssetNotFound {
+				t.Errorf("got %v, want the trashed asset hidden", err)
+			}
+			favourites, err := f.favourites.ListFavouritesByUser(f.user.ID, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(favourites) != 0 {
+				t.Errorf("got %d favourites, want the trashed asset's hidden", len(favourites))
+			}
+			trash, _, err := f.assets.ListTrash(paging.Page{Sort: paging.SortDeletedAt})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(trash) != 1 || trash[0].Base().DeletedBy != "admin-sub" || trash[0].Base().DeletedAt == nil {
+				t.Fatalf("got trash %v, want the asset with its actor", trash)
+			}
+
+			// Restoring brings the favourite back
+			if _, err := f.assets.RestoreAsset(f.asset.GetID(), testActor); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.favourites.GetFavourite(f.favourite.ID, f.user.ID, false, false); err != nil {
+				t.Errorf("favourite still hidden after restore: %v", err)
+			}
+			if err := f.assets.PurgeAsset(f.asset.GetID(), testActor); err != errors.ErrAssetNotFound {
+				t.Errorf("got %v, want a live asset left alone", err)
+			}
+
+			// Only what has been in the trash for longer than the retention is purged
+			if err := f.users.DeleteUser(f.user.ID, etag.Condition{}, testActor); err != nil {
+				t.Fatal(err)
+			}
+			purger := NewTrashPurger(f.users, f.assets, time.Hour)
+			if users, _, err := purger.PurgeExpired(time.Now()); err != nil || users != 0 {
+				t.Fatalf("purged %d users (%v), want none yet", users, err)
+			}
+			if users, _, err := purger.PurgeExpired(time.Now().Add(2 * time.Hour)); err != nil || users != 1 {
+				t.Fatalf("purged %d users (%v), want 1", users, err)
+			}
+			if _, err := f.users.RestoreUser(f.user.ID, testActor); err != errors.ErrUserNotFound {
+				t.Errorf("got %v, want the purged user gone", err)
+			}
+			if f.favouriteExists(t, store) {
+				t.Error("favourite survived its purged user")
+			}
+		})
+	}
+}
+
+// flakyVersions fails the next DeleteByAsset while fail is set
+type flakyVersions struct {
+	repositories.AssetVersionRepository
+	fail bool
+}
+
+func (r *flakyVersions) DeleteByAsset(assetID uuid.UUID) error {
+	if r.fail {
+		r.fail = false
+		return errStorage
+	}
+	return r.AssetVersionRepository.DeleteByAsset(assetID)
+}
+
+// unreadableAssets fails every read, like a database that went away
+type unreadableAssets struct {
+	repositories.AssetRepository
+}
+
+func (r *unreadableAssets) GetByID(uuid.UUID) (models.Asset, error) {
+	return nil, errStorage
+}
+
+func TestAssetDeleteFailures(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			f := newFixture(t, store, DeleteCascade, DeleteCascade)
+			audit := NewAuditLog(store.Audit)
+
+			// A storage failure is not a missing asset
+			broken := NewAssetService(&unreadableAssets{store.Assets}, store.AssetVersions, store.Favourites, store.Collections, DeleteCascade, audit)
+			if err := broken.DeleteAsset(f.asset.GetID(), etag.Condition{}, testActor); err != errStorage {
+				t.Fatalf("got %v, want the storage error", err)
+			}
+
+			// A purge that fails halfway keeps the asset in the trash, so
+			// purging again removes everything
+			versions := &flakyVersions{AssetVersionRepository: store.AssetVersions, fail: true}
+			assets := NewAssetService(store.Assets, versions, store.Favourites, store.Collections, DeleteCascade, audit)
+			if err := assets.DeleteAsset(f.asset.GetID(), etag.Condition{}, testActor); err != nil {
+				t.Fatal(err)
+			}
+			if err := assets.PurgeAsset(f.asset.GetID(), testActor); err != errStorage {
+				t.Fatalf("got %v, want the storage error", err)
+			}
+			if _, err := store.Assets.GetTrashed(f.asset.GetID()); err != nil {
+				t.Fatalf("got %v, want the asset still in the trash", err)
+			}
+			if err := assets.PurgeAsset(f.asset.GetID(), testActor); err != nil {
+				t.Fatal(err)
+			}
+			if f.favouriteExists(t, store) {
+				t.Error("favourite survived its asset")
+			}
+			if left, err := store.AssetVersions.List(f.asset.GetID()); err != nil || len(left) != 0 {
+				t.Errorf("got %d versions (%v), want none", len(left), err)
+			}
+			if _, err := store.Assets.GetTrashed(f.asset.GetID()); err != errors.ErrAssetNotFound {
+				t.Errorf("got %v, want the asset purged", err)
+			}
+		})
+	}
+}
+
+func TestAddFavouriteToDeletedAsset(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			f := newFixture(t, store, DeleteCascade, DeleteCascade)
+
+			if err := f.assets.DeleteAsset(f.asset.GetID(), etag.Condition{}, testActor); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.favourites.AddFavourite(f.user.ID, f.asset.GetID(), testActor); err != errors.ErrAssetNotFound {
+				t.Fatalf("got %v, want ErrAssetNotFound", err)
+			}
+		})
+	}
+}
+
+func TestParseDeletePolicy(t *testing.T) {
+	if _, err := ParseUserDeletePolicy("mark"); err == nil {
+		t.Error("users accepted the mark policy")
+	}
+	if policy, err := ParseAssetDeletePolicy("Mark"); err != nil || policy != DeleteMarkUnavailable {
+		t.Errorf("got %q, %v", policy, err)
+	}
+	if _, err := ParseAssetDeletePolicy("ignore"); err == nil {
+		t.Error("accepted an unknown policy")
+	}
+}
@@ -5,30 +5,38 @@ import (
 
 	"favourite_assets/server/errors"
 	"favourite_assets/server/models"
+	"favourite_assets/server/paging"
 	"favourite_assets/server/repositories"
+	"favourite_assets/server/validation"
 
 	"github.com/google/uuid"
 )
 
 type FavouriteService struct {
-	repo         *repositories.FavouriteRepository
-	userService  *UserService
-	assetService *AssetService
+	repo           repositories.FavouriteRepository
+	collectionRepo repositories.CollectionRepository
+	userService    *UserService
+	assetService   *AssetService
+	audit          *AuditLog
 }
 
 func NewFavouriteService(
-	repo *repositories.FavouriteRepository,
+	repo repositories.FavouriteRepository,
+	collectionRepo repositories.CollectionRepository,
 	userService *UserService,
 	assetService *AssetService,
+	audit *AuditLog,
 ) *FavouriteService {
 	return &FavouriteService{
-		repo:         repo,
-		userService:  userService,
-		assetService: assetService,
+		repo:           repo,
+		collectionRepo: collectionRepo,
+		userService:    userService,
+		assetService:   assetService,
+		audit:          audit,
 	}
 }
 
-func (s *FavouriteService) AddFavourite(userID, assetID uuid.UUID) (*models.Favourite, error) {
+func (s *FavouriteService) AddFavourite(userID, assetID uuid.UUID, actor models.Actor) (*models.Favourite, error) {
 
 	if _, err := s.userService.GetUser(userID); err != nil {
 		return nil, errors.ErrUserNotFound
@@ -39,48 +47,251 @@ func (s *FavouriteService) AddFavourite(userID, assetID uuid.UUID) (*models.Favo
 		return nil, errors.ErrAssetNotFound
 	}
 
-	// Check if favourite already exists
-	existingFavourites := s.repo.ListByUser(userID)
-	for _, fav := range existingFavourites {
-		if fav.AssetID == assetID {
-			return nil, errors.ErrConflict
-		}
-	}
-
+	now := time.Now()
 	fav := &models.Favourite{
 		ID:        uuid.New(),
 		UserID:    userID,
 		AssetID:   assetID,
 		AssetType: asset.GetType(),
-		CreatedAt: time.Now(),
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
+	// The repository rejects a second favourite for the same asset, checking
+	// here first would race with concurrent requests
 	if err := s.repo.Create(fav); err != nil {
 		return nil, err
 	}
+
+	// The user or the asset may have been deleted since they were checked, in
+	// which case the delete policy never saw this favourite
+	if _, err := s.userService.GetUser(userID); err != nil {
+		return nil, s.rollback(fav, errors.ErrUserNotFound)
+	}
+	if _, err := s.assetService.GetAsset(assetID); err != nil {
+		return nil, s.rollback(fav, errors.ErrAssetNotFound)
+	}
+	if err := s.audit.record(actor, models.AuditCreate, models.TargetFavourite, fav.ID, nil, fav); err != nil {
+		return nil, err
+	}
 	return fav, nil
 }
 
-func (s *FavouriteService) RemoveFavourite(favID uuid.UUID) error {
+// rollback deletes a favourite that should not have been created and returns cause
+func (s *FavouriteService) rollback(fav *models.Favourite, cause error) error {
+	if err := s.repo.Delete(fav.ID); err != nil && err != errors.ErrFavouriteNotFound {
+		return err
+	}
+	return cause
+}
+
+// RemoveFavourite deletes a favourite owned by userID. With override set the
+// favourite may belong to anyone (admin access).
+func (s *FavouriteService) RemoveFavourite(favID, userID uuid.UUID, override bool, actor models.Actor) error {
+	fav, err := s.getOwned(favID, userID, override)
+	if err != nil {
+		return err
+	}
+
 	if err := s.repo.Delete(favID); err != nil {
-		return errors.ErrNotFound
+		return errors.ErrFavouriteNotFound
 	}
-	return nil
+
+	// Collections only reference favourites, drop the dangling entries
+	if err := s.collectionRepo.RemoveFavourite(favID); err != nil {
+		return err
+	}
+	return s.audit.record(actor, models.AuditDelete, models.TargetFavourite, favID, fav, nil)
 }
 
-func (s *FavouriteService) ListFavouritesByUser(userID uuid.UUID) ([]*models.Favourite, error) {
+// ListFavouritesByUser returns the favourites of userID next to their assets'
+// descriptions, with the whole assets embedded when expand is set
+func (s *FavouriteService) ListFavouritesByUser(userID uuid.UUID, expand bool) ([]*models.Favourite, error) {
 
 	if _, err := s.userService.GetUser(userID); err != nil {
 		return nil, errors.ErrUserNotFound
 	}
 
-	return s.repo.ListByUser(userID), nil
+	favourites, err := s.repo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.hydrate(favourites, expand)
 }
 
-func (s *FavouriteService) GetFavourite(favID uuid.UUID) (*models.Favourite, error) {
+// FavouriteSorts are the fields favourites can be listed by
+var FavouriteSorts = []string{paging.SortCreatedAt, paging.SortUpdatedAt, paging.SortDescription}
+
+// ListFavourites returns a page of the favourites of userID and the cursor of
+// the next page
+func (s *FavouriteService) ListFavourites(userID uuid.UUID, expand bool, page paging.Page) ([]*models.Favourite, string, error) {
+	favourites, err := s.ListFavouritesByUser(userID, expand)
+	if err != nil {
+		return nil, "", err
+	}
+	result, next := paging.Apply(page, favourites, favouriteKey)
+	return result, next, nil
+}
+
+// favouriteKey sorts by the description shown for the favourite: the user's
+// own, or the asset's
+func favouriteKey(fav *models.Favourite, sort string) paging.Key {
+	key := paging.Key{ID: fav.ID}
+	switch sort {
+	case paging.SortUpdatedAt:
+		key.Value = paging.TimeKey(fav.UpdatedAt)
+	case paging.SortDescription:
+		description := fav.CustomDescription
+		if description == "" {
+			description = fav.AssetDescription
+		}
+		key.Value = paging.TextKey(description)
+	default:
+		key.Value = paging.TimeKey(fav.CreatedAt)
+	}
+	return key
+}
+
+// GetFavourite returns a favourite owned by userID, with its asset embedded
+// when expand is set. With override set the favourite may belong to anyone
+// (admin access).
+func (s *FavouriteService) GetFavourite(favID, userID uuid.UUID, override, expand bool) (*models.Favourite, error) {
+	fav, err := s.getOwned(favID, userID, override)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.hydrateOne(fav, expand)
+}
+
+func (s *FavouriteService) getOwned(favID, userID uuid.UUID, override bool) (*models.Favourite, error) {
 	fav, err := s.repo.GetByID(favID)
 	if err != nil {
 		return nil, errors.ErrFavouriteNotFound
 	}
+
+	// Someone else's favourite is reported as missing, so IDs cannot be probed
+	if !override && fav.UserID != userID {
+		return nil, errors.ErrFavouriteNotFound
+	}
 	return fav, nil
 }
+
+// FavouriteNotes holds the user editable fields of a favourite; nil fields
+// are left unchanged
+type FavouriteNotes struct {
+	CustomDescription *string `json:"customDescription"`
+	Notes             *string `json:"notes"`
+}
+
+const (
+	maxCustomDescriptionLength = 1000
+	maxNotesLength             = 10000
+)
+
+// UpdateFavouriteNotes edits the annotations of a favourite owned by userID.
+// With override set the favourite may belong to anyone (admin access).
+func (s *FavouriteService) UpdateFavouriteNotes(favID, userID uuid.UUID, override bool, notes FavouriteNotes, actor models.Actor) (*models.Favourite, error) {
+	v := &validation.Validator{}
+	if notes.CustomDescription != nil {
+		v.MaxLength("customDescription", *notes.CustomDescription, maxCustomDescriptionLength)
+	}
+	if notes.Notes != nil {
+		v.MaxLength("notes", *notes.Notes, maxNotesLength)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	fav, err := s.getOwned(favID, userID, override)
+	if err != nil {
+		return nil, err
+	}
+	// Favourites of assets in the trash are hidden, and so cannot be edited
+	trashed, err := s.assetService.trashed([]uuid.UUID{fav.AssetID})
+	if err != nil {
+		return nil, err
+	}
+	if trashed[fav.AssetID] {
+		return nil, errors.ErrFavouriteNotFound
+	}
+
+	// Copy before the write, fav may be the stored value
+	before := *fav
+	updated := before
+	if notes.CustomDescription != nil {
+		updated.CustomDescription = *notes.CustomDescription
+	}
+	if notes.Notes != nil {
+		updated.Notes = *notes.Notes
+	}
+
+	if err := s.repo.Update(&updated); err != nil {
+		return nil, err
+	}
+	if err := s.audit.record(actor, models.AuditUpdate, models.TargetFavourite, favID, &before, &updated); err != nil {
+		return nil, err
+	}
+
+	return s.hydrateOne(&updated, false)
+}
+
+// hydrateOne hydrates a single favourite, reporting a hidden one as missing
+func (s *FavouriteService) hydrateOne(fav *models.Favourite, embed bool) (*models.Favourite, error) {
+	hydrated, err := s.hydrate([]*models.Favourite{fav}, embed)
+	if err != nil {
+		return nil, err
+	}
+	if len(hydrated) == 0 {
+		return nil, errors.ErrFavouriteNotFound
+	}
+	return hydrated[0], nil
+}
+
+// hydrate returns copies of favourites with their assets' descriptions, and
+// the whole assets when embed is set, fetched in a single batch. Favourites
+// whose asset is in the trash are left out, and those whose asset was
+// purged are flagged instead.
+func (s *FavouriteService) hydrate(favourites []*models.Favourite, embed bool) ([]*models.Favourite, error) {
+	ids := make([]uuid.UUID, 0, len(favourites))
+	for _, fav := range favourites {
+		ids = append(ids, fav.AssetID)
+	}
+
+	assets, err := s.assetService.GetAssets(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []uuid.UUID
+	for _, id := range ids {
+		if _, ok := assets[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	trashed := map[uuid.UUID]bool{}
+	if len(missing) > 0 {
+		if trashed, err = s.assetService.trashed(missing); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]*models.Favourite, 0, len(favourites))
+	for _, fav := range favourites {
+		if trashed[fav.AssetID] {
+			continue
+		}
+		// Copy, the repository may hand out its stored pointers
+		hydrated := *fav
+		if asset, ok := assets[fav.AssetID]; ok {
+			hydrated.AssetDescription = asset.GetDescription()
+			if embed {
+				hydrated.Asset = asset
+			}
+		} else {
+			hydrated.AssetUnavailable = true
+		}
+		result = append(result, &hydrated)
+	}
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+	"favourite_assets/server/repositories"
+)
+
+// stores returns every backend the favourite service can run on
+func stores(t *testing.T) map[string]*repositories.Store {
+	t.Helper()
+
+	journaled, err := repositories.OpenJournaledStore(t.TempDir(), repositories.JournalOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := repositories.OpenSQLStore(repositories.DialectSQLite, filepath.Join(t.TempDir(), "test.db"), repositories.SQLOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := map[string]*repositories.Store{
+		"memory":    repositories.NewMemoryStore(),
+		"journaled": journaled,
+		"sqlite":    sqlite,
+	}
+	t.Cleanup(func() {
+		for _, store := range result {
+			store.Close()
+		}
+	})
+	return result
+}
+
+func newServices(store *repositories.Store, userPolicy, assetPolicy DeletePolicy) (*UserService, *AssetService, *FavouriteService) {
+	audit := NewAuditLog(store.Audit)
+	users := NewUserService(store.Users, store.Favourites, store.Collections, userPolicy, audit)
+	assets := NewAssetService(store.Assets, store.AssetVersions, store.Favourites, store.Collections, assetPolicy, audit)
+	return users, assets, NewFavouriteService(store.Favourites, store.Collections, users, assets, audit)
+}
+
+// testActor makes the changes in tests
+var testActor = models.Actor{Subject: "admin-sub", Username: "admin", Roles: []string{"admin"}}
+
+func TestAddFavouriteConcurrentDuplicates(t *testing.T) {
+	const workers = 32
+
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			users, assets, favourites := newServices(store, DeleteCascade, DeleteCascade)
+
+			user, err := users.CreateUser("Ada", "ada@example.com", testActor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			asset, err := assets.CreateAsset(&models.Insight{Text: "40% of millennials spend more than 3 hours on social media daily"}, testActor)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				wg         sync.WaitGroup
+				start      = make(chan struct{})
+				errs       = make([]error, workers)
+				successful = 0
+				duplicates = 0
+			)
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					<-start
+					_, errs[i] = favourites.AddFavourite(user.ID, asset.GetID(), testActor)
+				}(i)
+			}
+			close(start)
+			wg.Wait()
+
+			for _, err := range errs {
+				switch err {
+				case nil:
+					successful++
+				case errors.ErrFavouriteDuplicate:
+					duplicates++
+				default:
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+			if successful != 1 || duplicates != workers-1 {
+				t.Fatalf("got %d created and %d duplicates, want 1 and %d", successful, duplicates, workers-1)
+			}
+
+			list, err := favourites.ListFavouritesByUser(user.ID, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 1 {
+				t.Fatalf("user has %d favourites, want 1", len(list))
+			}
+		})
+	}
+}
+
+func TestUpdateFavouriteNotesValidation(t *testing.T) {
+	f := newFixture(t, repositories.NewMemoryStore(), DeleteCascade, DeleteCascade)
+
+	long := strings.Repeat("a", maxNotesLength+1)
+	description := strings.Repeat("é", maxCustomDescriptionLength)
+	_, err := f.favourites.UpdateFavouriteNotes(f.favourite.ID, f.user.ID, false, FavouriteNotes{CustomDescription: &description, Notes: &long}, testActor)
+	validationErr, ok := err.(*errors.ValidationError)
+	if !ok || len(validationErr.Fields) != 1 || validationErr.Fields[0].Field != "notes" {
+		t.Fatalf("got %v, want a field error for notes only", err)
+	}
+
+	// Lengths count characters, not bytes
+	fav, err := f.favourites.UpdateFavouriteNotes(f.favourite.ID, f.user.ID, false, FavouriteNotes{CustomDescription: &description}, testActor)
+	if err != nil || fav.CustomDescription != description {
+		t.Errorf("got %v (%v), want the description saved", fav, err)
+	}
+}
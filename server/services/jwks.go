@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwksSource returns the raw JSON of a JWK set
+type jwksSource func(ctx context.Context) ([]byte, error)
+
+func jwksFromURL(client *http.Client, url string) jwksSource {
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("jwks: unexpected status %d from %s", resp.StatusCode, url)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	}
+}
+
+func jwksFromFile(path string) jwksSource {
+	return func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}
+}
+
+// jwksCache keeps the realm signing keys in memory. Keys are refreshed when
+// they get older than ttl, or when a token references an unknown kid (at most
+// once every minRefresh, so bogus kids cannot be used to hammer Keycloak).
+type jwksCache struct {
+	source     jwksSource
+	ttl        time.Duration
+	minRefresh time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func newJWKSCache(source jwksSource, ttl, minRefresh time.Duration) *jwksCache {
+	return &jwksCache{
+		source:     source,
+		ttl:        ttl,
+		minRefresh: minRefresh,
+		keys:       make(map[string]crypto.PublicKey),
+	}
+}
+
+func (c *jwksCache) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	fresh := time.Since(c.fetchedAt) < c.ttl
+	c.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	if err := c.refresh(ctx); err != nil && !ok {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("jwks: unknown key id %q", kid)
+}
+
+func (c *jwksCache) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.lastAttempt) < c.minRefresh {
+		return nil
+	}
+	c.lastAttempt = time.Now()
+
+	raw, err := c.source(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(raw)
+	if err != nil {
+		return err
+	}
+
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+func parseJWKS(raw []byte) (map[string]crypto.PublicKey, error) {
+	var set jwkSet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		// Encryption keys are published in the same set; only signing keys matter here
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// Skip key types we do not support instead of failing the whole set
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks: no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URL(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("jwks: rsa exponent out of range")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+
+	case "EC":
+		// ES256 is the only EC algorithm tokens may use, and it needs P-256
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("jwks: unsupported curve %q", k.Crv)
+		}
+		curve := elliptic.P256()
+		x, err := decodeBase64URL(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URL(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, fmt.Errorf("jwks: invalid ec coordinates")
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	}
+
+	return nil, fmt.Errorf("jwks: unsupported key type %q", k.Kty)
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
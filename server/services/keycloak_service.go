@@ -2,26 +2,65 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
 
 	"github.com/Nerzal/gocloak/v13"
 	"github.com/golang-jwt/jwt/v5"
+	"favourite_assets/server/config"
 	"favourite_assets/server/errors"
 )
 
-type KeycloakService struct{}
+type KeycloakService struct {
+	cfg    config.KeycloakConfig
+	keys   *jwksCache
+	parser *jwt.Parser
+}
+
+func NewKeycloakService(cfg config.KeycloakConfig) *KeycloakService {
+	source := jwksFromURL(&http.Client{Timeout: 5 * time.Second}, cfg.JWKSURL)
+	if cfg.JWKSFile != "" {
+		source = jwksFromFile(cfg.JWKSFile)
+	}
 
-func NewKeycloakService() *KeycloakService {
-	return &KeycloakService{}
+	return &KeycloakService{
+		cfg:  cfg,
+		keys: newJWKSCache(source, cfg.CacheTTL, cfg.MinRefreshInterval),
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{"RS256", "ES256"}),
+			jwt.WithIssuer(cfg.Issuer),
+			jwt.WithLeeway(cfg.Leeway),
+		),
+	}
 }
+
 func (k *KeycloakService) VerifyToken(ctx context.Context, token string) (*gocloak.UserInfo, []string, error) {
-	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	// Signature, alg, iss, exp and nbf are all checked by the parser
+	parsed, err := k.parser.ParseWithClaims(token, jwt.MapClaims{}, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("missing kid header")
+		}
+		return k.keys.key(ctx, kid)
+	})
 	if err != nil {
-		return nil, nil, errors.ErrBadRequest
+		return nil, nil, errors.ErrInvalidToken
 	}
 
 	claims, ok := parsed.Claims.(jwt.MapClaims)
 	if !ok {
-		return nil, nil, errors.ErrUnauthorized
+		return nil, nil, errors.ErrInvalidToken
+	}
+
+	// A token without exp never expires, reject it
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		return nil, nil, errors.ErrInvalidToken
+	}
+
+	if !k.validAudience(claims) {
+		return nil, nil, errors.ErrInvalidToken
 	}
 
 	// Build user info from claims
@@ -30,6 +69,7 @@ func (k *KeycloakService) VerifyToken(ctx context.Context, token string) (*goclo
 		PreferredUsername: getClaimString(claims, "preferred_username"),
 		Email:             getClaimString(claims, "email"),
 		Name:              getClaimString(claims, "name"),
+		EmailVerified:     getClaimBool(claims, "email_verified"),
 	}
 
 	roles := []string{}
@@ -48,9 +88,32 @@ func (k *KeycloakService) VerifyToken(ctx context.Context, token string) (*goclo
 	return userInfo, roles, nil
 }
 
+// validAudience accepts the token if our client is one of its audiences or the
+// party it was issued to. Keycloak access tokens usually carry aud=["account"]
+// and azp=<client>, so checking "aud" alone would reject them.
+func (k *KeycloakService) validAudience(claims jwt.MapClaims) bool {
+	if k.cfg.Audience == "" {
+		return true
+	}
+
+	if aud, err := claims.GetAudience(); err == nil && slices.Contains(aud, k.cfg.Audience) {
+		return true
+	}
+
+	azp := getClaimString(claims, "azp")
+	return azp != nil && *azp == k.cfg.Audience
+}
+
 func getClaimString(claims jwt.MapClaims, key string) *string {
 	if v, ok := claims[key].(string); ok {
 		return &v
 	}
 	return nil
 }
+
+func getClaimBool(claims jwt.MapClaims, key string) *bool {
+	if v, ok := claims[key].(bool); ok {
+		return &v
+	}
+	return nil
+}
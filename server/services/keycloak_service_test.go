@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"favourite_assets/server/config"
+	"favourite_assets/server/errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://keycloak.example.com/realms/test"
+	testAudience = "favourite-assets"
+)
+
+// signingKeys are the keys of a test realm, published as a JWK set
+type signingKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newSigningKeys(t *testing.T) *signingKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &signingKeys{rsa: rsaKey, ec: ecKey}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jwk {
+	return jwk{Kid: kid, Kty: "RSA", Alg: "RS256", Use: "sig", N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) jwk {
+	ecdh, err := key.ECDH()
+	if err != nil {
+		panic(err)
+	}
+	// Uncompressed point: 0x04 || X || Y
+	point := ecdh.PublicKey().Bytes()
+	size := (len(point) - 1) / 2
+	return jwk{Kid: kid, Kty: "EC", Alg: "ES256", Use: "sig", Crv: key.Curve.Params().Name, X: b64(point[1 : 1+size]), Y: b64(point[1+size:])}
+}
+
+func (k *signingKeys) set(kids ...string) []byte {
+	set := jwkSet{}
+	for _, kid := range kids {
+		switch kid {
+		case "rsa":
+			set.Keys = append(set.Keys, rsaJWK(kid, &k.rsa.PublicKey))
+		case "ec":
+			set.Keys = append(set.Keys, ecJWK(kid, k.ec))
+		}
+	}
+	raw, err := json.Marshal(set)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+// validClaims are the claims of a token the service accepts
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":                testIssuer,
+		"aud":                []string{"account"},
+		"azp":                testAudience,
+		"sub":                "user-sub",
+		"preferred_username": "ada",
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"realm_access":       map[string]any{"roles": []string{"admin"}},
+	}
+}
+
+func (k *signingKeys) sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	var key any
+	switch method {
+	case jwt.SigningMethodRS256:
+		key = k.rsa
+	case jwt.SigningMethodES256:
+		key = k.ec
+	case jwt.SigningMethodHS256:
+		// The public key as an HMAC secret, the classic algorithm confusion
+		key = k.rsa.PublicKey.N.Bytes()
+	case jwt.SigningMethodNone:
+		key = jwt.UnsafeAllowNoneSignatureType
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testKeycloakConfig() config.KeycloakConfig {
+	return config.KeycloakConfig{
+		Issuer:   testIssuer,
+		Audience: testAudience,
+		CacheTTL: time.Hour,
+		Leeway:   time.Second,
+	}
+}
+
+// jwksServer serves the current key set and counts the fetches
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu  sync.Mutex
+	raw []byte
+}
+
+func newJWKSServer(t *testing.T, raw []byte) *jwksServer {
+	s := &jwksServer{raw: raw}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(s.raw)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) publish(raw []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.raw = raw
+}
+
+func TestVerifyToken(t *testing.T) {
+	keys := newSigningKeys(t)
+	other := newSigningKeys(t)
+	server := newJWKSServer(t, keys.set("rsa", "ec"))
+	cfg := testKeycloakConfig()
+	cfg.JWKSURL = server.URL
+	kc := NewKeycloakService(cfg)
+
+	with := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		claims := validClaims()
+		change(claims)
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"rs256", keys.sign(t, jwt.SigningMethodRS256, "rsa", validClaims()), true},
+		{"es256", keys.sign(t, jwt.SigningMethodES256, "ec", validClaims()), true},
+		{"audience in aud", keys.sign(t, jwt.SigningMethodRS256, "rsa", with(func(c jwt.MapClaims) {
+			c["aud"] = testAudience
+			delete(c, "azp")
+		})), true},
+		{"bad signature", other.sign(t, jwt.SigningMethodRS256, "rsa", validClaims()), false},
+		{"ec signature under the rsa kid", keys.sign(t, jwt.SigningMethodES256, "rsa", validClaims()), false},
+		{"missing kid", keys.sign(t, jwt.SigningMethodRS256, "", validClaims()), false},
+		{"expired", keys.sign(t, jwt.SigningMethodRS256, "rsa", with(func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+		})), false},
+		{"no exp", keys.sign(t, jwt.SigningMethodRS256, "rsa", with(func(c jwt.MapClaims) {
+			delete(c, "exp")
+		})), false},
+		{"not yet valid", keys.sign(t, jwt.SigningMethodRS256, "rsa", with(func(c jwt.MapClaims) {
+			c["nbf"] = time.Now().Add(time.Minute).Unix()
+		})), false},
+		{"other issuer", keys.sign(t, jwt.SigningMethodRS256, "rsa", with(func(c jwt.MapClaims) {
+			c["iss"] = "https://evil.example.com/realms/test"
+		})), false},
+		{"other audience", keys.sign(t, jwt.SigningMethodRS256, "rsa", with(func(c jwt.MapClaims) {
+			c["azp"] = "another-client"
+		})), false},
+		{"alg none", keys.sign(t, jwt.SigningMethodNone, "rsa", validClaims()), false},
+		{"alg hs256", keys.sign(t, jwt.SigningMethodHS256, "rsa", validClaims()), false},
+		{"garbage", "not.a.token", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userInfo, roles, err := kc.VerifyToken(context.Background(), tt.token)
+			if !tt.valid {
+				if err != errors.ErrInvalidToken {
+					t.Fatalf("got %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userInfo.Sub == nil || *userInfo.Sub != "user-sub" || len(roles) != 1 || roles[0] != "admin" {
+				t.Errorf("got %+v with roles %v, want user-sub with admin", userInfo, roles)
+			}
+		})
+	}
+}
+
+func TestVerifyTokenUnknownKidRefreshes(t *testing.T) {
+	keys := newSigningKeys(t)
+	server := newJWKSServer(t, keys.set("rsa"))
+	cfg := testKeycloakConfig()
+	cfg.JWKSURL = server.URL
+	kc := NewKeycloakService(cfg)
+	ctx := context.Background()
+
+	if _, _, err := kc.VerifyToken(ctx, keys.sign(t, jwt.SigningMethodRS256, "rsa", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := kc.VerifyToken(ctx, keys.sign(t, jwt.SigningMethodRS256, "rsa", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Fatalf("got %d fetches, want the keys cached after the first", got)
+	}
+
+	// The realm rotates in a new key, tokens signed with it force a refresh
+	server.publish(keys.set("rsa", "ec"))
+	if _, _, err := kc.VerifyToken(ctx, keys.sign(t, jwt.SigningMethodES256, "ec", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Fatalf("got %d fetches, want a refresh for the new kid", got)
+	}
+}
+
+func TestVerifyTokenUnknownKidThrottled(t *testing.T) {
+	keys := newSigningKeys(t)
+	server := newJWKSServer(t, keys.set("rsa"))
+	cfg := testKeycloakConfig()
+	cfg.JWKSURL = server.URL
+	cfg.MinRefreshInterval = time.Hour
+	kc := NewKeycloakService(cfg)
+	ctx := context.Background()
+
+	for range 3 {
+		if _, _, err := kc.VerifyToken(ctx, keys.sign(t, jwt.SigningMethodRS256, "bogus", validClaims())); err != errors.ErrInvalidToken {
+			t.Fatalf("got %v, want ErrInvalidToken", err)
+		}
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Errorf("got %d fetches, want unknown kids throttled to 1", got)
+	}
+}
+
+func TestParseJWKSCurves(t *testing.T) {
+	set := jwkSet{}
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set.Keys = append(set.Keys, ecJWK(curve.Params().Name, key))
+	}
+	raw, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only ES256 tokens are accepted, keys on other curves could never verify one
+	keys, err := parseJWKS(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keys["P-256"]; !ok || len(keys) != 1 {
+		t.Errorf("got keys %v, want the P-256 one only", keys)
+	}
+}
+
+func TestVerifyTokenJWKSFile(t *testing.T) {
+	keys := newSigningKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, keys.set("rsa", "ec"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testKeycloakConfig()
+	cfg.JWKSURL = "http://127.0.0.1:0/unused"
+	cfg.JWKSFile = path
+	kc := NewKeycloakService(cfg)
+	ctx := context.Background()
+
+	if _, _, err := kc.VerifyToken(ctx, keys.sign(t, jwt.SigningMethodES256, "ec", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := kc.VerifyToken(ctx, newSigningKeys(t).sign(t, jwt.SigningMethodES256, "ec", validClaims())); err != errors.ErrInvalidToken {
+		t.Errorf("got %v for a bad signature, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"favourite_assets/server/paging"
+)
+
+// TrashSorts are the fields the trash can be listed by
+var TrashSorts = []string{paging.SortDeletedAt}
+
+// TrashPurger purges the users and assets that have been in the trash for
+// longer than the retention period
+type TrashPurger struct {
+	users     *UserService
+	assets    *AssetService
+	retention time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewTrashPurger returns a purger for retention; a retention of zero or less
+// keeps deleted items until they are purged by hand
+func NewTrashPurger(users *UserService, assets *AssetService, retention time.Duration) *TrashPurger {
+	return &TrashPurger{users: users, assets: assets, retention: retention}
+}
+
+// PurgeExpired purges everything deleted before now minus the retention and
+// returns how many users and assets were purged
+func (p *TrashPurger) PurgeExpired(now time.Time) (users, assets int, err error) {
+	if p.retention <= 0 {
+		return 0, 0, nil
+	}
+	cutoff := now.Add(-p.retention)
+
+	if assets, err = p.assets.purgeExpired(cutoff); err != nil {
+		return users, assets, err
+	}
+	users, err = p.users.purgeExpired(cutoff)
+	return users, assets, err
+}
+
+// Start runs PurgeExpired every interval until Stop is called
+func (p *TrashPurger) Start(interval time.Duration) {
+	if p.retention <= 0 || interval <= 0 {
+		return
+	}
+
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				users, assets, err := p.PurgeExpired(time.Now())
+				if err != nil {
+					log.Printf("trash: purge failed: %v", err)
+				}
+				if users+assets > 0 {
+					log.Printf("trash: purged %d users and %d assets", users, assets)
+				}
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic purges and waits for a running one to finish
+func (p *TrashPurger) Stop() {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+	}
+}
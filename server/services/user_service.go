@@ -1,31 +1,47 @@
 package services
 
 import (
+	"sync"
+	"time"
+
 	"github.com/google/uuid"
+	"favourite_assets/server/etag"
 	"favourite_assets/server/models"
+	"favourite_assets/server/paging"
 	"favourite_assets/server/repositories"
 	"favourite_assets/server/errors"
 )
 
 type UserService struct {
-	repo *repositories.UserRepository
+	repo         repositories.UserRepository
+	favourites   repositories.FavouriteRepository
+	collections  repositories.CollectionRepository
+	deletePolicy DeletePolicy
+	audit        *AuditLog
+	// trashMu keeps a user from being restored while it is purged
+	trashMu sync.Mutex
 }
 
 
-func NewUserService(repo *repositories.UserRepository) *UserService {
+func NewUserService(
+	repo repositories.UserRepository,
+	favourites repositories.FavouriteRepository,
+	collections repositories.CollectionRepository,
+	deletePolicy DeletePolicy,
+	audit *AuditLog,
+) *UserService {
 	return &UserService{
-		repo: repo,
+		repo:         repo,
+		favourites:   favourites,
+		collections:  collections,
+		deletePolicy: deletePolicy,
+		audit:        audit,
 	}
 }
 
-func (s *UserService) CreateUser(name, email string) (*models.User, error) {
-
-	for _, user := range s.repo.List() {
-		if user.Email == email {
-			return user, errors.ErrUserExists 
-		}
-	}
-
+// CreateUser fails with ErrUserExists when another user has the same email,
+// ignoring case
+func (s *UserService) CreateUser(name, email string, actor models.Actor) (*models.User, error) {
 	user := &models.User{
 		ID:    uuid.New(),
 		Name:  name,
@@ -35,6 +51,9 @@ func (s *UserService) CreateUser(name, email string) (*models.User, error) {
 	if err := s.repo.Create(user); err != nil {
 		return nil, err
 	}
+	if err := s.audit.record(actor, models.AuditCreate, models.TargetUser, user.ID, nil, user); err != nil {
+		return nil, err
+	}
 
 	return user, nil
 }
@@ -43,26 +62,316 @@ func (s *UserService) GetUser(id uuid.UUID) (*models.User, error) {
 	return s.repo.GetByID(id)
 }
 
-func (s *UserService) UpdateUser(id uuid.UUID, name, email string) (*models.User, error) {
+// UpdateUser changes the name and email of a user. It fails with
+// ErrPreconditionFailed when ifMatch does not allow the current version.
+func (s *UserService) UpdateUser(id uuid.UUID, name, email string, ifMatch etag.Condition, actor models.Actor) (*models.User, error) {
 	user, err := s.repo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
+	if !ifMatch.Allows(user.Version) {
+		return nil, errors.ErrPreconditionFailed
+	}
 
+	before := *user
 	user.Name = name
 	user.Email = email
 
 	if err := s.repo.Update(user); err != nil {
 		return nil, err
 	}
+	if err := s.audit.record(actor, models.AuditUpdate, models.TargetUser, id, &before, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// DeleteUser moves a user into the trash on behalf of actor; their data
+// stays until PurgeUser. It fails with ErrPreconditionFailed when ifMatch
+// does not allow the current version, or the user changes before it is
+// trashed.
+func (s *UserService) DeleteUser(id uuid.UUID, ifMatch etag.Condition, actor models.Actor) error {
+	user, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if !ifMatch.Allows(user.Version) {
+		return errors.ErrPreconditionFailed
+	}
+
+	if err := s.checkNoFavourites(id); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := s.repo.Trash(id, user.Version, actor.Subject, now); err != nil {
+		return err
+	}
+
+	// A favourite added since the check either shows up now, or is rolled
+	// back by FavouriteService.AddFavourite, which checks the user again
+	if err := s.checkNoFavourites(id); err != nil {
+		if restoreErr := s.repo.Restore(id); restoreErr != nil {
+			return restoreErr
+		}
+		return err
+	}
+	trashed := *user
+	trashed.DeletedAt = &now
+	trashed.DeletedBy = actor.Subject
+	return s.audit.record(actor, models.AuditDelete, models.TargetUser, id, user, &trashed)
+}
+
+// checkNoFavourites fails with ErrUserHasFavourites when the delete policy
+// is DeleteRestrict and the user has favourites
+func (s *UserService) checkNoFavourites(id uuid.UUID) error {
+	if s.deletePolicy != DeleteRestrict {
+		return nil
+	}
+	favourites, err := s.favourites.ListByUser(id)
+	if err != nil {
+		return err
+	}
+	if len(favourites) > 0 {
+		return errors.ErrUserHasFavourites
+	}
+	return nil
+}
+
+// ListTrash returns a page of the users in the trash and the cursor of the
+// next page
+func (s *UserService) ListTrash(page paging.Page) ([]*models.User, string, error) {
+	users, err := s.repo.ListTrash()
+	if err != nil {
+		return nil, "", err
+	}
+	result, next := paging.Apply(page, users, trashedUserKey)
+	return result, next, nil
+}
 
+func trashedUserKey(user *models.User, _ string) paging.Key {
+	return paging.Key{ID: user.ID, Value: paging.TimeKey(*user.DeletedAt)}
+}
+
+// RestoreUser takes a user back out of the trash
+func (s *UserService) RestoreUser(id uuid.UUID, actor models.Actor) (*models.User, error) {
+	s.trashMu.Lock()
+	defer s.trashMu.Unlock()
+
+	trashed, err := s.repo.GetTrashed(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Restore(id); err != nil {
+		return nil, err
+	}
+	user, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit.record(actor, models.AuditRestore, models.TargetUser, id, trashed, user); err != nil {
+		return nil, err
+	}
 	return user, nil
 }
 
-func (s *UserService) DeleteUser(id uuid.UUID) error {
-	return s.repo.Delete(id)
+// PurgeUser deletes a user in the trash for good, with their collections, and
+// their favourites according to the delete policy
+func (s *UserService) PurgeUser(id uuid.UUID, actor models.Actor) error {
+	return s.purge(id, time.Time{}, actor)
+}
+
+// purge purges a user in the trash, if it was deleted before cutoff when
+// cutoff is set
+func (s *UserService) purge(id uuid.UUID, cutoff time.Time, actor models.Actor) error {
+	s.trashMu.Lock()
+	defer s.trashMu.Unlock()
+
+	// Only users in the trash are purged, a live one is reported as missing
+	trashed, err := s.repo.GetTrashed(id)
+	if err != nil {
+		return err
+	}
+	if !cutoff.IsZero() && !trashed.DeletedAt.Before(cutoff) {
+		return errors.ErrUserNotFound
+	}
+
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+
+	// Collections only hold the user's own favourites, they go with the user
+	if err := s.collections.DeleteByUser(id); err != nil {
+		return err
+	}
+
+	// A favourite added concurrently after this point is rolled back by
+	// FavouriteService.AddFavourite, which checks the user again
+	if s.deletePolicy == DeleteCascade {
+		if _, err := s.favourites.DeleteByUser(id); err != nil {
+			return err
+		}
+	}
+	return s.audit.record(actor, models.AuditPurge, models.TargetUser, id, trashed, nil)
+}
+
+// purgeExpired purges the users deleted before cutoff and returns how many
+// were purged
+func (s *UserService) purgeExpired(cutoff time.Time) (int, error) {
+	users, err := s.repo.ListTrash()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, user := range users {
+		if !user.DeletedAt.Before(cutoff) {
+			continue
+		}
+		// Restored, deleted again or purged since it was listed
+		if err := s.purge(user.ID, cutoff, models.SystemActor); err == errors.ErrUserNotFound {
+			continue
+		} else if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// UserSorts are the fields users can be listed by
+var UserSorts = []string{paging.SortCreatedAt, paging.SortUpdatedAt, paging.SortName, paging.SortEmail}
+
+// ListUsers returns a page of users and the cursor of the next page
+func (s *UserService) ListUsers(page paging.Page) ([]*models.User, string, error) {
+	users, err := s.repo.List()
+	if err != nil {
+		return nil, "", err
+	}
+	result, next := paging.Apply(page, users, userKey)
+	return result, next, nil
+}
+
+func userKey(user *models.User, sort string) paging.Key {
+	key := paging.Key{ID: user.ID}
+	switch sort {
+	case paging.SortUpdatedAt:
+		key.Value = paging.TimeKey(user.UpdatedAt)
+	case paging.SortName:
+		key.Value = paging.TextKey(user.Name)
+	case paging.SortEmail:
+		key.Value = paging.TextKey(user.Email)
+	default:
+		key.Value = paging.TimeKey(user.CreatedAt)
+	}
+	return key
+}
+
+// Claims is the profile information of an authenticated caller
+type Claims struct {
+	Name          string
+	Email         string
+	EmailVerified bool
+	Username      string
+}
+
+// ProvisionUser returns the local user linked to identity, creating it on the
+// first request and refreshing its profile when the claims have changed. A
+// user created by hand is linked when it has the same, verified, email.
+func (s *UserService) ProvisionUser(identity models.ExternalIdentity, claims Claims, actor models.Actor) (*models.User, error) {
+	if claims.Name == "" {
+		claims.Name = claims.Username
+	}
+
+	user, err := s.repo.GetByIdentity(identity)
+	if err == nil {
+		if user.DeletedAt != nil {
+			return nil, errors.ErrAccountDeleted
+		}
+		return s.refreshProfile(user, identity, claims, actor)
+	}
+	if err != errors.ErrUserNotFound {
+		return nil, err
+	}
+
+	if claims.EmailVerified && claims.Email != "" {
+		user, err := s.repo.GetByEmail(claims.Email)
+		if err == nil && user.Identity == nil && user.DeletedAt == nil {
+			return s.refreshProfile(user, identity, claims, actor)
+		}
+		if err != nil && err != errors.ErrUserNotFound {
+			return nil, err
+		}
+	}
+
+	user = &models.User{
+		ID:       uuid.New(),
+		Name:     claims.Name,
+		Email:    claims.Email,
+		Username: claims.Username,
+		Identity: &identity,
+	}
+	err = s.repo.Create(user)
+	if err == errors.ErrUserExists {
+		// Another request for the same identity won the race
+		if linked, err := s.repo.GetByIdentity(identity); err != errors.ErrUserNotFound {
+			return linked, err
+		}
+		// Otherwise the email belongs to another user, which keeps it
+		user.Email = ""
+		err = s.repo.Create(user)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit.record(actor, models.AuditCreate, models.TargetUser, user.ID, nil, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserService) refreshProfile(user *models.User, identity models.ExternalIdentity, claims Claims, actor models.Actor) (*models.User, error) {
+	// Claims missing from the token keep the stored value
+	updated := *user
+	updated.Identity = &identity
+	if claims.Name != "" {
+		updated.Name = claims.Name
+	}
+	if claims.Email != "" {
+		updated.Email = claims.Email
+	}
+	if claims.Username != "" {
+		updated.Username = claims.Username
+	}
+
+	if sameProfile(user, &updated) {
+		return user, nil
+	}
+
+	// A concurrent write wins; the profile is refreshed on a later request
+	err := s.repo.Update(&updated)
+	if err == errors.ErrUserExists && updated.Email != user.Email {
+		// The new email belongs to another user, which keeps it
+		updated.Email = user.Email
+		if sameProfile(user, &updated) {
+			return user, nil
+		}
+		err = s.repo.Update(&updated)
+	}
+	switch err {
+	case nil:
+		if err := s.audit.record(actor, models.AuditUpdate, models.TargetUser, user.ID, user, &updated); err != nil {
+			return nil, err
+		}
+	case errors.ErrPreconditionFailed:
+	default:
+		return nil, err
+	}
+	return s.repo.GetByID(user.ID)
 }
 
-func (s *UserService) ListUsers() []*models.User {
-	return s.repo.List()
+// sameProfile reports whether updated has the identity and profile of user
+func sameProfile(user, updated *models.User) bool {
+	return user.Identity != nil && *user.Identity == *updated.Identity &&
+		updated.Name == user.Name && updated.Email == user.Email && updated.Username == user.Username
 }
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"sync"
+	"testing"
+
+	"favourite_assets/server/errors"
+	"favourite_assets/server/models"
+)
+
+func TestCreateUserConcurrentDuplicateEmails(t *testing.T) {
+	const workers = 32
+
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			users, _, _ := newServices(store, DeleteCascade, DeleteCascade)
+
+			var (
+				wg         sync.WaitGroup
+				start      = make(chan struct{})
+				errs       = make([]error, workers)
+				successful = 0
+				duplicates = 0
+			)
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					<-start
+					// Emails are compared ignoring case
+					email := "ada@example.com"
+					if i%2 == 1 {
+						email = "Ada@Example.com"
+					}
+					_, errs[i] = users.CreateUser("Ada", email, testActor)
+				}(i)
+			}
+			close(start)
+			wg.Wait()
+
+			for _, err := range errs {
+				switch err {
+				case nil:
+					successful++
+				case errors.ErrUserExists:
+					duplicates++
+				default:
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+			if successful != 1 || duplicates != workers-1 {
+				t.Fatalf("got %d created and %d duplicates, want 1 and %d", successful, duplicates, workers-1)
+			}
+		})
+	}
+}
+
+func TestProvisionUserEmailTaken(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			users, _, _ := newServices(store, DeleteCascade, DeleteCascade)
+
+			manual, err := users.CreateUser("Ada", "ada@example.com", testActor)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A verified email links the user created by hand
+			ada := models.ExternalIdentity{Issuer: "https://sso.example.com", Subject: "ada"}
+			linked, err := users.ProvisionUser(ada, Claims{Email: "ADA@example.com", EmailVerified: true, Username: "ada"}, testActor)
+			if err != nil || linked.ID != manual.ID {
+				t.Fatalf("got %+v (%v), want the user created by hand linked", linked, err)
+			}
+
+			// An unverified one does not, the new user goes without it
+			other := models.ExternalIdentity{Issuer: "https://sso.example.com", Subject: "mallory"}
+			created, err := users.ProvisionUser(other, Claims{Email: "ada@example.com", Username: "mallory"}, testActor)
+			if err != nil || created.ID == manual.ID || created.Email != "" {
+				t.Fatalf("got %+v (%v), want a new user without an email", created, err)
+			}
+
+			// Nor does a profile refresh take it over
+			bob := models.ExternalIdentity{Issuer: "https://sso.example.com", Subject: "bob"}
+			if _, err := users.ProvisionUser(bob, Claims{Email: "bob@example.com", Username: "bob"}, testActor); err != nil {
+				t.Fatal(err)
+			}
+			refreshed, err := users.ProvisionUser(bob, Claims{Email: "ada@example.com", Username: "bobby"}, testActor)
+			if err != nil || refreshed.Email != "bob@example.com" || refreshed.Username != "bobby" {
+				t.Errorf("got %+v (%v), want the username refreshed and the email kept", refreshed, err)
+			}
+		})
+	}
+}
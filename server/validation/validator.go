@@ -0,0 +1,163 @@
+// Package validation checks request bodies and reports every invalid field
+// at once, as an errors.ValidationError
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"favourite_assets/server/errors"
+)
+
+// Validator collects field errors; the zero value is ready to use
+type Validator struct {
+	errs errors.ValidationError
+}
+
+// Add records an invalid field
+func (v *Validator) Add(field, message string) {
+	v.errs.Add(field, message)
+}
+
+// Err returns a ValidationError listing every recorded field, or nil
+func (v *Validator) Err() error {
+	return v.errs.Err()
+}
+
+// Required checks that value is not blank
+func (v *Validator) Required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Add(field, "is required")
+		return false
+	}
+	return true
+}
+
+// NonNegative checks that value is zero or more
+func (v *Validator) NonNegative(field string, value int) bool {
+	if value < 0 {
+		v.Add(field, "must not be negative")
+		return false
+	}
+	return true
+}
+
+// Range checks that value is within [min, max]
+func (v *Validator) Range(field string, value, min, max int) bool {
+	if value < min || value > max {
+		v.Add(field, fmt.Sprintf("must be between %d and %d", min, max))
+		return false
+	}
+	return true
+}
+
+// MaxLength checks that value has at most max characters
+func (v *Validator) MaxLength(field, value string, max int) bool {
+	if len([]rune(value)) > max {
+		v.Add(field, fmt.Sprintf("must be at most %d characters", max))
+		return false
+	}
+	return true
+}
+
+// OneOf checks that value is one of allowed
+func (v *Validator) OneOf(field, value string, allowed []string) bool {
+	if !slices.Contains(allowed, value) {
+		v.Add(field, "must be one of "+strings.Join(allowed, ", "))
+		return false
+	}
+	return true
+}
+
+// CountryCode checks that value is an ISO 3166-1 alpha-2 or alpha-3 code
+func (v *Validator) CountryCode(field, value string) bool {
+	if !IsCountryCode(value) {
+		v.Add(field, "must be an ISO 3166-1 alpha-2 or alpha-3 country code")
+		return false
+	}
+	return true
+}
+
+// IsCountryCode reports whether code is an ISO 3166-1 alpha-2 or alpha-3 code
+func IsCountryCode(code string) bool {
+	code = strings.ToUpper(code)
+	_, alpha2 := countryCodes[code]
+	_, alpha3 := alpha3Codes[code]
+	return alpha2 || alpha3
+}
+
+// CountryAlpha2 returns the alpha-2 code of an ISO 3166-1 alpha-2 or alpha-3
+// code, so that both forms of a country compare equal
+func CountryAlpha2(code string) (string, bool) {
+	code = strings.ToUpper(code)
+	if _, ok := countryCodes[code]; ok {
+		return code, true
+	}
+	alpha2, ok := alpha3Codes[code]
+	return alpha2, ok
+}
+
+// DecodeStrict decodes the JSON object in r into dst, rejecting unknown
+// fields. Type mismatches and unknown fields are returned as a
+// ValidationError, malformed JSON as ErrInvalidBody and a body cut off by
+// http.MaxBytesReader as ErrBodyTooLarge.
+func DecodeStrict(r io.Reader, dst any) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		var tooLarge *http.MaxBytesError
+		if stderrors.As(err, &tooLarge) {
+			return errors.ErrBodyTooLarge
+		}
+		if field, message, ok := DescribeDecodeError(err); ok {
+			v := &Validator{}
+			v.Add(field, message)
+			return v.Err()
+		}
+		return errors.ErrInvalidBody
+	}
+	return nil
+}
+
+// DecodeStrictBytes is DecodeStrict for a body already in memory
+func DecodeStrictBytes(data []byte, dst any) error {
+	return DecodeStrict(bytes.NewReader(data), dst)
+}
+
+// DescribeDecodeError turns a type mismatch or an unknown field reported by
+// encoding/json into a field error
+func DescribeDecodeError(err error) (field, message string, ok bool) {
+	if typeErr, isType := err.(*json.UnmarshalTypeError); isType {
+		return typeErr.Field, "must be " + jsonTypeName(typeErr.Type.Kind().String()), true
+	}
+
+	// encoding/json has no typed error for unknown fields
+	if name, found := strings.CutPrefix(err.Error(), "json: unknown field "); found {
+		return strings.Trim(name, `"`), "is not a known field", true
+	}
+	return "", "", false
+}
+
+// jsonTypeName describes a Go kind the way a JSON client would
+func jsonTypeName(kind string) string {
+	switch {
+	case kind == "string":
+		return "a string"
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"):
+		return "an integer"
+	case strings.HasPrefix(kind, "float"):
+		return "a number"
+	case kind == "bool":
+		return "a boolean"
+	case kind == "slice", kind == "array":
+		return "an array"
+	default:
+		return "an object"
+	}
+}
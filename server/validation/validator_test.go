@@ -0,0 +1,48 @@
+package validation
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"favourite_assets/server/errors"
+)
+
+func TestDecodeStrict(t *testing.T) {
+	var dst struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	tests := []struct {
+		body  string
+		field string
+		err   error
+	}{
+		{body: `{"name": "Ada", "count": 1}`},
+		{body: `{"name": 1}`, field: "name"},
+		{body: `{"nickname": "Ada"}`, field: "nickname"},
+		{body: `{"name": `, err: errors.ErrInvalidBody},
+	}
+	for _, tt := range tests {
+		err := DecodeStrict(strings.NewReader(tt.body), &dst)
+		if tt.field != "" {
+			validationErr, ok := err.(*errors.ValidationError)
+			if !ok || validationErr.Fields[0].Field != tt.field {
+				t.Errorf("%s: got %v, want an error for %q", tt.body, err, tt.field)
+			}
+			continue
+		}
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.body, err, tt.err)
+		}
+	}
+
+	// A body cut off at its size limit is too large, not malformed
+	body := http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader(`{"name": "Ada Lovelace"}`)), 10)
+	if err := DecodeStrict(body, &dst); err != errors.ErrBodyTooLarge {
+		t.Errorf("got %v, want ErrBodyTooLarge", err)
+	}
+}